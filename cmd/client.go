@@ -5,9 +5,7 @@ import (
 	"log"
 	"net/netip"
 
-	"github.com/google/uuid"
-
-	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/client"
 	"github.com/gweebg/mcast/internal/utils"
 )
 
@@ -15,13 +13,14 @@ func main() {
 
 	neighbour := flag.String("neighbour", "", "address of the a network node neighbour")
 	content := flag.String("content", "video.mp4", "specify what content to playback")
+	rendition := flag.String("rendition", "", "preferred rendition (quality) of the content, e.g. '720p'")
+	ladder := flag.String("ladder", "", "comma separated renditions to adapt between, highest quality first, e.g. '1080p,720p,360p'")
+	list := flag.Bool("list", false, "list the content available in the network and exit")
+	search := flag.String("search", "", "list the content whose name matches a glob or substring and exit")
+	minResolution := flag.String("min-resolution", "", "list the content with at least a resolution, e.g. '1280x720', and exit")
 
 	flag.Parse()
 
-	if *content == "video.mp4" {
-		log.Printf("no content name specificed, defaulting to '%v'", *content)
-	}
-
 	if *neighbour == "" {
 		log.Fatalf("neighbour address is mandatory to run the client")
 	}
@@ -29,49 +28,14 @@ func main() {
 	_, err := netip.ParseAddrPort(*neighbour)
 	utils.Check(err)
 
-	// discovery phase - send discovery packet, get response, check if found or not
-
-	clientUuid := uuid.New()
-	log.Printf("created client id %v\n", clientUuid)
-
-	conn := utils.SetupConnection("tcp", *neighbour)
-	log.Printf("connected with neighbout '%v' via tcp\n", *neighbour)
-
-	packet, err := packets.Discovery(clientUuid, *content).Encode()
-	utils.Check(err)
-
-	resultBytes := utils.SendAndWait(packet, conn)
-	log.Printf("received response for discovery request, decoding...\n")
-
-	result, err := packets.DecodePacket(resultBytes)
-	utils.Check(err)
-
-	if result.Header.Flags != packets.FOUND {
-		log.Printf("content '%v' is not available in the network\n", *content)
-		utils.CloseConnection(conn, *neighbour)
+	if *list || *search != "" || *minResolution != "" {
+		client.ListCatalog(*neighbour, *search, *minResolution)
 		return
-	}
-
-	log.Printf("content '%v' is available on the network, initiating stream request\n", *content)
-
-	// stream phase - send stream request, wait for port to listen to
-
-	packet, err = packets.Stream(clientUuid, *content).Encode()
-	utils.Check(err)
-
-	resultBytes = utils.SendAndWait(packet, conn)
-	log.Printf("received response from stream request, decoding...\n")
+	} // catalog listing, no playback
 
-	result, err = packets.DecodePacket(resultBytes)
-	utils.Check(err)
-
-	if result.Header.Flags != packets.PORT {
-		log.Printf("something went wrong, did not receive PORT packet\n")
-		utils.CloseConnection(conn, *neighbour)
-		return
+	if *content == "video.mp4" {
+		log.Printf("no content name specificed, defaulting to '%v'", *content)
 	}
 
-	log.Printf("content '%v' is streaming at '%v'\n", *content, result.Payload.Port)
-	utils.ListenStream(result.Payload.Port)
-
+	client.Play(*neighbour, *content, *rendition, *ladder)
 }
@@ -28,7 +28,7 @@ func main() {
 
 		log.Printf("received packet\n")
 
-		packet := packets.Discovery(uuid.New(), os.Args[3])
+		packet := packets.Discovery(uuid.New(), os.Args[3], "")
 
 		if yes, _ := strconv.ParseBool(os.Args[2]); !yes {
 			packet.Header.Flags.SetFlag(0b10000)
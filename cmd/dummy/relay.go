@@ -9,9 +9,10 @@ import (
 func main() {
 
 	list := make([]*node.Relay, 0)
-	r := node.NewRelay("video.mp4", "127.0.0.1:5000", "5001")
+	r, err := node.NewRelay("video.mp4", "127.0.0.1:5000", "5001")
+	utils.Check(err)
 
-	err := r.Add("127.0.0.1:5001")
+	err = r.Add("127.0.0.1:5001")
 	utils.Check(err)
 
 	err = r.Add("127.0.0.1:5002")
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/netip"
+
+	"github.com/gweebg/mcast/internal/bootstrap"
+	"github.com/gweebg/mcast/internal/client"
+	"github.com/gweebg/mcast/internal/node"
+	"github.com/gweebg/mcast/internal/rendezvous"
+	"github.com/gweebg/mcast/internal/server"
+	"github.com/gweebg/mcast/internal/utils"
+)
+
+// mcast asks the bootstrapper for its role and starts the matching component,
+// configured with the settings the bootstrapper holds for it.
+func main() {
+
+	bootstrapper := flag.String("bootstrap", "", "address of the bootstrapper node")
+	id := flag.String("id", bootstrap.DefaultId(), "id the node is configured by in the bootstrapper, the hostname by default")
+
+	// client settings, the content to play is not known by the bootstrapper
+	content := flag.String("content", "video.mp4", "specify what content to playback (client)")
+	rendition := flag.String("rendition", "", "preferred rendition (quality) of the content, e.g. '720p' (client)")
+	ladder := flag.String("ladder", "", "comma separated renditions to adapt between, highest quality first (client)")
+	list := flag.Bool("list", false, "list the content available in the network and exit (client)")
+
+	// rendezvous settings
+	strategy := flag.String("strategy", rendezvous.MetricsStrategyName, "server selection strategy (rendezvous)")
+	weights := flag.String("weights", "", "strategy weights as key=value pairs (rendezvous)")
+	linger := flag.Duration("linger", rendezvous.DefaultLinger, "how long to keep streaming a content no one is watching (rendezvous)")
+
+	flag.Parse()
+
+	if *bootstrapper == "" {
+		log.Fatalf("bootstrapper address is mandatory\n")
+	}
+
+	_, err := netip.ParseAddrPort(*bootstrapper)
+	utils.Check(err)
+
+	self, err := bootstrap.Fetch(*bootstrapper, *id)
+	utils.Check(err)
+
+	log.Printf("bootstrapper assigned role '%v' at '%v'\n", self.Type, self.SelfIp)
+
+	switch self.Type {
+
+	case bootstrap.Client:
+		neighbour, err := client.Attach(self.Neighbours)
+		utils.Check(err)
+
+		if *list {
+			client.ListCatalog(neighbour, "", "")
+			return
+		}
+		client.Play(neighbour, *content, *rendition, *ladder)
+
+	case bootstrap.Server:
+		catalog := self.Catalog
+		if catalog == "" {
+			catalog = "server_config.json"
+			log.Printf("no catalog assigned, defaulting to '%v'\n", catalog)
+		}
+
+		srv := server.New(self.SelfIp, catalog)
+		for _, point := range self.Rendezvous {
+			srv.Registrations = append(srv.Registrations, point.Address)
+		} // registered with every rendezvous point, so any of them can fail over to it
+		srv.Run()
+
+	case bootstrap.RendezvousPoint:
+		selection, err := rendezvous.ParseStrategy(*strategy, *weights)
+		if err != nil {
+			log.Fatalf("invalid selection strategy: %v\n", err)
+		}
+
+		rend := rendezvous.NewWithSelf(self)
+		rend.Strategy = selection
+		rend.Linger = *linger
+		rend.Run()
+
+	case bootstrap.ONode:
+		node.NewWithSelf(self).Run()
+
+	default:
+		log.Fatalf("unknown role '%v'\n", self.Type)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"github.com/gweebg/mcast/internal/bootstrap"
 	"github.com/gweebg/mcast/internal/node"
 	"github.com/gweebg/mcast/internal/utils"
 	"log"
@@ -11,6 +12,7 @@ import (
 func main() {
 
 	bootstrapper := flag.String("bootstrap", "", "address of the bootstrapper node")
+	id := flag.String("id", bootstrap.DefaultId(), "id the node is configured by in the bootstrapper, the hostname by default")
 
 	flag.Parse()
 
@@ -21,6 +23,6 @@ func main() {
 	_, err := netip.ParseAddrPort(*bootstrapper)
 	utils.Check(err)
 
-	onode := node.New(*bootstrapper)
+	onode := node.New(*bootstrapper, *id)
 	onode.Run()
 }
@@ -26,6 +26,9 @@ func main() {
 
 	address := flag.String("address", "", "address of the rendezvous node")
 	flag.Var(&servers, "server", "list of server address:port for the rendezvous node")
+	strategy := flag.String("strategy", rendezvous.MetricsStrategyName, "server selection strategy: metrics, least-loaded, round-robin, weighted-random or hash")
+	weights := flag.String("weights", "", "strategy weights as key=value pairs, e.g. latency=0.6,jitter=0.4,loss=1 or 10.0.0.1:5000=3")
+	linger := flag.Duration("linger", rendezvous.DefaultLinger, "how long to keep streaming a content no one is watching before stopping its server")
 
 	flag.Parse()
 
@@ -41,7 +44,14 @@ func main() {
 		log.Fatalf("rendezvous address cannot be localhost|127.0.0.1\n")
 	}
 
+	selection, err := rendezvous.ParseStrategy(*strategy, *weights)
+	if err != nil {
+		log.Fatalf("invalid selection strategy: %v\n", err)
+	}
+
 	rend := rendezvous.New(*address, servers...)
+	rend.Strategy = selection
+	rend.Linger = *linger
 	rend.Run()
 
 }
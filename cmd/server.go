@@ -4,12 +4,14 @@ import (
 	"flag"
 	"github.com/gweebg/mcast/internal/server"
 	"log"
+	"strings"
 )
 
 func main() {
 
 	address := flag.String("address", "", "address:port string to listen for tcp connections")
 	config := flag.String("config", "server_config.json", "configuration file for the server")
+	rendezvous := flag.String("rendezvous", "", "comma separated address:port list of rendezvous points to register with")
 
 	flag.Parse()
 
@@ -22,6 +24,9 @@ func main() {
 	}
 
 	srv := server.New(*address, *config)
+	if *rendezvous != "" {
+		srv.Registrations = strings.Split(*rendezvous, ",")
+	}
 	srv.Run()
 
 }
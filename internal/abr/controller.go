@@ -0,0 +1,111 @@
+package abr
+
+const (
+	// DefaultDownLoss is the loss rate above which the controller switches down.
+	DefaultDownLoss = 0.02
+	// DefaultUpLoss is the loss rate below which a sample counts as healthy.
+	DefaultUpLoss = 0.002
+	// DefaultThroughputDrop is the fraction of the reference throughput below which the controller switches down.
+	DefaultThroughputDrop = 0.5
+	// DefaultUpHold is the number of consecutive healthy samples needed to switch up.
+	DefaultUpHold = 5
+
+	// weight of a new healthy sample in the reference throughput.
+	referenceWeight = 0.2
+)
+
+// Controller decides which rendition of a ladder should be played, switching
+// down when the loss grows or the throughput collapses and back up once the
+// conditions have been healthy for a while.
+type Controller struct {
+	// Ladder lists the rendition names from the highest quality to the lowest.
+	Ladder []string
+
+	DownLoss       float64
+	UpLoss         float64
+	ThroughputDrop float64
+	UpHold         int
+
+	// index of the current rendition in the Ladder.
+	current int
+	// consecutive healthy samples.
+	healthy int
+	// smoothed throughput observed on the current rendition while healthy, 0 if unknown.
+	reference float64
+}
+
+// NewController creates a Controller over ladder, starting at rendition
+// (or the highest one if it is not in the ladder).
+func NewController(ladder []string, rendition string) *Controller {
+
+	c := &Controller{
+		Ladder:         ladder,
+		DownLoss:       DefaultDownLoss,
+		UpLoss:         DefaultUpLoss,
+		ThroughputDrop: DefaultThroughputDrop,
+		UpHold:         DefaultUpHold,
+	}
+
+	for i, name := range ladder {
+		if name == rendition {
+			c.current = i
+		}
+	}
+
+	return c
+}
+
+// Current returns the name of the current rendition.
+func (c *Controller) Current() string {
+	return c.Ladder[c.current]
+}
+
+// Set forces the current rendition, e.g. when a switch could not be carried out.
+func (c *Controller) Set(rendition string) {
+	for i, name := range c.Ladder {
+		if name == rendition {
+			c.current = i
+			c.healthy = 0
+			c.reference = 0
+		}
+	}
+}
+
+// Update feeds a new sample to the controller, returns the rendition to play
+// and whether it differs from the previous one.
+func (c *Controller) Update(s Sample) (string, bool) {
+
+	degraded := s.LossRate > c.DownLoss ||
+		(c.reference > 0 && s.Throughput < c.reference*c.ThroughputDrop)
+
+	if degraded {
+
+		c.healthy = 0
+		if c.current < len(c.Ladder)-1 {
+			c.current++
+			c.reference = 0 // different rendition, different bitrate
+			return c.Current(), true
+		}
+		return c.Current(), false
+	}
+
+	if s.LossRate <= c.UpLoss {
+		c.healthy++
+		if c.reference == 0 {
+			c.reference = s.Throughput
+		} else {
+			c.reference = (1-referenceWeight)*c.reference + referenceWeight*s.Throughput
+		}
+	} else {
+		c.healthy = 0
+	}
+
+	if c.healthy >= c.UpHold && c.current > 0 {
+		c.healthy = 0
+		c.current--
+		c.reference = 0
+		return c.Current(), true
+	}
+
+	return c.Current(), false
+}
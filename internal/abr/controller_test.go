@@ -0,0 +1,70 @@
+package abr
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestController(t *testing.T) {
+
+	healthy := Sample{LossRate: 0, Throughput: 4_000_000}
+	lossy := Sample{LossRate: 0.05, Throughput: 4_000_000}
+	starved := Sample{LossRate: 0, Throughput: 1_000_000}
+
+	tests := []struct {
+		name      string
+		samples   []Sample
+		rendition string
+		changed   bool
+	}{
+		{"stays while healthy", []Sample{healthy, healthy}, "720p", false},
+		{"switches down on loss", []Sample{lossy}, "360p", true},
+		{"stays at the bottom", []Sample{lossy, lossy}, "360p", false},
+		{"switches down on throughput drop", []Sample{healthy, starved}, "360p", true},
+		{"switches up after hold", []Sample{healthy, healthy, healthy, healthy, healthy}, "1080p", true},
+		{"hold restarts on loss", []Sample{healthy, healthy, healthy, {LossRate: 0.01, Throughput: 4_000_000}, healthy}, "720p", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			c := NewController([]string{"1080p", "720p", "360p"}, "720p")
+
+			var rendition string
+			var changed bool
+			for _, s := range tt.samples {
+				rendition, changed = c.Update(s)
+			}
+
+			if rendition != tt.rendition || changed != tt.changed {
+				t.Fatalf("Expected (%v, %v), but got (%v, %v)", tt.rendition, tt.changed, rendition, changed)
+			}
+		})
+	}
+}
+
+func TestSessionRendition(t *testing.T) {
+
+	ladder := []string{"1080p", "720p", "360p"}
+
+	tests := []struct {
+		name      string
+		requested string
+		rendition string
+	}{
+		{"starts at the requested rendition", "720p", "720p"},
+		{"starts at the top without one", "", "1080p"},
+		{"starts at the top when not in the ladder", "480p", "1080p"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s := NewSession("127.0.0.1:8080", uuid.New(), "video.mp4", ladder, tt.requested)
+			if rendition := s.Rendition(); rendition != tt.rendition {
+				t.Fatalf("Expected the stream of '%v' to be requested, but got '%v'", tt.rendition, rendition)
+			}
+		})
+	}
+}
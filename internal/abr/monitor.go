@@ -0,0 +1,72 @@
+package abr
+
+import (
+	"time"
+
+	"github.com/gweebg/mcast/internal/ts"
+)
+
+// Sample holds the conditions observed on a stream during a measurement window.
+type Sample struct {
+	// LossRate is the ratio of lost packets over expected packets, from 0 to 1.
+	LossRate float64
+	// Throughput is the received bitrate, in bits per second.
+	Throughput float64
+	// Packets is the number of transport stream packets received.
+	Packets uint64
+}
+
+// Monitor observes an incoming transport stream, counting received and lost
+// packets (from the continuity counters) and received bytes.
+type Monitor struct {
+	demuxer *ts.Demuxer
+
+	packets uint64
+	lost    uint64
+	bytes   uint64
+	start   time.Time
+}
+
+// NewMonitor creates a Monitor with an empty window.
+func NewMonitor() *Monitor {
+	return &Monitor{
+		demuxer: ts.NewDemuxer(),
+		start:   time.Now(),
+	}
+}
+
+// Observe accounts for a chunk of packets received from the stream.
+func (m *Monitor) Observe(chunk []byte) {
+
+	m.bytes += uint64(len(chunk))
+
+	for off := 0; off+ts.PacketSize <= len(chunk); off += ts.PacketSize {
+
+		info, err := m.demuxer.Demux(chunk[off : off+ts.PacketSize])
+		if err != nil {
+			continue
+		}
+
+		m.packets++
+		m.lost += uint64(info.Lost)
+	}
+}
+
+// Sample returns the conditions observed since the last call and starts a new window.
+func (m *Monitor) Sample() Sample {
+
+	elapsed := time.Since(m.start).Seconds()
+
+	sample := Sample{Packets: m.packets}
+	if expected := m.packets + m.lost; expected > 0 {
+		sample.LossRate = float64(m.lost) / float64(expected)
+	}
+	if elapsed > 0 {
+		sample.Throughput = float64(m.bytes*8) / elapsed
+	}
+
+	m.packets, m.lost, m.bytes = 0, 0, 0
+	m.start = time.Now()
+
+	return sample
+}
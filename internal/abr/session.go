@@ -0,0 +1,280 @@
+package abr
+
+import (
+	"errors"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/gweebg/mcast/internal/node"
+	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/streamer"
+	"github.com/gweebg/mcast/internal/utils"
+)
+
+// DefaultInterval is the default duration of a measurement window.
+const DefaultInterval = 2 * time.Second
+
+// Session plays a content through a neighbour, switching between its renditions
+// according to the conditions observed on the incoming stream. Switches reuse the
+// request id of the discovery, so no new discovery is needed, and only happen at
+// a random access point of the new rendition.
+type Session struct {
+	// Neighbour is the address of the node the stream requests are sent to.
+	Neighbour string
+	// RequestId is the id of the discovery request that found the content.
+	RequestId uuid.UUID
+	// ContentName is the content being played.
+	ContentName string
+	// Interval is the duration of each measurement window.
+	Interval time.Duration
+
+	controller *Controller
+
+	// keeps the rendition being played subscribed to, see node.Subscription.
+	subscription *node.Subscription
+	sMu          sync.Mutex
+}
+
+// NewSession creates a Session over the rendition ladder (highest quality first),
+// rendition is the one being requested initially.
+func NewSession(neighbour string, requestId uuid.UUID, contentName string, ladder []string, rendition string) *Session {
+	return &Session{
+		Neighbour:   neighbour,
+		RequestId:   requestId,
+		ContentName: contentName,
+		Interval:    DefaultInterval,
+		controller:  NewController(ladder, rendition),
+	}
+}
+
+// Rendition returns the rendition being played, the one to request the stream of
+// before calling Play.
+func (s *Session) Rendition() string {
+	return s.controller.Current()
+}
+
+// incoming is a stream received via udp, for a single rendition.
+type incoming struct {
+	rendition string
+	conn      *net.UDPConn
+	chunks    chan []byte
+}
+
+// listen starts receiving the stream sent to address, chunks is closed once the connection is closed.
+func listen(address string, rendition string) (*incoming, error) {
+
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	in := &incoming{
+		rendition: rendition,
+		conn:      conn,
+		chunks:    make(chan []byte, 256),
+	}
+
+	go func() {
+		defer close(in.chunks)
+		for {
+			buffer := make([]byte, streamer.TsMtu*10) // chunks are kept by the receiver
+			n, _, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			in.chunks <- buffer[:n]
+		}
+	}()
+
+	return in, nil
+}
+
+// request sends a STREAM packet for rendition to the neighbour and returns the streaming address.
+func (s *Session) request(rendition string) (string, error) {
+
+	conn, err := net.Dial("tcp", s.Neighbour)
+	if err != nil {
+		return "", err
+	}
+	defer utils.CloseConnection(conn, s.Neighbour)
+
+	packet, err := packets.Stream(s.RequestId, s.ContentName, rendition).Encode()
+	if err != nil {
+		return "", err
+	}
+
+	if err = packets.Send(conn, packet); err != nil {
+		return "", err
+	}
+
+	data, err := packets.NewReceiver(conn).Receive()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := packets.DecodePacket(data)
+	if err != nil {
+		return "", err
+	}
+
+	if result.Header.Flags != packets.PORT {
+		return "", errors.New("did not receive PORT packet for rendition '" + rendition + "'")
+	}
+
+	return result.Payload.Port, nil
+}
+
+// leave ends the subscription to a rendition that is not being renewed.
+func (s *Session) leave(rendition string) {
+	if err := node.Leave(s.Neighbour, s.RequestId, s.ContentName, rendition); err != nil {
+		log.Printf("(abr) cannot leave rendition '%v': %v\n", rendition, err)
+	}
+}
+
+// subscribe renews the subscription to rendition from now on, leaving the previous one.
+func (s *Session) subscribe(rendition string) {
+	s.sMu.Lock()
+	defer s.sMu.Unlock()
+
+	if s.subscription != nil {
+		s.subscription.Leave()
+	}
+	s.subscription = node.Subscribe(s.Neighbour, s.RequestId, s.ContentName, rendition)
+}
+
+// Leave ends the subscription to the rendition being played.
+func (s *Session) Leave() {
+	s.sMu.Lock()
+	defer s.sMu.Unlock()
+
+	if s.subscription != nil {
+		s.subscription.Leave()
+		s.subscription = nil
+	}
+}
+
+// Play plays the stream arriving at address (the current rendition) with ffplay,
+// adapting the rendition until the player exits or the stream ends.
+func (s *Session) Play(address string) {
+
+	ffplay := exec.Command("ffplay", "-f", "mpegts", "-")
+	ffplay.Stdout = os.Stdout
+	ffplay.Stderr = os.Stderr
+
+	stdin, err := ffplay.StdinPipe()
+	utils.Check(err)
+
+	err = ffplay.Start()
+	utils.Check(err)
+
+	active, err := listen(address, s.controller.Current())
+	utils.Check(err)
+
+	s.subscribe(active.rendition)
+	defer s.Leave()
+
+	var pending *incoming    // rendition being switched to
+	var cache *node.GopCache // holds the pending rendition until a random access point
+
+	monitor := NewMonitor()
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+
+		var pendingChunks chan []byte
+		if pending != nil {
+			pendingChunks = pending.chunks
+		} // nil channel, never selected
+
+		select {
+
+		case chunk, ok := <-active.chunks:
+			if !ok {
+				log.Printf("(abr) stream of '%v' ended\n", active.rendition)
+				return
+			}
+
+			monitor.Observe(chunk)
+			if _, err := stdin.Write(chunk); err != nil {
+				log.Printf("(abr) player exited\n")
+				return
+			}
+
+		case chunk, ok := <-pendingChunks:
+			if !ok {
+				log.Printf("(abr) stream of '%v' ended before switching\n", pending.rendition)
+				s.controller.Set(active.rendition)
+				s.leave(pending.rendition)
+				pending = nil
+				continue
+			}
+
+			cache.Write(chunk)
+
+			burst := cache.Burst()
+			if burst == nil {
+				continue
+			} // no random access point yet
+
+			if _, err := stdin.Write(burst); err != nil {
+				log.Printf("(abr) player exited\n")
+				return
+			}
+
+			log.Printf("(abr) switched from '%v' to '%v'\n", active.rendition, pending.rendition)
+			_ = active.conn.Close() // the old relay is no longer listened to
+			go func(old *incoming) {
+				for range old.chunks {
+				}
+			}(active) // drain, so the receiving goroutine can exit
+
+			active, pending = pending, nil
+			monitor = NewMonitor()
+			s.subscribe(active.rendition) // the old rendition is left
+
+		case <-ticker.C:
+			if pending != nil {
+				continue
+			} // already switching
+
+			sample := monitor.Sample()
+			rendition, changed := s.controller.Update(sample)
+			log.Printf("(abr) loss=%.4f throughput=%.0fbps rendition='%v'\n", sample.LossRate, sample.Throughput, rendition)
+
+			if !changed {
+				continue
+			}
+
+			streamAddr, err := s.request(rendition)
+			if err != nil {
+				log.Printf("(abr) cannot request rendition '%v': %v\n", rendition, err)
+				s.controller.Set(active.rendition)
+				continue
+			}
+
+			pending, err = listen(streamAddr, rendition)
+			if err != nil {
+				log.Printf("(abr) cannot listen to rendition '%v' at '%v': %v\n", rendition, streamAddr, err)
+				s.controller.Set(active.rendition)
+				pending = nil
+				s.leave(rendition) // requested, but never listened to
+				continue
+			}
+
+			cache = node.NewGopCache()
+			log.Printf("(abr) switching to '%v' at '%v', waiting for a random access point\n", rendition, streamAddr)
+		}
+	}
+}
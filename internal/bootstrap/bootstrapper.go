@@ -31,16 +31,20 @@ func New(filename, address string) *Bootstrap {
 	}
 }
 
-func (b *Bootstrap) GetNode(addrPort string) (Node, error) {
+// GetNode returns the configuration of the node with id, as sent in its 'GET' request.
+// Nodes without an id, or with one that is not configured, are looked up by the
+// address they connected from, addrPort, see Config.Find.
+func (b *Bootstrap) GetNode(id string, addrPort string) (Node, error) {
 
 	addr := strings.Split(addrPort, ":")[0]
 
-	if node, exists := b.Config.NodeGroup[addr]; exists {
-		return node, nil
+	if node, exists := b.Config.Find(id, addr); exists {
+		node.Rendezvous = b.Config.RendezvousPoints() // every node may need to reach them
+		return node.Role(), nil
 	}
 
 	// gob cannot encode nil values, so we set the default for a Node
-	return Node{}, errors.New("no records found for " + addr)
+	return Node{}, errors.New("no records found for '" + id + "' at " + addr)
 }
 
 func (b *Bootstrap) Listen() {
@@ -83,14 +87,14 @@ func (b *Bootstrap) handle(conn net.Conn) {
 		log.Printf("(%v) closed connection\n", conn.RemoteAddr().String())
 	}(conn) // defer the closing of the connection.
 
-	// read the connection for incoming data.
-	buffer := make([]byte, 1024)
-	size, err := conn.Read(buffer)
+	// read the connection for incoming data, packets are framed, see packets.Send.
+	data, err := packets.NewReceiver(conn).Receive()
 	if err != nil {
-		log.Fatalf("could not read from %v\n", rAddr)
+		log.Printf("(%v) could not read the request: %v\n", rAddr, err)
+		return
 	}
 
-	_, err = decodeAndCheckPacket(buffer[:size]) // p, holds the data from the client.
+	p, err := decodeAndCheckPacket(data) // p, holds the data from the client.
 	if err != nil {
 		log.Printf("(%v) %v\n", rAddr, err)
 		rflag = ERR
@@ -99,7 +103,7 @@ func (b *Bootstrap) handle(conn net.Conn) {
 	// todo: skip db check if rflag already ERR
 	addr := conn.RemoteAddr().String() // conn.RemoteAddr as a netip.Addr
 
-	r, err := b.GetNode(addr)
+	r, err := b.GetNode(p.Payload, addr) // the payload is the id of the node
 	if err != nil {
 		log.Printf("(%v) %v\n", rAddr, err)
 		rflag = ERR
@@ -140,12 +144,11 @@ func answer(node Node, flag flags.FlagType, conn net.Conn) bool {
 		return false
 	}
 
-	s, err := conn.Write(encResp)
-	if err != nil {
+	if err = packets.Send(conn, encResp); err != nil {
 		log.Print("cannot write to socket")
 		return false
 	}
 
-	log.Printf("(%v) responded with %v bytes\n", conn.RemoteAddr().String(), s)
+	log.Printf("(%v) responded with %v bytes\n", conn.RemoteAddr().String(), len(encResp))
 	return true
 }
@@ -1,7 +1,10 @@
 package bootstrap
 
 import (
+	"net"
 	"net/netip"
+	"slices"
+	"sort"
 )
 
 type NodeType string
@@ -17,20 +20,145 @@ type Node struct {
 	Type       NodeType         `json:"type"`
 	SelfIp     string           `json:"self"`
 	Neighbours []netip.AddrPort `json:"neighbours"`
+
+	// Addresses of the interfaces of the node, for the nodes configured by id that
+	// connect without one, see Config.Find.
+	Addresses []string `json:"addresses,omitempty"`
+
+	// Priority of a rendezvous point, the lowest is preferred when several can
+	// provide a content. Ignored for the other types of nodes.
+	Priority int `json:"priority,omitempty"`
+
+	// Rendezvous lists every rendezvous point of the overlay, filled by the
+	// bootstrapper and ordered by priority.
+	Rendezvous []Rendezvous `json:"rendezvous,omitempty"`
+
+	// Servers a rendezvous point connects to, as address:port.
+	Servers []string `json:"servers,omitempty"`
+	// Ports a rendezvous point or node opens its relays on.
+	Ports *PortRange `json:"ports,omitempty"`
+	// Catalog is the path of the configuration file of a server.
+	Catalog string `json:"catalog,omitempty"`
+}
+
+// PortRange is an inclusive range of ports, Last is 0 for no upper bound.
+type PortRange struct {
+	First uint64 `json:"first"`
+	Last  uint64 `json:"last,omitempty"`
+}
+
+// Valid checks whether the range is not empty.
+func (p PortRange) Valid() bool {
+	return p.First > 0 && (p.Last == 0 || p.First <= p.Last)
+}
+
+// Role returns the node with only the settings that apply to its type, i.e. what
+// the bootstrapper answers with.
+func (n Node) Role() Node {
+
+	role := Node{
+		Type:   n.Type,
+		SelfIp: n.SelfIp,
+	}
+
+	switch n.Type {
+
+	case Client:
+		role.Neighbours = n.Neighbours // where the client attaches to the overlay
+
+	case Server:
+		role.Catalog = n.Catalog
+		role.Rendezvous = n.Rendezvous // where the server registers itself
+
+	case RendezvousPoint:
+		role.Priority = n.Priority
+		role.Servers = n.Servers
+		role.Ports = n.Ports
+
+	case ONode:
+		role.Neighbours = n.Neighbours
+		role.Rendezvous = n.Rendezvous
+		role.Ports = n.Ports
+	}
+
+	return role
+}
+
+// Rendezvous is the address and priority of a rendezvous node.
+type Rendezvous struct {
+	Address  string `json:"address"`
+	Priority int    `json:"priority"`
 }
 
+// Nodes holds the configuration of each node by its id (e.g. its hostname) or,
+// as in older configurations, by its ip address.
 type Nodes map[string]Node
 
 type Config struct {
 	NodeGroup Nodes `json:"nodes"`
 }
 
+// Find returns the node with id, or else the node whose entry, interfaces or
+// self address match addr.
+func (c Config) Find(id string, addr string) (Node, bool) {
+
+	if id != "" {
+		if node, exists := c.NodeGroup[id]; exists {
+			return node, true
+		}
+	}
+
+	if node, exists := c.NodeGroup[addr]; exists {
+		return node, true
+	} // keyed by ip address
+
+	for _, node := range c.NodeGroup {
+
+		if slices.Contains(node.Addresses, addr) {
+			return node, true
+		}
+
+		if host, _, err := net.SplitHostPort(node.SelfIp); err == nil && host == addr {
+			return node, true
+		}
+	}
+
+	return Node{}, false
+}
+
+// RendezvousPoints returns the rendezvous nodes of the configuration, the
+// preferred first.
+func (c Config) RendezvousPoints() []Rendezvous {
+
+	points := make([]Rendezvous, 0)
+	for _, v := range c.NodeGroup {
+		if v.Type == RendezvousPoint {
+			points = append(points, Rendezvous{Address: v.SelfIp, Priority: v.Priority})
+		}
+	}
+
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].Priority == points[j].Priority {
+			return points[i].Address < points[j].Address
+		}
+		return points[i].Priority < points[j].Priority
+	})
+
+	return points
+}
+
 func ValidateConfig(c Config) bool {
 
 	for _, v := range c.NodeGroup {
 		if !(v.Type == Client || v.Type == Server || v.Type == RendezvousPoint || v.Type == ONode) {
 			return false
 		}
+		if v.Priority < 0 {
+			return false
+		}
+		if v.Ports != nil && !v.Ports.Valid() {
+			return false
+		}
 	}
 	return true
 }
@@ -0,0 +1,136 @@
+package bootstrap
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+
+	config := Config{NodeGroup: Nodes{
+		"O1": {
+			Type:      ONode,
+			SelfIp:    "10.0.1.2:7002",
+			Addresses: []string{"10.0.1.2", "10.0.2.1"},
+		},
+		"10.0.4.2": {
+			Type:   ONode,
+			SelfIp: "10.0.4.2:7000",
+		},
+		"RP": {
+			Type:   RendezvousPoint,
+			SelfIp: "10.0.6.1:7001",
+		},
+	}}
+
+	cases := []struct {
+		id   string
+		addr string
+		self string
+	}{
+		{"O1", "10.0.9.9", "10.0.1.2:7002"}, // by id, whatever the address
+		{"", "10.0.2.1", "10.0.1.2:7002"},   // by one of the interfaces
+		{"O2", "10.0.4.2", "10.0.4.2:7000"}, // unknown id, keyed by ip
+		{"", "10.0.6.1", "10.0.6.1:7001"},   // by the self address
+	}
+
+	for _, c := range cases {
+		node, exists := config.Find(c.id, c.addr)
+		if !exists || node.SelfIp != c.self {
+			t.Fatalf("Expected '%v' for ('%v', '%v'), but got '%v' (found: %v)", c.self, c.id, c.addr, node.SelfIp, exists)
+		}
+	}
+
+	if _, exists := config.Find("O3", "10.0.9.9"); exists {
+		t.Fatalf("Expected no node for ('O3', '10.0.9.9'), but got one")
+	}
+}
+
+func TestRendezvousPoints(t *testing.T) {
+
+	config := Config{NodeGroup: Nodes{
+		"RP2": {Type: RendezvousPoint, SelfIp: "10.0.7.1:7001", Priority: 1},
+		"RP3": {Type: RendezvousPoint, SelfIp: "10.0.5.1:7001", Priority: 1},
+		"RP1": {Type: RendezvousPoint, SelfIp: "10.0.6.1:7001", Priority: 0},
+		"O1":  {Type: ONode, SelfIp: "10.0.1.2:7002"},
+	}}
+
+	points := config.RendezvousPoints()
+
+	expected := []Rendezvous{
+		{Address: "10.0.6.1:7001", Priority: 0},
+		{Address: "10.0.5.1:7001", Priority: 1}, // ties sorted by address
+		{Address: "10.0.7.1:7001", Priority: 1},
+	}
+
+	if len(points) != len(expected) {
+		t.Fatalf("Expected %v, but got %v", expected, points)
+	}
+
+	for i := range expected {
+		if points[i] != expected[i] {
+			t.Fatalf("Expected %v, but got %v", expected, points)
+		}
+	}
+}
+
+func TestRole(t *testing.T) {
+
+	node := Node{
+		SelfIp:     "10.0.1.2:7002",
+		Neighbours: []netip.AddrPort{netip.MustParseAddrPort("10.0.2.2:7000")},
+		Priority:   2,
+		Rendezvous: []Rendezvous{{Address: "10.0.6.1:7001"}},
+		Servers:    []string{"10.0.8.2:5000"},
+		Ports:      &PortRange{First: 9000, Last: 9100},
+		Catalog:    "catalog.json",
+	}
+
+	tests := []struct {
+		nodeType NodeType
+		check    func(Node) bool
+	}{
+		{Client, func(r Node) bool {
+			return len(r.Neighbours) == 1 && r.Rendezvous == nil && r.Servers == nil && r.Ports == nil && r.Catalog == ""
+		}},
+		{Server, func(r Node) bool {
+			return r.Catalog == "catalog.json" && len(r.Rendezvous) == 1 && r.Neighbours == nil && r.Servers == nil && r.Ports == nil && r.Priority == 0
+		}},
+		{RendezvousPoint, func(r Node) bool {
+			return r.Priority == 2 && len(r.Servers) == 1 && r.Ports != nil && r.Neighbours == nil && r.Catalog == ""
+		}},
+		{ONode, func(r Node) bool {
+			return len(r.Neighbours) == 1 && len(r.Rendezvous) == 1 && r.Ports != nil && r.Servers == nil && r.Catalog == ""
+		}},
+	}
+
+	for _, tt := range tests {
+
+		node.Type = tt.nodeType
+		role := node.Role()
+
+		if role.Type != tt.nodeType || role.SelfIp != node.SelfIp || !tt.check(role) {
+			t.Fatalf("Expected only the settings of a '%v', but got %+v", tt.nodeType, role)
+		}
+	}
+}
+
+func TestPortRangeValid(t *testing.T) {
+
+	tests := []struct {
+		ports PortRange
+		valid bool
+	}{
+		{PortRange{First: 9000, Last: 9100}, true},
+		{PortRange{First: 9000, Last: 9000}, true}, // a single port
+		{PortRange{First: 9000}, true},             // no upper bound
+		{PortRange{First: 9100, Last: 9000}, false},
+		{PortRange{Last: 9000}, false},
+	}
+
+	for _, tt := range tests {
+		if tt.ports.Valid() != tt.valid {
+			t.Fatalf("Expected %+v to be valid=%v, but got %v", tt.ports, tt.valid, !tt.valid)
+		}
+	}
+}
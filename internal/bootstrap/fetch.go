@@ -0,0 +1,65 @@
+package bootstrap
+
+import (
+	"errors"
+	"net"
+	"os"
+
+	"github.com/gweebg/mcast/internal/packets"
+)
+
+// Request asks the bootstrapper for the configuration of the node with id, or of
+// the node it comes from when id is empty, see Bootstrap.GetNode.
+func Request(id string) packets.BasePacket[string] {
+	return packets.BasePacket[string]{
+		Header: packets.PacketHeader{
+			Flag: GET,
+		},
+		Payload: id,
+	}
+}
+
+// DefaultId is the id a node identifies itself with by default, its hostname.
+func DefaultId() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	} // identified by address instead
+	return hostname
+}
+
+// Fetch asks the bootstrapper at bootstrapAddr for the configuration of the node
+// with id, which holds its role and the settings of that role, see Node.Role.
+func Fetch(bootstrapAddr string, id string) (Node, error) {
+
+	conn, err := net.Dial("tcp", bootstrapAddr)
+	if err != nil {
+		return Node{}, err
+	}
+	defer conn.Close()
+
+	p, err := packets.Encode[string](Request(id))
+	if err != nil {
+		return Node{}, err
+	}
+
+	if err = packets.Send(conn, p); err != nil {
+		return Node{}, err
+	}
+
+	data, err := packets.NewReceiver(conn).Receive()
+	if err != nil {
+		return Node{}, err
+	}
+
+	response, err := packets.Decode[Node](data)
+	if err != nil {
+		return Node{}, err
+	}
+
+	if response.Header.Flag.OnlyHasFlag(SEND) {
+		return response.Payload, nil
+	}
+
+	return Node{}, errors.New("expected flag SEND from bootstrapper, but received another")
+}
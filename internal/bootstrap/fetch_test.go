@@ -0,0 +1,49 @@
+package bootstrap
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// TestFetchLargeConfig fetches a configuration larger than a single read of the socket.
+func TestFetchLargeConfig(t *testing.T) {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("Expected to listen on loopback, but got %v", err)
+	}
+	address := l.Addr().String()
+	_ = l.Close()
+
+	neighbours := make([]netip.AddrPort, 0, 1000)
+	for i := 0; i < cap(neighbours); i++ {
+		neighbours = append(neighbours, netip.AddrPortFrom(netip.AddrFrom4([4]byte{10, byte(i >> 8), byte(i), 1}), 7000))
+	}
+
+	b := &Bootstrap{
+		Address: address,
+		Config: Config{NodeGroup: Nodes{
+			"node": {Type: ONode, SelfIp: "10.0.0.1:7000", Neighbours: neighbours},
+		}},
+	}
+	go b.Listen()
+
+	var self Node
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		self, err = Fetch(address, "node")
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the configuration of 'node', but got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(self.Neighbours) != len(neighbours) {
+		t.Fatalf("Expected %d neighbours, but got %d", len(neighbours), len(self.Neighbours))
+	}
+}
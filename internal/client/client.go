@@ -0,0 +1,206 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/gweebg/mcast/internal/abr"
+	"github.com/gweebg/mcast/internal/node"
+	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/utils"
+)
+
+// AttachTimeout bounds the connection attempt to each neighbour in Attach.
+const AttachTimeout = 2 * time.Second
+
+// Attach returns the first of neighbours that accepts a connection, the client
+// joins the overlay through it.
+func Attach(neighbours []netip.AddrPort) (string, error) {
+
+	for _, neighbour := range neighbours {
+
+		conn, err := net.DialTimeout("tcp", neighbour.String(), AttachTimeout)
+		if err != nil {
+			log.Printf("cannot attach to neighbour '%v'\n", neighbour)
+			continue
+		}
+
+		_ = conn.Close()
+		return neighbour.String(), nil
+	}
+
+	return "", errors.New("no neighbour to attach to")
+}
+
+// Play discovers content through neighbour and plays it, in the preferred rendition
+// or adapting between the comma separated renditions of ladder when given.
+func Play(neighbour string, content string, rendition string, ladder string) {
+
+	clientUuid := uuid.New()
+	log.Printf("created client id %v\n", clientUuid)
+
+	if ladder != "" {
+		// the session starts at rendition, or at the top of the ladder when it is not in it
+		session := abr.NewSession(neighbour, clientUuid, content, strings.Split(ladder, ","), rendition)
+
+		port, err := request(neighbour, clientUuid, content, session.Rendition())
+		if err != nil {
+			log.Printf("cannot stream '%v': %v\n", content, err)
+			return
+		}
+		log.Printf("content '%v' is streaming at '%v'\n", content, port)
+
+		go leaveOnSignal(session)
+
+		session.Play(port)
+		return
+	} // adaptive playback, switching between the renditions of the ladder
+
+	port, err := request(neighbour, clientUuid, content, rendition)
+	if err != nil {
+		log.Printf("cannot stream '%v': %v\n", content, err)
+		return
+	}
+
+	log.Printf("content '%v' is streaming at '%v'\n", content, port)
+
+	// keep the stream coming while playing, and stop it once done
+	subscription := node.Subscribe(neighbour, clientUuid, content, rendition)
+	go leaveOnSignal(subscription)
+
+	utils.ListenStream(port)
+	subscription.Leave()
+
+}
+
+// request discovers content through neighbour and asks for its stream, returning
+// the address the stream is sent to.
+func request(neighbour string, clientUuid uuid.UUID, content string, rendition string) (string, error) {
+
+	// discovery phase - send discovery packet, get response, check if found or not
+
+	conn := utils.SetupConnection("tcp", neighbour)
+	defer utils.CloseConnection(conn, neighbour)
+
+	recv := packets.NewReceiver(conn)
+	log.Printf("connected with neighbout '%v' via tcp\n", neighbour)
+
+	packet, err := packets.Discovery(clientUuid, content, rendition).Encode()
+	utils.Check(err)
+
+	resultBytes, err := utils.SendAndWait(packet, conn, recv)
+	if err != nil {
+		return "", errors.New("no response for discovery request, " + err.Error())
+	}
+	log.Printf("received response for discovery request, decoding...\n")
+
+	result, err := packets.DecodePacket(resultBytes)
+	if err != nil {
+		return "", errors.New("malformed response for discovery request, " + err.Error())
+	}
+
+	if result.Header.Flags != packets.FOUND {
+		return "", errors.New("content '" + content + "' is not available in the network")
+	}
+
+	log.Printf("content '%v' is available on the network, initiating stream request\n", content)
+
+	// stream phase - send stream request, wait for port to listen to
+
+	packet, err = packets.Stream(clientUuid, content, rendition).Encode()
+	utils.Check(err)
+
+	resultBytes, err = utils.SendAndWait(packet, conn, recv)
+	if err != nil {
+		return "", errors.New("no response for stream request, " + err.Error())
+	}
+	log.Printf("received response from stream request, decoding...\n")
+
+	result, err = packets.DecodePacket(resultBytes)
+	if err != nil {
+		return "", errors.New("malformed response for stream request, " + err.Error())
+	}
+
+	if result.Header.Flags != packets.PORT {
+		return "", errors.New("did not receive 'PORT' packet")
+	}
+
+	return result.Payload.Port, nil
+}
+
+// leaveOnSignal ends the subscription once the client is interrupted, so that the
+// stream is not kept running for no one.
+func leaveOnSignal(subscription interface{ Leave() }) {
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	sig := <-stop
+	log.Printf("received %v, leaving the stream\n", sig)
+
+	subscription.Leave()
+	os.Exit(0)
+}
+
+// ListCatalog asks the network for its catalog through neighbour and prints the
+// entries matching pattern and minResolution (WIDTHxHEIGHT), both optional.
+func ListCatalog(neighbour string, pattern string, minResolution string) {
+
+	query := packets.CatalogQuery{Pattern: pattern}
+
+	if minResolution != "" {
+		width, height, found := strings.Cut(minResolution, "x")
+		w, errW := strconv.ParseUint(width, 10, 64)
+		h, errH := strconv.ParseUint(height, 10, 64)
+		if !found || errW != nil || errH != nil {
+			log.Fatalf("invalid minimum resolution '%v', expected WIDTHxHEIGHT\n", minResolution)
+		}
+		query.MinWidth, query.MinHeight = uint(w), uint(h)
+	}
+
+	conn := utils.SetupConnection("tcp", neighbour)
+	defer utils.CloseConnection(conn, neighbour)
+
+	packet, err := packets.List(uuid.New(), query).Encode()
+	utils.Check(err)
+
+	resultBytes, err := utils.SendAndWait(packet, conn, packets.NewReceiver(conn))
+	if err != nil {
+		log.Printf("no response for catalog request: %v\n", err)
+		return
+	}
+
+	result, err := packets.DecodePacket(resultBytes)
+	if err != nil {
+		log.Printf("malformed response for catalog request: %v\n", err)
+		return
+	}
+
+	if result.Header.Flags != packets.LIST {
+		log.Printf("the catalog is not available in the network\n")
+		return
+	}
+
+	if len(result.Payload.Catalog) == 0 {
+		fmt.Println("no content found")
+		return
+	}
+
+	for _, entry := range result.Payload.Catalog {
+		fmt.Printf("%v (%dx%d@%d)\n", entry.Name, entry.Width, entry.Height, entry.FPS)
+		for _, r := range entry.Renditions {
+			fmt.Printf("  %v (%dx%d@%d)\n", r.Name, r.Width, r.Height, r.FPS)
+		}
+	}
+}
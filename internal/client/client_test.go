@@ -0,0 +1,231 @@
+package client
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/gweebg/mcast/internal/bootstrap"
+	"github.com/gweebg/mcast/internal/node"
+	"github.com/gweebg/mcast/internal/rendezvous"
+	"github.com/gweebg/mcast/internal/server"
+	"github.com/gweebg/mcast/internal/streamer"
+	"github.com/gweebg/mcast/internal/ts"
+)
+
+// setupTimeout bounds how long the overlay takes to come up in the tests.
+const setupTimeout = 5 * time.Second
+
+// freePort returns a port that is free for both tcp and udp on host.
+func freePort(t *testing.T, host string) uint16 {
+
+	for attempt := 0; attempt < 10; attempt++ {
+
+		l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+		if err != nil {
+			t.Skipf("Expected to listen at '%v', but got %v", host, err)
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+
+		u, err := net.ListenPacket("udp", net.JoinHostPort(host, strconv.Itoa(port)))
+		_ = l.Close()
+		if err != nil {
+			continue
+		} // taken for udp, try another one
+		_ = u.Close()
+
+		return uint16(port)
+	}
+
+	t.Fatalf("Expected a free port at '%v', but got none", host)
+	return 0
+}
+
+// freeRange returns the first and last of size consecutive ports free for udp on host.
+func freeRange(t *testing.T, host string, size int) (uint64, uint64) {
+
+	for attempt := 0; attempt < 10; attempt++ {
+
+		first := int(freePort(t, host))
+
+		conns := make([]net.PacketConn, 0, size)
+		for port := first; port < first+size; port++ {
+			conn, err := net.ListenPacket("udp", net.JoinHostPort(host, strconv.Itoa(port)))
+			if err != nil {
+				break
+			}
+			conns = append(conns, conn)
+		}
+
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+
+		if len(conns) == size {
+			return uint64(first), uint64(first + size - 1)
+		}
+	}
+
+	t.Fatalf("Expected %d free ports at '%v', but got none", size, host)
+	return 0, 0
+}
+
+// waitFor polls done until it holds, failing the test after setupTimeout.
+func waitFor(t *testing.T, what string, done func() bool) {
+
+	deadline := time.Now().Add(setupTimeout)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %v within %v, but it did not happen", what, setupTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// fetch asks the bootstrapper for the configuration of id, retrying until it is listening.
+func fetch(t *testing.T, bootstrapAddr string, id string) bootstrap.Node {
+
+	var self bootstrap.Node
+	waitFor(t, "the bootstrapper to answer for '"+id+"'", func() bool {
+		var err error
+		self, err = bootstrap.Fetch(bootstrapAddr, id)
+		return err == nil
+	})
+
+	return self
+}
+
+// TestEndToEnd streams the test pattern from a server to a client through a node and a
+// rendezvous point, every one of them configured by a bootstrapper, all over loopback.
+// Nodes tell their neighbours apart by address, so the rendezvous point has its own.
+func TestEndToEnd(t *testing.T) {
+
+	const content = "pattern"
+
+	serverAddr := netip.AddrPortFrom(netip.MustParseAddr("127.0.0.1"), freePort(t, "127.0.0.1"))
+	rendezvousAddr := netip.AddrPortFrom(netip.MustParseAddr("127.0.0.2"), freePort(t, "127.0.0.2"))
+	nodeAddr := netip.AddrPortFrom(netip.MustParseAddr("127.0.0.1"), freePort(t, "127.0.0.1"))
+	bootstrapAddr := netip.AddrPortFrom(netip.MustParseAddr("127.0.0.1"), freePort(t, "127.0.0.1"))
+
+	// the server streams to the relay of the rendezvous point, which forwards to the
+	// relay of the node, which forwards to the client, each relay receiving and
+	// forwarding at ports of its own
+	rendezvousFirst, rendezvousLast := freeRange(t, "127.0.0.1", 2)
+	nodeFirst, nodeLast := freeRange(t, "127.0.0.1", 2)
+
+	catalog := filepath.Join(t.TempDir(), "server_config.json")
+	config := `{"content": [{"name": "` + content + `", "source": "generator", "generator": "` + streamer.TestPatternName + `"}]}`
+	if err := os.WriteFile(catalog, []byte(config), 0o644); err != nil {
+		t.Fatalf("Expected the server configuration to be written, but got %v", err)
+	}
+
+	b := &bootstrap.Bootstrap{
+		Address: bootstrapAddr.String(),
+		Config: bootstrap.Config{NodeGroup: bootstrap.Nodes{
+			"server": {
+				Type:    bootstrap.Server,
+				SelfIp:  serverAddr.String(),
+				Catalog: catalog,
+			},
+			"rendezvous": {
+				Type:    bootstrap.RendezvousPoint,
+				SelfIp:  rendezvousAddr.String(),
+				Servers: []string{serverAddr.String()},
+				Ports:   &bootstrap.PortRange{First: rendezvousFirst, Last: rendezvousLast},
+			},
+			"node": {
+				Type:       bootstrap.ONode,
+				SelfIp:     nodeAddr.String(),
+				Neighbours: []netip.AddrPort{rendezvousAddr},
+				Ports:      &bootstrap.PortRange{First: nodeFirst, Last: nodeLast},
+			},
+			"client": {
+				Type:       bootstrap.Client,
+				Neighbours: []netip.AddrPort{nodeAddr},
+			},
+		}},
+	}
+	go b.Listen()
+
+	self := fetch(t, b.Address, "server")
+	srv := server.New(self.SelfIp, self.Catalog)
+	go srv.Run()
+
+	self = fetch(t, b.Address, "rendezvous")
+	rend := rendezvous.NewWithSelf(self)
+	go rend.Run()
+
+	self = fetch(t, b.Address, "node")
+	n := node.NewWithSelf(self)
+	go n.Run()
+
+	waitFor(t, "the rendezvous point to know the content of the server", func() bool {
+		return rend.ContentExists(content)
+	})
+
+	self = fetch(t, b.Address, "client")
+
+	var neighbour string
+	waitFor(t, "the client to attach to the node", func() bool {
+		var err error
+		neighbour, err = Attach(self.Neighbours)
+		return err == nil
+	})
+
+	port, err := request(neighbour, uuid.New(), content, "")
+	if err != nil {
+		t.Fatalf("Expected the stream of '%v', but got %v", content, err)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", port)
+	if err != nil {
+		t.Fatalf("Expected a valid stream address, but got '%v'", port)
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatalf("Expected to listen to the stream at '%v', but got %v", port, err)
+	}
+	defer conn.Close()
+
+	// receive until a few frames, each carrying a pcr, went through
+	received, frames := 0, 0
+	buffer := make([]byte, 64*1024)
+
+	_ = conn.SetReadDeadline(time.Now().Add(setupTimeout))
+	for frames < 5 {
+
+		size, _, err := conn.ReadFromUDP(buffer)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			t.Fatalf("Expected the test pattern to be streamed, but got %d packets and %d frames", received, frames)
+		}
+		if err != nil {
+			t.Fatalf("Expected to read the stream, but got %v", err)
+		}
+
+		if size%ts.PacketSize != 0 {
+			t.Fatalf("Expected whole transport stream packets, but got %d bytes", size)
+		}
+
+		for offset := 0; offset < size; offset += ts.PacketSize {
+
+			packet, err := ts.Parse(buffer[offset : offset+ts.PacketSize])
+			if err != nil {
+				t.Fatalf("Expected a valid transport stream packet, but got %v", err)
+			}
+
+			received++
+			if packet.HasPCR() {
+				frames++
+			}
+		}
+	}
+}
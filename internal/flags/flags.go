@@ -1,6 +1,6 @@
 package flags
 
-type FlagType uint8
+type FlagType uint16
 
 func (flags *FlagType) CheckFlag(f FlagType) bool {
 	return *flags&f != 0
@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWindow is the number of probes the loss is computed over.
+	DefaultWindow = 20
+	// DefaultHistory is the number of samples kept in the history.
+	DefaultHistory = 120
+
+	// weight of a new round trip time in the smoothed one, as in RFC 6298.
+	rttWeight = 0.125
+	// gain of the interarrival jitter estimator, as in RFC 3550.
+	jitterGain = 1.0 / 16
+)
+
+// Sample is the outcome of a single probe.
+type Sample struct {
+	// Seq is the sequence number of the probe.
+	Seq uint64
+	// Sent is when the probe was sent.
+	Sent time.Time
+	// RTT is the round trip time of the probe, 0 if it was lost.
+	RTT time.Duration
+	// Lost is set when no answer arrived for the probe.
+	Lost bool
+}
+
+// Stats summarises the samples observed so far.
+type Stats struct {
+	// RTT is the smoothed round trip time.
+	RTT time.Duration
+	// Jitter is the interarrival jitter of the round trip times, see RFC 3550 section 6.4.1.
+	Jitter time.Duration
+	// Loss is the ratio of lost probes in the sliding window, from 0 to 1.
+	Loss float64
+	// Samples is the number of probes accounted for.
+	Samples uint64
+}
+
+// Estimator computes the round trip time, jitter and loss of a path from the
+// outcome of timestamped, sequenced probes.
+type Estimator struct {
+	// Window is the number of probes the loss is computed over.
+	Window int
+
+	srtt    float64 // smoothed round trip time, in nanoseconds
+	jitter  float64 // in nanoseconds
+	lastRtt float64 // previous round trip time, 0 if none
+
+	window  []bool // outcome of the last probes, true if lost
+	history []Sample
+	limit   int
+	samples uint64
+
+	mu sync.RWMutex
+}
+
+// NewEstimator creates an Estimator that computes the loss over window probes
+// and keeps the last history samples.
+func NewEstimator(window int, history int) *Estimator {
+	return &Estimator{
+		Window: window,
+		limit:  history,
+	}
+}
+
+// Received accounts for a probe that was answered after rtt.
+func (e *Estimator) Received(seq uint64, sent time.Time, rtt time.Duration) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sample := float64(rtt)
+
+	if e.srtt == 0 {
+		e.srtt = sample
+	} else {
+		e.srtt = (1-rttWeight)*e.srtt + rttWeight*sample
+	}
+
+	if e.lastRtt != 0 {
+		d := sample - e.lastRtt // difference in transit times between consecutive probes
+		if d < 0 {
+			d = -d
+		}
+		e.jitter += (d - e.jitter) * jitterGain
+	}
+	e.lastRtt = sample
+
+	e.record(Sample{Seq: seq, Sent: sent, RTT: rtt})
+}
+
+// Lost accounts for a probe that was never answered.
+func (e *Estimator) Lost(seq uint64, sent time.Time) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.record(Sample{Seq: seq, Sent: sent, Lost: true})
+}
+
+// record adds sample to the loss window and to the history.
+func (e *Estimator) record(sample Sample) {
+
+	e.samples++
+
+	e.window = append(e.window, sample.Lost)
+	if len(e.window) > e.Window {
+		e.window = e.window[len(e.window)-e.Window:]
+	}
+
+	e.history = append(e.history, sample)
+	if len(e.history) > e.limit {
+		e.history = e.history[len(e.history)-e.limit:]
+	}
+}
+
+// Stats returns the current estimates.
+func (e *Estimator) Stats() Stats {
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	stats := Stats{
+		RTT:     time.Duration(e.srtt),
+		Jitter:  time.Duration(e.jitter),
+		Samples: e.samples,
+	}
+
+	lost := 0
+	for _, l := range e.window {
+		if l {
+			lost++
+		}
+	}
+	if len(e.window) > 0 {
+		stats.Loss = float64(lost) / float64(len(e.window))
+	}
+
+	return stats
+}
+
+// History returns the samples recorded since since, oldest first.
+func (e *Estimator) History(since time.Time) []Sample {
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	samples := make([]Sample, 0)
+	for _, s := range e.history {
+		if !s.Sent.Before(since) {
+			samples = append(samples, s)
+		}
+	}
+
+	return samples
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimatorRTT(t *testing.T) {
+
+	e := NewEstimator(DefaultWindow, DefaultHistory)
+	start := time.Now()
+
+	for i := 0; i < 10; i++ {
+		e.Received(uint64(i), start, 10*time.Millisecond)
+	}
+
+	stats := e.Stats()
+	if stats.RTT != 10*time.Millisecond {
+		t.Fatalf("Expected rtt %v, but got %v", 10*time.Millisecond, stats.RTT)
+	}
+	if stats.Jitter != 0 {
+		t.Fatalf("Expected no jitter, but got %v", stats.Jitter)
+	}
+}
+
+func TestEstimatorJitter(t *testing.T) {
+
+	e := NewEstimator(DefaultWindow, DefaultHistory)
+	start := time.Now()
+
+	e.Received(0, start, 10*time.Millisecond)
+	e.Received(1, start, 26*time.Millisecond)
+
+	// |26 - 10| / 16 = 1ms
+	if jitter := e.Stats().Jitter; jitter != time.Millisecond {
+		t.Fatalf("Expected jitter %v, but got %v", time.Millisecond, jitter)
+	}
+}
+
+func TestEstimatorLoss(t *testing.T) {
+
+	e := NewEstimator(4, DefaultHistory)
+	start := time.Now()
+
+	e.Lost(0, start)
+	e.Lost(1, start)
+	e.Received(2, start, time.Millisecond)
+	e.Received(3, start, time.Millisecond)
+
+	if loss := e.Stats().Loss; loss != 0.5 {
+		t.Fatalf("Expected loss 0.5, but got %v", loss)
+	}
+
+	e.Received(4, start, time.Millisecond) // the first loss leaves the window
+
+	if loss := e.Stats().Loss; loss != 0.25 {
+		t.Fatalf("Expected loss 0.25, but got %v", loss)
+	}
+}
+
+func TestEstimatorHistory(t *testing.T) {
+
+	e := NewEstimator(DefaultWindow, 3)
+	start := time.Now()
+
+	for i := 0; i < 5; i++ {
+		e.Received(uint64(i), start.Add(time.Duration(i)*time.Second), time.Millisecond)
+	}
+
+	history := e.History(time.Time{})
+	if len(history) != 3 || history[0].Seq != 2 {
+		t.Fatalf("Expected the last 3 samples, but got %v", history)
+	}
+
+	if recent := e.History(start.Add(4 * time.Second)); len(recent) != 1 {
+		t.Fatalf("Expected 1 sample, but got %d", len(recent))
+	}
+}
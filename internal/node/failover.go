@@ -0,0 +1,187 @@
+package node
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gweebg/mcast/internal/packets"
+)
+
+const (
+	// PreferenceWindow is how long discovery waits, after the first 'FOUND', for
+	// answers from rendezvous points with a higher priority.
+	PreferenceWindow = 200 * time.Millisecond
+	// RendezvousIdleTimeout is how long a relay can go without receiving data before
+	// its rendezvous point is checked, longer than the rendezvous' own server failover.
+	RendezvousIdleTimeout = 20 * time.Second
+	// ReachTimeout bounds the connection attempt when checking a rendezvous point.
+	ReachTimeout = 2 * time.Second
+	// relayWatchInterval is how often the relays are checked for idleness.
+	relayWatchInterval = time.Second
+)
+
+// Priority returns the priority of the rendezvous point at address, as given by
+// the bootstrapper. Unknown rendezvous points come last.
+func (n *Node) Priority(address string) int {
+	for _, point := range n.Self.Rendezvous {
+		if point.Address == address {
+			return point.Priority
+		}
+	}
+	return math.MaxInt
+}
+
+// prefer picks, among the 'FOUND' answers, the one leading to the rendezvous point
+// with the highest priority, the first to arrive on ties. Answers leading to avoid
+// are skipped.
+func (n *Node) prefer(responses []packets.Packet, avoid string) (packets.Packet, bool) {
+
+	var best packets.Packet
+	found := false
+
+	for _, resp := range responses {
+
+		if avoid != "" && resp.Payload.Rendezvous == avoid {
+			continue
+		}
+
+		if !found || n.Priority(resp.Payload.Rendezvous) < n.Priority(best.Payload.Rendezvous) {
+			best, found = resp, true
+		}
+	}
+
+	return best, found
+}
+
+// rediscover looks for contentName through the neighbours, except ignore, under a new
+// request id, avoiding the rendezvous point at avoid. Returns the request id the
+// path was discovered with and the route to follow.
+func (n *Node) rediscover(contentName string, rendition string, avoid string, ignore ...netip.AddrPort) (uuid.UUID, Route, error) {
+
+	requestId := uuid.New()
+	n.Requests.Set(requestId, true) // our own request, in case it comes back around
+
+	responses := n.Flooder.Discover(packets.Discovery(requestId, contentName, rendition), PreferenceWindow, ignore...)
+
+	best, found := n.prefer(responses, avoid)
+	if !found {
+		return requestId, Route{}, errors.New("no other rendezvous point can provide '" + contentName + "'")
+	}
+
+	route := Route{Source: best.Header.Source, Rendezvous: best.Payload.Rendezvous}
+	n.SetPositive(requestId, route)
+
+	return requestId, route, nil
+}
+
+// watchRelays reroutes the relays that stopped receiving data because the
+// rendezvous point they are fed by is unreachable.
+func (n *Node) watchRelays() {
+
+	ticker := time.NewTicker(relayWatchInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+
+		n.rMu.RLock()
+		idle := make([]string, 0)
+		for contentKey, relay := range n.RelayPool {
+
+			route := n.routes[contentKey]
+			if route.Source != route.Rendezvous {
+				continue
+			} // only the node next to the rendezvous point reroutes, the others follow
+
+			if relay.Idle() > RendezvousIdleTimeout {
+				idle = append(idle, contentKey)
+			}
+		}
+		n.rMu.RUnlock()
+
+		for _, contentKey := range idle {
+			go n.Reroute(contentKey)
+		}
+	}
+}
+
+// Reroute makes the relay for contentKey receive the stream through another rendezvous
+// point if the current one is unreachable. The relay keeps its addresses, so the
+// nodes downstream keep receiving from it. Attempts are spaced by RendezvousIdleTimeout.
+func (n *Node) Reroute(contentKey string) {
+
+	n.fMu.Lock()
+	if last, exists := n.rerouted[contentKey]; exists && time.Since(last) < RendezvousIdleTimeout {
+		n.fMu.Unlock()
+		return
+	} // already rerouting, or did it recently
+	n.rerouted[contentKey] = time.Now()
+	n.fMu.Unlock()
+
+	n.rMu.RLock()
+	relay, exists := n.RelayPool[contentKey]
+	route := n.routes[contentKey]
+	n.rMu.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	if reachable(route.Rendezvous) {
+		return
+	} // the rendezvous point is replacing its server
+
+	log.Printf("(reroute) rendezvous '%v' of '%v' is unreachable\n", route.Rendezvous, contentKey)
+
+	ignore := make([]netip.AddrPort, 0)
+	for _, addr := range relay.Destinations() {
+		ignore = append(ignore, netip.AddrPortFrom(addr.AddrPort().Addr().Unmap(), 0))
+	} // the nodes we relay to would answer with our own stream
+
+	if failed, err := netip.ParseAddrPort(route.Rendezvous); err == nil {
+		ignore = append(ignore, failed)
+	}
+
+	contentName, rendition := packets.SplitContentKey(contentKey)
+
+	requestId, next, err := n.rediscover(contentName, rendition, route.Rendezvous, ignore...)
+	if err != nil {
+		log.Printf("(reroute) %v\n", err)
+		return
+	}
+
+	response, err := follow(receivingAt(packets.Stream(requestId, contentName, rendition), portOf(relay.Origin)), next.Source)
+	if err != nil || !response.Header.Flags.OnlyHasFlag(packets.PORT) {
+		log.Printf("(reroute) '%v' did not stream '%v'\n", next.Source, contentKey)
+		return
+	}
+
+	if err := relay.Repoint(response.Payload.Port); err != nil {
+		log.Printf("(reroute) cannot repoint relay of '%v': %v\n", contentKey, err)
+		return
+	}
+
+	next.RequestId = requestId
+
+	n.rMu.Lock()
+	n.routes[contentKey] = next
+	n.rMu.Unlock()
+
+	log.Printf("(reroute) '%v' now received through rendezvous '%v'\n", contentKey, next.Rendezvous)
+}
+
+// reachable checks whether a tcp connection can be made to address.
+func reachable(address string) bool {
+
+	conn, err := net.DialTimeout("tcp", address, ReachTimeout)
+	if err != nil {
+		return false
+	}
+
+	_ = conn.Close()
+	return true
+}
@@ -0,0 +1,123 @@
+package node
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gweebg/mcast/internal/bootstrap"
+	"github.com/gweebg/mcast/internal/packets"
+)
+
+func found(rendezvous string) packets.Packet {
+	return packets.Found(uuid.Nil, "video.mp4", "10.0.0.1:7000", rendezvous)
+}
+
+func TestPrefer(t *testing.T) {
+
+	n := &Node{Self: bootstrap.Node{Rendezvous: []bootstrap.Rendezvous{
+		{Address: "10.0.0.10:7000", Priority: 0},
+		{Address: "10.0.0.11:7000", Priority: 1},
+		{Address: "10.0.0.12:7000", Priority: 1},
+	}}}
+
+	tests := []struct {
+		name      string
+		responses []string
+		avoid     string
+		expected  string
+		found     bool
+	}{
+		{"highest priority", []string{"10.0.0.11:7000", "10.0.0.10:7000"}, "", "10.0.0.10:7000", true},
+		{"first on ties", []string{"10.0.0.12:7000", "10.0.0.11:7000"}, "", "10.0.0.12:7000", true},
+		{"avoided", []string{"10.0.0.10:7000", "10.0.0.11:7000"}, "10.0.0.10:7000", "10.0.0.11:7000", true},
+		{"unknown last", []string{"10.0.0.99:7000", "10.0.0.12:7000"}, "", "10.0.0.12:7000", true},
+		{"only unknown", []string{"10.0.0.99:7000"}, "", "10.0.0.99:7000", true},
+		{"only avoided", []string{"10.0.0.10:7000"}, "10.0.0.10:7000", "", false},
+		{"none", []string{}, "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			responses := make([]packets.Packet, 0, len(tt.responses))
+			for _, rendezvous := range tt.responses {
+				responses = append(responses, found(rendezvous))
+			}
+
+			best, ok := n.prefer(responses, tt.avoid)
+			if ok != tt.found || best.Payload.Rendezvous != tt.expected {
+				t.Fatalf("Expected ('%v', %v), but got ('%v', %v)", tt.expected, tt.found, best.Payload.Rendezvous, ok)
+			}
+		})
+	}
+}
+
+// neighbour answers every packet with a 'FOUND' leading to rendezvous, after delay.
+func neighbour(t *testing.T, rendezvous string, delay time.Duration) netip.AddrPort {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected to listen on loopback, but got %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				if _, err := packets.NewReceiver(conn).Receive(); err != nil {
+					return
+				}
+
+				time.Sleep(delay)
+
+				enc, _ := found(rendezvous).Encode()
+				_ = packets.Send(conn, enc)
+			}(conn)
+		}
+	}()
+
+	return netip.MustParseAddrPort(l.Addr().String())
+}
+
+func TestDiscoverWindow(t *testing.T) {
+
+	flooder := NewFlooder([]netip.AddrPort{
+		neighbour(t, "close", 0),
+		neighbour(t, "within window", 50*time.Millisecond),
+		neighbour(t, "too late", time.Second),
+	})
+
+	start := time.Now()
+	responses := flooder.Discover(packets.Discovery(uuid.New(), "video.mp4", ""), 200*time.Millisecond)
+
+	if len(responses) != 2 || responses[0].Payload.Rendezvous != "close" || responses[1].Payload.Rendezvous != "within window" {
+		t.Fatalf("Expected the answers within the window, in order of arrival, but got %v", responses)
+	}
+
+	if elapsed := time.Since(start); elapsed > 800*time.Millisecond {
+		t.Fatalf("Expected discovery to end with the window, but it took %v", elapsed)
+	}
+}
+
+func TestDiscoverNoAnswers(t *testing.T) {
+
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := netip.MustParseAddrPort(closed.Addr().String())
+	_ = closed.Close()
+
+	flooder := NewFlooder([]netip.AddrPort{addr})
+
+	if responses := flooder.Discover(packets.Discovery(uuid.New(), "video.mp4", ""), 200*time.Millisecond); len(responses) != 0 {
+		t.Fatalf("Expected no answers, but got %v", responses)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/netip"
 	"sync"
+	"time"
 )
 
 type Flooder struct {
@@ -22,8 +23,8 @@ func NewFlooder(n []netip.AddrPort) Flooder {
 func (f Flooder) Flood(packet packets.Packet, ignore ...netip.AddrPort) (packets.Packet, bool) {
 
 	neighbours := f.Neighbours
-	if len(ignore) == 1 {
-		neighbours = filterNeighbour(ignore[0], neighbours)
+	for _, addrPort := range ignore {
+		neighbours = filterNeighbour(addrPort, neighbours)
 	}
 
 	var wg sync.WaitGroup
@@ -56,6 +57,59 @@ func (f Flooder) Flood(packet packets.Packet, ignore ...netip.AddrPort) (packets
 
 }
 
+// Discover floods the neighbours with a 'DISC' packet and returns every 'FOUND'
+// answer, in order of arrival. Once the first one arrives the others are waited
+// for at most window, so that a preferred rendezvous point further away can still
+// be chosen over the closest one.
+func (f Flooder) Discover(packet packets.Packet, window time.Duration, ignore ...netip.AddrPort) []packets.Packet {
+
+	neighbours := f.Neighbours
+	for _, addrPort := range ignore {
+		neighbours = filterNeighbour(addrPort, neighbours)
+	}
+
+	var wg sync.WaitGroup
+
+	responses := make(chan packets.Packet, len(neighbours)) // buffered, late answers are dropped
+
+	for _, neighbour := range neighbours {
+		wg.Add(1)
+		go func(dest netip.AddrPort) {
+			defer wg.Done()
+
+			resp, err := follow(packet, dest.String())
+			if err == nil && resp.Header.Flags.OnlyHasFlag(packets.FOUND) {
+				responses <- resp
+			}
+		}(neighbour)
+	}
+
+	go func() {
+		wg.Wait()
+		close(responses)
+	}() // wait until every neighbour answers
+
+	found := make([]packets.Packet, 0)
+	var deadline <-chan time.Time // nil until the first answer, blocks forever
+
+	for {
+		select {
+		case resp, ok := <-responses:
+			if !ok {
+				return found
+			}
+
+			found = append(found, resp)
+			if deadline == nil {
+				deadline = time.After(window)
+			}
+
+		case <-deadline:
+			return found
+		}
+	}
+}
+
 // sendTo, sends a packet (content) to the specified neighbour (dest)
 // once a response is received, signals the response channel and closes the done channel
 // indicating to other goroutines that a response was already received.
@@ -76,25 +130,27 @@ func (f Flooder) sendTo(dest netip.AddrPort, content packets.Packet, wg *sync.Wa
 	utils.Check(err)
 
 	// sending packet to dest
-	_, err = conn.Write(buffer)
+	err = packets.Send(conn, buffer)
 	if err != nil {
 		log.Printf("cannot write packet to '%v'\n%v", dest.String(), err.Error())
 		return
 	}
 
-	// reading and decoding the response
-	responseBuffer := make([]byte, 1024)
-	n, err := conn.Read(responseBuffer)
+	// reading and decoding the response, read whole however large the catalog it carries
+	responseBuffer, err := packets.NewReceiver(conn).Receive()
 	if err != nil {
 		log.Printf("cannot read packet from '%v'\n%v", dest.String(), err.Error())
 		return
 	}
 
-	resp, err := packets.DecodePacket(responseBuffer[:n])
-	utils.Check(err)
+	resp, err := packets.DecodePacket(responseBuffer)
+	if err != nil {
+		log.Printf("malformed packet from '%v', ignoring...\n", dest.String())
+		return
+	}
 
 	// updating response state
-	if resp.Header.Flags.OnlyHasFlag(packets.FOUND) {
+	if resp.Header.Flags.OnlyHasFlag(packets.FOUND) || resp.Header.Flags.OnlyHasFlag(packets.LIST) {
 		select {
 
 		case response <- resp:
@@ -0,0 +1,99 @@
+package node
+
+import (
+	"github.com/gweebg/mcast/internal/ts"
+)
+
+// MaxGopSize is the maximum number of bytes kept by a GopCache, once exceeded
+// the cache is dropped until the next random access point arrives.
+const MaxGopSize = 8 * 1024 * 1024
+
+// GopCache keeps the program tables and the most recent group of pictures of a
+// transport stream, starting at the last random access point, so that new
+// subscribers can start decoding right away.
+type GopCache struct {
+	demuxer *ts.Demuxer
+
+	// last PAT packet received.
+	pat []byte
+	// last PMT packet received, by PMT PID.
+	pmts map[uint16][]byte
+	// packets since the last random access point.
+	gop []byte
+	// whether gop starts at a random access point.
+	hasKeyframe bool
+}
+
+// NewGopCache creates an empty GopCache.
+func NewGopCache() *GopCache {
+	return &GopCache{
+		demuxer: ts.NewDemuxer(),
+		pmts:    make(map[uint16][]byte),
+		gop:     make([]byte, 0),
+	}
+}
+
+// Write feeds a chunk of transport stream packets into the cache.
+func (c *GopCache) Write(chunk []byte) {
+
+	for off := 0; off+ts.PacketSize <= len(chunk); off += ts.PacketSize {
+
+		pkt := chunk[off : off+ts.PacketSize]
+
+		info, err := c.demuxer.Demux(pkt)
+		if err != nil {
+			continue
+		}
+
+		if info.IsPSI {
+			if info.Packet.PayloadUnitStart {
+				c.storeTable(info.Packet.PID, pkt)
+			}
+			continue
+		} // tables are sent ahead of the gop, no need to keep them twice
+
+		if info.RandomAccess {
+			c.gop = c.gop[:0]
+			c.hasKeyframe = true
+		} // a new gop starts here
+
+		if !c.hasKeyframe {
+			continue
+		}
+
+		if len(c.gop)+ts.PacketSize > MaxGopSize {
+			c.gop = c.gop[:0]
+			c.hasKeyframe = false
+			continue
+		} // gop too big, wait for the next keyframe
+
+		c.gop = append(c.gop, pkt...)
+	}
+}
+
+func (c *GopCache) storeTable(pid uint16, pkt []byte) {
+
+	table := append([]byte{}, pkt...)
+	if pid == ts.PidPAT {
+		c.pat = table
+		return
+	}
+	c.pmts[pid] = table
+}
+
+// Burst returns the program tables followed by the cached group of pictures,
+// or nil when no random access point was received yet.
+func (c *GopCache) Burst() []byte {
+
+	if !c.hasKeyframe || c.pat == nil || len(c.pmts) == 0 {
+		return nil
+	}
+
+	burst := make([]byte, 0, len(c.pat)+len(c.pmts)*ts.PacketSize+len(c.gop))
+	burst = append(burst, c.pat...)
+	for _, pmt := range c.pmts {
+		burst = append(burst, pmt...)
+	}
+
+	return append(burst, c.gop...)
+}
@@ -0,0 +1,85 @@
+package node
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gweebg/mcast/internal/ts"
+)
+
+const (
+	testPmtPid   uint16 = 0x1000
+	testVideoPid uint16 = 0x100
+)
+
+// testStream builds the transport stream packets of a single h264 program.
+type testStream struct {
+	muxer *ts.Muxer
+	pts   uint64
+}
+
+func newTestStream() *testStream {
+	return &testStream{muxer: ts.NewMuxer()}
+}
+
+// tables returns the PAT followed by the PMT of the program.
+func (s *testStream) tables() []byte {
+	streams := []ts.ElementaryStream{{Type: ts.StreamTypeH264, PID: testVideoPid}}
+	return append(s.muxer.PAT(1, testPmtPid), s.muxer.PMT(testPmtPid, 1, testVideoPid, streams)...)
+}
+
+// frame returns the packets of a picture of size bytes, a random access point if key.
+func (s *testStream) frame(key bool, size int) []byte {
+
+	var adaptation *ts.AdaptationField
+	if key {
+		adaptation = &ts.AdaptationField{RandomAccess: true}
+	}
+
+	s.pts += ts.PtsClock / 25
+	return s.muxer.PES(testVideoPid, 0xe0, s.pts, adaptation, bytes.Repeat([]byte{0xab}, size))
+}
+
+func TestGopCache(t *testing.T) {
+
+	s := newTestStream()
+
+	tables := s.tables()
+	key, delta := s.frame(true, 1000), s.frame(false, 500)
+	nextKey := s.frame(true, 800)
+	huge := s.frame(false, MaxGopSize)
+
+	tests := []struct {
+		name   string
+		chunks [][]byte
+		burst  []byte
+	}{
+		{"empty", nil, nil},
+		{"no keyframe yet", [][]byte{tables, delta}, nil},
+		{"no tables yet", [][]byte{key, delta}, nil},
+		{"starts at the keyframe", [][]byte{tables, delta, key, delta}, concat(tables, key, delta)},
+		{"keyframe restarts the gop", [][]byte{tables, key, delta, nextKey}, concat(tables, nextKey)},
+		{"tables kept apart from the gop", [][]byte{tables, key, tables, delta}, concat(tables, key, delta)},
+		{"gop over the maximum is dropped", [][]byte{tables, key, huge}, nil},
+		{"dropped until the next keyframe", [][]byte{tables, key, huge, delta, nextKey}, concat(tables, nextKey)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			c := NewGopCache()
+			for _, chunk := range tt.chunks {
+				c.Write(chunk)
+			}
+
+			if burst := c.Burst(); !bytes.Equal(burst, tt.burst) {
+				t.Fatalf("Expected a burst of %d bytes, but got %d", len(tt.burst), len(burst))
+			}
+		})
+	}
+}
+
+// concat returns the chunks one after the other.
+func concat(chunks ...[]byte) []byte {
+	return bytes.Join(chunks, nil)
+}
@@ -23,8 +23,9 @@ func (n *Node) OnDiscovery(incoming packets.Packet, conn net.Conn) {
 	remote := conn.RemoteAddr().String()
 	requestId := incoming.Header.RequestId
 	contentName := incoming.Payload.ContentName
+	contentKey := n.resolve(incoming.Payload.Key()) // content and rendition
 
-	log.Printf("(handling %v) received 'DISC' packet for content '%v'\n", remote, contentName)
+	log.Printf("(handling %v) received 'DISC' packet for content '%v'\n", remote, contentKey)
 
 	defer func(n *Node) {
 		n.Requests.Set(requestId, true)
@@ -41,10 +42,11 @@ func (n *Node) OnDiscovery(incoming packets.Packet, conn net.Conn) {
 		return
 	} // packet was already handled
 
-	if n.IsStreaming(contentName) {
-		log.Printf("(handling %v) i am streaming the content '%v'\n", requestId, contentName)
+	if n.IsStreaming(contentKey) {
+		log.Printf("(handling %v) i am streaming the content '%v'\n", requestId, contentKey)
+		route, _ := n.RouteOf(contentKey)
 		reply(
-			packets.Found(requestId, contentName, n.Self.SelfIp),
+			packets.Found(requestId, contentName, n.Self.SelfIp, route.Rendezvous),
 			conn,
 		)
 		log.Printf("(handling %v) send 'FOUND' for content '%v'\n", remote, contentName)
@@ -59,15 +61,17 @@ func (n *Node) OnDiscovery(incoming packets.Packet, conn net.Conn) {
 		log.Printf("(handling %v) flooding the neighbours, looking for '%v'\n", remote, contentName)
 		incoming.Header.Hops++
 
-		// response, holds the answer resulted from the flooding
-		response, _ := n.Flooder.Flood(incoming, addrPort)
+		// every positive answer resulted from the flooding, one per reachable rendezvous path
+		responses := n.Flooder.Discover(incoming, PreferenceWindow, addrPort)
 
-		if response.Header.Flags.OnlyHasFlag(packets.FOUND) {
-			log.Printf("(%v) found streaming source\n", requestId)
-			n.SetPositive(requestId, response.Header.Source)
+		response, found := n.prefer(responses, "")
+		if found {
+			log.Printf("(%v) found streaming source through rendezvous '%v'\n", requestId, response.Payload.Rendezvous)
+			n.SetPositive(requestId, Route{Source: response.Header.Source, Rendezvous: response.Payload.Rendezvous})
 			response.Header.Source = n.Self.SelfIp // todo: check this
 			log.Printf("(handling %v) received positive response from flooding, pos=%v\n", remote, n.Self.SelfIp)
 		} else {
+			response = packets.Miss(requestId, contentName)
 			log.Printf("(handling %v) received negative response from flooding\n", remote)
 		}
 
@@ -99,41 +103,63 @@ func (n *Node) OnStream(incoming packets.Packet, conn net.Conn) {
 	remote := conn.RemoteAddr().String()
 	requestId := incoming.Header.RequestId
 	contentName := incoming.Payload.ContentName
-	log.Printf("(handling %v) received 'STREAM' packet for content '%v'\n", remote, contentName)
+	contentKey := n.resolve(incoming.Payload.Key()) // relays are kept by content and rendition
+	receiving := incoming.Payload.Port              // port remote receives the stream at, if it chose one
+	log.Printf("(handling %v) received 'STREAM' packet for content '%v'\n", remote, contentKey)
 
 	defer func() {
 		utils.CloseConnection(conn, conn.RemoteAddr().String())
 		log.Printf("(handling %v) closing connection, reason 'finished handling'\n", remote)
 	}()
 
-	if n.IsStreaming(contentName) {
+	if relay, nextAddress, renewed := n.subscription(contentKey, remote, receiving); relay != nil {
+		log.Printf("(handling %v) i am streaming the content '%v'\n", remote, contentKey)
+		subscribe(incoming, conn, contentKey, relay, nextAddress, renewed)
+		return
+	}
+
+	route, exists := n.IsPositive(requestId)
+	if exists {
 
-		log.Printf("(handling %v) i am streaming the content '%v'\n", remote, contentName)
+		log.Printf("(handling %v) previouly received 'FOUND' packet from '%v', following until source\n", remote, route.Source)
 
-		relay, exists := n.RelayPool[contentName] // get relay for contentName
-		if !exists {
-			log.Fatalf("(handling %v) relay does not exist for content '%v'\n", remote, contentName)
+		// reserve the ports of the relay before asking upstream to stream, it streams
+		// to the one the relay receives at
+		receivePort, port, err := n.relayPorts()
+		if err != nil {
+			log.Printf("(handling %v) cannot relay '%v': %v\n", remote, contentKey, err)
+			reply(packets.Miss(requestId, contentName), conn)
+			log.Printf("(handling %v) sent 'MISS' packet, reason 'no ports left'\n", remote)
+			return
 		}
 
-		// todo: changed
-		nextAddress := utils.ReplacePortFromAddressString(remote, relay.Port)
-		reply(packets.Port(requestId, contentName, nextAddress), conn) // send addr:port
-		log.Printf("(handling %v) sent 'PORT' packet, addr=%v\n", remote, nextAddress)
+		relayed := false
+		defer func() {
+			if !relayed {
+				n.ReleasePort(receivePort)
+				n.ReleasePort(port)
+			}
+		}() // the ports are only kept by a relay
 
-		err := relay.Add(nextAddress) // add client to relay
-		utils.Check(err)
+		incoming = receivingAt(incoming, receivePort)
+		incoming.Header.Hops++
+		response, err := follow(incoming, route.Source)
+		if err != nil || response.Header.Flags.OnlyHasFlag(packets.MISS) {
 
-		log.Printf("(handling %v) added client address '%v' to the relay for content '%v'\n", remote, nextAddress, contentName)
-		return
-	}
+			log.Printf("(handling %v) follow through rendezvous '%v' failed, discovering another\n", remote, route.Rendezvous)
 
-	source, exists := n.IsPositive(requestId)
-	if exists {
+			addrPort, perr := netip.ParseAddrPort(remote)
+			utils.Check(perr)
 
-		log.Printf("(handling %v) previouly received 'FOUND' packet from '%v', following until source\n", remote, source)
+			// the path may lead to a failed rendezvous point, try through the others
+			newId, next, derr := n.rediscover(contentName, incoming.Payload.Rendition, route.Rendezvous, addrPort)
+			if derr == nil {
+				incoming.Header.RequestId = newId
+				route = next
+				response, err = follow(incoming, route.Source)
+			}
+		}
 
-		incoming.Header.Hops++
-		response, err := follow(incoming, source)
 		if err != nil || response.Header.Flags.OnlyHasFlag(packets.MISS) {
 			log.Printf("(handling %v) received 'MISS' packet from the follow\n", remote)
 			reply(
@@ -149,22 +175,60 @@ func (n *Node) OnStream(incoming packets.Packet, conn net.Conn) {
 			// todo: changed
 			log.Printf("(handling %v) received 'PORT' packet from the follow\n", remote)
 
-			relayPort := strconv.FormatUint(n.NextPort(), 10)
-			relay := NewRelay(contentName, response.Payload.Port, relayPort)
-			log.Printf("(handling %v) created new relay for content '%v' at port '%v'\n", remote, contentName, relay.Port)
-
-			nextAddress := utils.ReplacePortFromAddressString(remote, relay.Port)
-			err := relay.Add(nextAddress)
-			log.Printf("(handling %v) added address '%v' to relay for '%v'\n", remote, nextAddress, contentName)
-
-			err = n.AddRelay(contentName, relay)
-			utils.Check(err)
-			log.Printf("(handling %v) added relay for '%v' to the relay pool\n", remote, contentName)
+			// relays are kept by the rendition streamed, the upstream resolves the default one
+			if rendition := response.Payload.Rendition; rendition != "" {
+				resolvedKey := packets.ContentKey(contentName, rendition)
+				n.alias(contentKey, resolvedKey)
+				contentKey = resolvedKey
+			}
+
+			// the upstream already started streaming to the port reserved, left when unused
+			leave := func() {
+				packet := receivingAt(packets.Leave(incoming.Header.RequestId, contentName, incoming.Payload.Rendition), receivePort)
+				if _, err := follow(packet, route.Source); err != nil {
+					log.Printf("(handling %v) cannot leave '%v' at '%v'\n", remote, contentKey, route.Source)
+				}
+			}
+
+			if relay, nextAddress, renewed := n.subscription(contentKey, remote, receiving); relay != nil {
+				log.Printf("(handling %v) i am already streaming '%v' as '%v'\n", remote, incoming.Payload.Key(), contentKey)
+				leave()
+				subscribe(incoming, conn, contentKey, relay, nextAddress, renewed)
+				return
+			} // the relay already receiving it is kept
+
+			relayPort := strconv.FormatUint(port, 10)
+			relay, err := NewRelay(contentKey, response.Payload.Port, relayPort)
+			if err != nil {
+				log.Printf("(handling %v) cannot relay '%v': %v\n", remote, contentKey, err)
+				leave()
+				reply(packets.Miss(requestId, contentName), conn)
+				log.Printf("(handling %v) sent 'MISS' packet, reason 'cannot receive the stream'\n", remote)
+				return
+			}
+			log.Printf("(handling %v) created new relay for content '%v' at port '%v'\n", remote, contentKey, relay.Port)
+
+			nextAddress := relay.AddressOf(remote, receiving)
+			err = relay.Add(nextAddress)
+			log.Printf("(handling %v) added address '%v' to relay for '%v'\n", remote, nextAddress, contentKey)
+
+			route.RequestId = incoming.Header.RequestId // renewed and left with
+			if err = n.AddRelay(contentKey, relay, route); err != nil {
+				log.Printf("(handling %v) %v\n", remote, err)
+				_ = relay.Stop()
+				leave()
+				reply(packets.Miss(requestId, contentName), conn)
+				log.Printf("(handling %v) sent 'MISS' packet, reason 'relay already exists'\n", remote)
+				return
+			} // set up meanwhile by another request
+			relayed = true
+			log.Printf("(handling %v) added relay for '%v' to the relay pool\n", remote, contentKey)
 
 			go relay.Loop()
-			log.Printf("(handling %v) started relay for content '%v'\n", remote, contentName)
+			log.Printf("(handling %v) started relay for content '%v'\n", remote, contentKey)
 
-			reply(packets.Port(requestId, contentName, nextAddress), conn)
+			_, rendition := packets.SplitContentKey(contentKey)
+			reply(packets.Port(requestId, contentName, rendition, nextAddress), conn)
 
 			log.Printf("(handling %v) sent 'PORT' packet, addr=%v", remote, nextAddress)
 			return
@@ -182,12 +246,83 @@ func (n *Node) OnStream(incoming packets.Packet, conn net.Conn) {
 
 }
 
+// OnList routes a 'LIST' request towards the rendezvous point by flooding the
+// neighbours, and replies with the catalog that comes back.
+func (n *Node) OnList(incoming packets.Packet, conn net.Conn) {
+
+	remote := conn.RemoteAddr().String()
+	requestId := incoming.Header.RequestId
+
+	log.Printf("(handling %v) received 'LIST' packet\n", remote)
+
+	defer func(n *Node) {
+		n.Requests.Set(requestId, true)
+	}(n) // set packet as handled
+
+	if n.Requests.IsHandled(requestId) {
+		reply(packets.Miss(requestId, ""), conn)
+		log.Printf("(handling %v) send 'MISS', reason 'duplicate'\n", remote)
+		return
+	} // packet was already handled
+
+	addrPort, err := netip.ParseAddrPort(remote)
+	utils.Check(err)
+
+	if len(filterNeighbour(addrPort, n.Self.Neighbours)) == 0 {
+		reply(packets.Miss(requestId, ""), conn)
+		log.Printf("(handling %v) sent 'MISS' packet, reason 'no neighbours'\n", remote)
+		return
+	}
+
+	incoming.Header.Hops++
+	response, _ := n.Flooder.Flood(incoming, addrPort)
+
+	if !response.Header.Flags.OnlyHasFlag(packets.LIST) {
+		reply(packets.Miss(requestId, ""), conn)
+		log.Printf("(handling %v) sent 'MISS' packet, reason 'no catalog'\n", remote)
+		return
+	}
+
+	reply(response, conn)
+	log.Printf("(handling %v) sent 'LIST' with %d entries\n", remote, len(response.Payload.Catalog))
+}
+
+// subscribe answers the 'STREAM' request on conn with the address the relay for contentKey
+// streams to, nextAddress, adding it to the relay unless the subscription was renewed.
+func subscribe(incoming packets.Packet, conn net.Conn, contentKey string, relay *Relay, nextAddress string, renewed bool) {
+
+	remote := conn.RemoteAddr().String()
+	_, rendition := packets.SplitContentKey(contentKey)
+
+	reply(packets.Port(incoming.Header.RequestId, incoming.Payload.ContentName, rendition, nextAddress), conn) // send addr:port
+	log.Printf("(handling %v) sent 'PORT' packet, addr=%v\n", remote, nextAddress)
+
+	if renewed {
+		log.Printf("(handling %v) renewed subscription of '%v' to '%v'\n", remote, nextAddress, contentKey)
+		return
+	}
+
+	if err := relay.Add(nextAddress); err != nil { // add client to relay
+		log.Printf("(handling %v) '%v' is already subscribed to '%v'\n", remote, nextAddress, contentKey)
+		return
+	} // subscribed meanwhile by another request of the same remote
+
+	log.Printf("(handling %v) added client address '%v' to the relay for '%v'\n", remote, nextAddress, contentKey)
+}
+
+// receivingAt returns packet, a 'STREAM' or 'LEAVE' request, telling upstream the stream
+// is received at port on this node, see packets.Payload.
+func receivingAt(packet packets.Packet, port uint64) packets.Packet {
+	packet.Payload.Port = strconv.FormatUint(port, 10)
+	return packet
+}
+
 func reply(response packets.Packet, conn net.Conn) {
 
 	enc, err := response.Encode()
 	utils.Check(err)
 
-	_, err = conn.Write(enc)
+	err = packets.Send(conn, enc)
 	if err != nil {
 		log.Printf("(handlers.go) could not write to '%v'\n", conn.RemoteAddr().String())
 	}
@@ -209,22 +344,24 @@ func follow(packet packets.Packet, destination string) (packets.Packet, error) {
 	utils.Check(err)
 
 	// sending packet to dest
-	_, err = conn.Write(buffer)
+	err = packets.Send(conn, buffer)
 	if err != nil {
 		log.Printf("(handlers.go) cannot write packet to '%v'\n", destination)
 		return packets.Packet{}, err
 	}
 
 	// reading and decoding the response
-	responseBuffer := make([]byte, 1024)
-	n, err := conn.Read(responseBuffer)
+	responseBuffer, err := packets.NewReceiver(conn).Receive()
 	if err != nil {
 		log.Printf("(handlers.go) cannot read packet from '%v'\n", destination)
 		return packets.Packet{}, err
 	}
 
-	resp, err := packets.DecodePacket(responseBuffer[:n])
-	utils.Check(err)
+	resp, err := packets.DecodePacket(responseBuffer)
+	if err != nil {
+		log.Printf("(handlers.go) malformed packet from '%v'\n", destination)
+		return packets.Packet{}, err
+	}
 
 	return resp, nil
 }
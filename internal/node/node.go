@@ -7,6 +7,7 @@ import (
 	"net/netip"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gweebg/mcast/internal/bootstrap"
@@ -32,24 +33,56 @@ type Node struct {
 	// keeps track of handled requests
 	Requests *RequestDb
 
-	// relay pool, keeps track of receiving streams and who are we relaying them to
+	// relay pool, keeps track of receiving streams and who are we relaying them to,
+	// by content key (see packets.ContentKey)
 	RelayPool map[string]*Relay
-	rMu       sync.RWMutex
+	// where each relay receives the stream from, by content key
+	routes map[string]Route
+	// content key of the relay streaming each content key as requested, the default
+	// rendition being resolved upstream, see resolve
+	resolved map[string]string
+	rMu      sync.RWMutex
 
 	// positive, keeps track of received FOUND packets
-	Positive map[uuid.UUID]string
+	Positive map[uuid.UUID]Route
 	pMu      sync.RWMutex
 
-	// each relay has a port
+	// last reroute attempt of each relay, by content key, see Reroute
+	rerouted map[string]time.Time
+	fMu      sync.Mutex
+
+	// each relay has two ports, see relayPorts, the ports of released relays are reused
 	CurrentPort uint64
+	// last port a relay can use, 0 for no limit
+	LastPort uint64
+	released []uint64
+	portMu   sync.Mutex
 }
 
-// New creates a new instance of a *Node.
-func New(bootstrapAddr string) *Node {
+// DefaultFirstPort is the port of the first relay when the bootstrapper gives no range.
+const DefaultFirstPort = 8000
+
+// ErrNoPorts is returned by NextPort once every port of the range is in use.
+var ErrNoPorts = errors.New("no ports left for new relays")
+
+// New creates a new instance of a *Node, configured by the bootstrapper at bootstrapAddr
+// under id, see bootstrap.DefaultId.
+func New(bootstrapAddr string, id string) *Node {
 
-	self, err := setupSelf(bootstrapAddr)
+	self, err := bootstrap.Fetch(bootstrapAddr, id)
 	utils.Check(err)
 
+	return NewWithSelf(self)
+}
+
+// NewWithSelf creates a new instance of a *Node from its configuration, as given by the bootstrapper.
+func NewWithSelf(self bootstrap.Node) *Node {
+
+	ports := bootstrap.PortRange{First: DefaultFirstPort}
+	if self.Ports != nil {
+		ports = *self.Ports
+	}
+
 	handler := handlers.NewTCP(
 		handlers.WithListenTCP(),
 		handlers.WithHandleTCP(Handler),
@@ -65,14 +98,21 @@ func New(bootstrapAddr string) *Node {
 		Address:     addr,
 		Requests:    NewRequestDb(),
 		RelayPool:   make(map[string]*Relay),
-		Positive:    make(map[uuid.UUID]string),
-		CurrentPort: 8000,
+		routes:      make(map[string]Route),
+		resolved:    make(map[string]string),
+		Positive:    make(map[uuid.UUID]Route),
+		rerouted:    make(map[string]time.Time),
+		CurrentPort: ports.First,
+		LastPort:    ports.Last,
 	}
 }
 
 // Run starts the main listening loop and passes each connection to Handler.
 func (n *Node) Run() {
 
+	go n.watchRelays()        // find another rendezvous point when ours fails
+	go n.watchSubscriptions() // release the relays no one is subscribed to
+
     lAddrStr := "0.0.0.0:" + strconv.FormatInt(int64(n.Address.Port()),10)
     lAddr,err := netip.ParseAddrPort(lAddrStr)
     utils.Check(err)
@@ -93,19 +133,17 @@ func Handler(conn net.Conn, va ...interface{}) {
 	addrString := conn.RemoteAddr().String()
 	log.Printf("(handling %v) new client connected\n", addrString)
 
-	// read the connection for incoming data.
-	buffer := make([]byte, 1024)
+	// read the connection for incoming data, packets are framed by the receiver.
+	recv := packets.NewReceiver(conn)
 	for {
 
-		n, err := conn.Read(buffer) // read from connection
+		data, err := recv.Receive() // read from connection
 		if err != nil {
-			continue
-			//log.Printf("(%v) could not read from connection, closing conn\n", addrString)
-			//utils.CloseConnection(conn, addrString)
-			//return
+			_ = conn.Close() // the handlers may have closed it already
+			return
 		}
 
-		p, err := packets.DecodePacket(buffer[:n]) // decode packet
+		p, err := packets.DecodePacket(data) // decode packet
 		if err != nil {
 			log.Printf("(handling %v) malformed packet, ignoring...\n", addrString)
 			utils.CloseConnection(conn, addrString)
@@ -120,14 +158,28 @@ func Handler(conn net.Conn, va ...interface{}) {
 		case packets.STREAM:
 			node.OnStream(p, conn)
 
+		case packets.LIST:
+			node.OnList(p, conn)
+
+		case packets.LEAVE:
+			node.OnLeave(p, conn)
+
 		}
 	}
 
 }
 
+// Route is where a FOUND packet came from and the rendezvous point it leads to.
+type Route struct {
+	Source     string
+	Rendezvous string
+	// RequestId is the request the stream was asked with, once it is.
+	RequestId uuid.UUID
+}
+
 // SetPositive registers that we received a FOUND packet for the request with requestId
-// and came from source. Only the first to come is registered.
-func (n *Node) SetPositive(requestId uuid.UUID, source string) {
+// through route. Only the first to come is registered.
+func (n *Node) SetPositive(requestId uuid.UUID, route Route) {
 	n.pMu.Lock()
 	defer n.pMu.Unlock()
 
@@ -136,46 +188,109 @@ func (n *Node) SetPositive(requestId uuid.UUID, source string) {
 		return
 	}
 
-	n.Positive[requestId] = source
+	n.Positive[requestId] = route
 }
 
-func (n *Node) IsPositive(requestId uuid.UUID) (string, bool) {
+func (n *Node) IsPositive(requestId uuid.UUID) (Route, bool) {
 
 	n.pMu.RLock()
 	defer n.pMu.RUnlock()
 
-	source, exists := n.Positive[requestId]
-	return source, exists
+	route, exists := n.Positive[requestId]
+	return route, exists
 }
 
 // IsStreaming checks whether the current node is streaming a certain content
-// by its contentName.
-func (n *Node) IsStreaming(contentName string) bool {
+// (and rendition) by its contentKey.
+func (n *Node) IsStreaming(contentKey string) bool {
 	n.rMu.RLock()
 	defer n.rMu.RUnlock()
 
-	if _, exists := n.RelayPool[contentName]; exists {
+	if _, exists := n.RelayPool[contentKey]; exists {
 		return true
 	}
 	return false
 }
 
-func (n *Node) AddRelay(contentName string, relay *Relay) error {
+// AddRelay adds the relay for contentKey, receiving the stream through route.
+func (n *Node) AddRelay(contentKey string, relay *Relay, route Route) error {
 
 	n.rMu.Lock()
 	defer n.rMu.Unlock()
 
-	_, exists := n.RelayPool[contentName]
+	_, exists := n.RelayPool[contentKey]
 	if exists {
-		return errors.New("relay for content '" + contentName + "' already exists.")
+		return errors.New("relay for content '" + contentKey + "' already exists.")
 	}
 
-	n.RelayPool[contentName] = relay
+	n.RelayPool[contentKey] = relay
+	n.routes[contentKey] = route
 	return nil
 }
 
-func (n *Node) NextPort() uint64 {
+// RouteOf returns the route the relay for contentKey receives the stream through.
+func (n *Node) RouteOf(contentKey string) (Route, bool) {
+	n.rMu.RLock()
+	defer n.rMu.RUnlock()
+
+	route, exists := n.routes[contentKey]
+	return route, exists
+}
+
+// NextPort returns a free port for a new relay, or ErrNoPorts if the range is exhausted.
+func (n *Node) NextPort() (uint64, error) {
+	n.portMu.Lock()
+	defer n.portMu.Unlock()
+
+	if len(n.released) > 0 {
+		port := n.released[len(n.released)-1]
+		n.released = n.released[:len(n.released)-1]
+		return port, nil
+	}
+
+	if n.LastPort != 0 && n.CurrentPort > n.LastPort {
+		return 0, ErrNoPorts
+	}
+
 	port := n.CurrentPort
 	n.CurrentPort++
-	return port
+	return port, nil
+}
+
+// ReleasePort makes port available to the next relay.
+func (n *Node) ReleasePort(port uint64) {
+	n.portMu.Lock()
+	defer n.portMu.Unlock()
+
+	n.released = append(n.released, port)
+}
+
+// relayPorts reserves the ports of a new relay, the one it receives the stream at
+// from upstream and the one the nodes downstream receive it at, see NextPort.
+func (n *Node) relayPorts() (uint64, uint64, error) {
+
+	receive, err := n.NextPort()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	forward, err := n.NextPort()
+	if err != nil {
+		n.ReleasePort(receive)
+		return 0, 0, err
+	}
+
+	return receive, forward, nil
+}
+
+// releaseRelayPorts makes the ports of relay, see relayPorts, available to the next relay.
+func (n *Node) releaseRelayPorts(relay *Relay) {
+
+	if port, err := strconv.ParseUint(relay.Port, 10, 64); err == nil {
+		n.ReleasePort(port)
+	}
+
+	if port := portOf(relay.Origin); port != 0 {
+		n.ReleasePort(port)
+	}
 }
@@ -0,0 +1,78 @@
+package node
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNextPortExhausted(t *testing.T) {
+
+	n := &Node{CurrentPort: 8000, LastPort: 8001}
+
+	for _, expected := range []uint64{8000, 8001} {
+		if port, err := n.NextPort(); err != nil || port != expected {
+			t.Fatalf("Expected port %d, but got %d (%v)", expected, port, err)
+		}
+	}
+
+	if _, err := n.NextPort(); !errors.Is(err, ErrNoPorts) {
+		t.Fatalf("Expected ErrNoPorts once the range is used up, but got %v", err)
+	}
+
+	n.ReleasePort(8000)
+
+	if port, err := n.NextPort(); err != nil || port != 8000 {
+		t.Fatalf("Expected the released port 8000, but got %d (%v)", port, err)
+	}
+}
+
+func TestResolveDefaultRendition(t *testing.T) {
+
+	n := &Node{RelayPool: make(map[string]*Relay), routes: make(map[string]Route)}
+
+	relay, err := NewRelay("video.mp4@720p", "127.0.0.1:0", "0")
+	if err != nil {
+		t.Fatalf("Expected a relay, but got %v", err)
+	}
+
+	if err := n.AddRelay("video.mp4@720p", relay, Route{}); err != nil {
+		t.Fatalf("Expected the relay to be added, but got %v", err)
+	}
+	n.alias("video.mp4", "video.mp4@720p")
+
+	if key := n.resolve("video.mp4"); key != "video.mp4@720p" {
+		t.Fatalf("Expected 'video.mp4' to resolve to 'video.mp4@720p', but got '%v'", key)
+	}
+
+	if key := n.resolve("video.mp4@1080p"); key != "video.mp4@1080p" {
+		t.Fatalf("Expected other renditions to resolve to themselves, but got '%v'", key)
+	}
+
+	n.release("video.mp4@720p", relay)
+
+	if key := n.resolve("video.mp4"); key != "video.mp4" {
+		t.Fatalf("Expected the default rendition to be forgotten with its relay, but got '%v'", key)
+	}
+}
+
+func TestAddressOf(t *testing.T) {
+
+	relay := &Relay{Port: "9000"}
+
+	tests := []struct {
+		name    string
+		port    string
+		address string
+	}{
+		{"clients receive at the port of the relay", "", "10.0.0.2:9000"},
+		{"nodes receive at the port they chose", "9100", "10.0.0.2:9100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if address := relay.AddressOf("10.0.0.2:41234", tt.port); address != tt.address {
+				t.Fatalf("Expected '%v', but got '%v'", tt.address, address)
+			}
+		})
+	}
+}
@@ -7,8 +7,15 @@ import (
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// BurstRate is the rate, in bytes per second, the cached group of pictures is sent
+// to a new address at. Faster than realtime, so that playback starts right away,
+// but paced so that a large group of pictures does not flood the link.
+const BurstRate = 4 * 1024 * 1024
+
 type Relay struct {
 	// Name of the video that we are listening to from Origin.
 	ContentName string
@@ -26,35 +33,130 @@ type Relay struct {
 	Port string
 
 	Connections []*net.UDPConn
+
+	// when each address last subscribed or renewed its subscription, see Expire.
+	seen map[string]time.Time
+
+	// Keeps the latest group of pictures, sent to new addresses before the live stream.
+	cache *GopCache
+	// addresses still receiving the cached group of pictures, the live packets
+	// are queued for them meanwhile, see sendBurst.
+	bursts map[*net.UDPAddr]*burst
+	// bursts mutex, taken after mu when both are needed.
+	bMu sync.Mutex
+
+	// when the last packet was received from Origin, in nanoseconds since the unix epoch.
+	lastReceived atomic.Int64
+	// set once Stop is called, ends the Loop.
+	stopped atomic.Bool
 }
 
-// NewRelay creates a new Relay object.
-func NewRelay(contentName string, origin string, port string) *Relay {
+// NewRelay creates a new Relay object, listening on origin. Fails if origin is
+// invalid or already in use.
+func NewRelay(contentName string, origin string, port string) (*Relay, error) {
 
 	addr, err := net.ResolveUDPAddr("udp", origin)
-	utils.Check(err)
+	if err != nil {
+		return nil, err
+	}
 
 	conn, err := net.ListenUDP("udp", addr)
-	utils.Check(err)
+	if err != nil {
+		return nil, err
+	}
 
-	return &Relay{
+	relay := &Relay{
 		ContentName: contentName,
 		Addresses:   make([]*net.UDPAddr, 0),
 		Connections: make([]*net.UDPConn, 0),
 		Origin:      origin,
 		receiver:    conn,
 		Port:        port,
+		cache:       NewGopCache(),
+		bursts:      make(map[*net.UDPAddr]*burst),
+		seen:        make(map[string]time.Time),
 	}
+	relay.lastReceived.Store(time.Now().UnixNano()) // idle since creation
+
+	return relay, nil
 }
 
 // Stop stops the reading from Origin by closing the connection.
 func (r *Relay) Stop() error {
 	log.Printf("stopping relay of '%v' with origin at '%v'\n", r.ContentName, r.Origin)
+	r.stopped.Store(true)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	return r.receiver.Close()
 }
 
+// Repoint makes the relay receive the stream from a new origin, e.g. when the
+// server streaming to the old one failed. The addresses are kept, so the stream
+// resumes for every one of them once the new origin starts sending.
+func (r *Relay) Repoint(origin string) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cache = NewGopCache() // the cached pictures belong to the old stream
+
+	if origin == r.Origin {
+		return nil
+	} // same address, keep listening
+
+	addr, err := net.ResolveUDPAddr("udp", origin)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	old := r.receiver
+	r.receiver, r.Origin = conn, origin
+	r.lastReceived.Store(time.Now().UnixNano()) // give the new origin time to start
+
+	log.Printf("relay of '%v' now receiving from '%v'\n", r.ContentName, origin)
+	return old.Close() // unblocks the Loop, which picks up the new receiver
+}
+
+// Idle returns how long since the relay last received a packet from Origin.
+func (r *Relay) Idle() time.Duration {
+	return time.Since(time.Unix(0, r.lastReceived.Load()))
+}
+
+// Destinations returns the addresses the relay forwards the stream to.
+func (r *Relay) Destinations() []*net.UDPAddr {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]*net.UDPAddr(nil), r.Addresses...)
+}
+
+// current returns the connection receiving from Origin.
+func (r *Relay) current() *net.UDPConn {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.receiver
+}
+
+// AddressOf returns the address remote receives the stream at, port when it chose one
+// (nodes receive each stream at a port of their own) or the relay's Port otherwise.
+func (r *Relay) AddressOf(remote string, port string) string {
+	if port == "" {
+		port = r.Port
+	}
+	return utils.ReplacePortFromAddressString(remote, port)
+}
+
 // Add adds a new address into the Relay, this makes so that the bytes read
-// from Loop are forwarder to address as well.
+// from Loop are forwarder to address as well. The cached group of pictures is
+// sent first, so that the new address can start decoding without waiting for a keyframe.
 func (r *Relay) Add(address string) error {
 
 	r.mu.Lock()
@@ -75,25 +177,201 @@ func (r *Relay) Add(address string) error {
 	r.Addresses = append(r.Addresses, asUdp)
 	//r.Connections = append(r.Connections, udpConn)
 
+	r.seen[address] = time.Now()
+
+	if data := r.cache.Burst(); data != nil {
+
+		b := &burst{}
+
+		r.bMu.Lock()
+		r.bursts[asUdp] = b // live packets are queued until the burst is sent
+		r.bMu.Unlock()
+
+		go r.sendBurst(asUdp, data, b)
+	}
+
 	return nil
 }
 
+// Renew renews the subscription of address, returns false if address is not subscribed.
+func (r *Relay) Renew(address string) bool {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.seen[address]; !exists {
+		return false
+	}
+
+	r.seen[address] = time.Now()
+	return true
+}
+
+// Remove stops forwarding the stream to address, returns how many addresses are left.
+func (r *Relay) Remove(address string) (int, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.seen[address]; !exists {
+		return len(r.Addresses), errors.New("not streaming for address " + address)
+	}
+
+	r.remove(address)
+	return len(r.Addresses), nil
+}
+
+// Expire removes the addresses that did not renew their subscription within ttl,
+// returns the removed addresses.
+func (r *Relay) Expire(ttl time.Duration) []string {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	expired := make([]string, 0)
+	for address, seen := range r.seen {
+		if time.Since(seen) > ttl {
+			expired = append(expired, address)
+		}
+	}
+
+	for _, address := range expired {
+		r.remove(address)
+	}
+
+	return expired
+}
+
+// remove deletes address from the relay, must be called with the lock held.
+func (r *Relay) remove(address string) {
+
+	delete(r.seen, address)
+
+	for i, addr := range r.Addresses {
+		if addr.String() == address {
+			r.Addresses = append(r.Addresses[:i], r.Addresses[i+1:]...)
+
+			r.bMu.Lock()
+			delete(r.bursts, addr) // ends its burst, if any
+			r.bMu.Unlock()
+			return
+		}
+	}
+}
+
+// Subscribers returns the number of addresses the stream is forwarded to.
+func (r *Relay) Subscribers() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.Addresses)
+}
+
+// burst holds the live packets received while the cached group of pictures is
+// being sent to an address.
+type burst struct {
+	queue  [][]byte
+	queued int
+}
+
+// sendBurst sends data, the cached group of pictures, to addr at BurstRate and then
+// the live packets queued meanwhile. Stops early if addr is removed from the relay.
+func (r *Relay) sendBurst(addr *net.UDPAddr, data []byte, b *burst) {
+
+	start := time.Now()
+	chunkSize := streamer.TsMtu * 10
+
+	for off := 0; off < len(data); off += chunkSize {
+
+		if !r.bursting(addr, b) {
+			return
+		} // removed meanwhile
+
+		end := min(off+chunkSize, len(data))
+		if _, err := r.current().WriteToUDP(data[off:end], addr); err != nil {
+			log.Printf("cannot send cached gop of '%v' to '%v'\n", r.ContentName, addr.String())
+			break
+		}
+
+		time.Sleep(time.Until(start.Add(time.Duration(end) * time.Second / BurstRate)))
+	}
+
+	log.Printf("sent cached gop of '%v' to '%v' (%d bytes)\n", r.ContentName, addr.String(), len(data))
+
+	for {
+
+		r.bMu.Lock()
+		if r.bursts[addr] != b {
+			r.bMu.Unlock()
+			return
+		}
+
+		queue := b.queue
+		b.queue, b.queued = nil, 0
+
+		if len(queue) == 0 {
+			delete(r.bursts, addr) // from now on the Loop forwards to addr directly
+			r.bMu.Unlock()
+			return
+		}
+		r.bMu.Unlock()
+
+		for _, chunk := range queue {
+			_, _ = r.current().WriteToUDP(chunk, addr)
+		}
+	}
+}
+
+// bursting checks whether b is still the burst of addr.
+func (r *Relay) bursting(addr *net.UDPAddr, b *burst) bool {
+	r.bMu.Lock()
+	defer r.bMu.Unlock()
+
+	return r.bursts[addr] == b
+}
+
+// queue keeps a copy of chunk for addr if it is still receiving its burst, must be
+// called with bMu held. Chunks beyond MaxGopSize are dropped, the burst is too slow.
+func (r *Relay) queue(addr *net.UDPAddr, chunk []byte) bool {
+
+	b, exists := r.bursts[addr]
+	if !exists {
+		return false
+	}
+
+	if b.queued+len(chunk) <= MaxGopSize {
+		b.queue = append(b.queue, append([]byte(nil), chunk...))
+		b.queued += len(chunk)
+	}
+
+	return true
+}
+
 // Loop reads a UDP stream from Origin and forwards it to the addresses specified in Addresses.
 func (r *Relay) Loop() {
 
 	buffer := make([]byte, streamer.TsMtu*10)
-	for {
+	for !r.stopped.Load() {
 
-		n, _, err := r.receiver.ReadFromUDP(buffer)
+		n, _, err := r.current().ReadFromUDP(buffer)
 		//log.Printf("reading from %v\n", r.Origin)
 		if err != nil {
 			continue
 		}
 
+		r.lastReceived.Store(time.Now().UnixNano())
+
 		r.mu.RLock()
 
+		r.cache.Write(buffer[:n]) // only written here, Add holds the write lock to read it
+
 		if len(r.Addresses) > 0 {
+			r.bMu.Lock()
 			for _, addr := range r.Addresses {
+				if r.queue(addr, buffer[:n]) {
+					continue
+				} // still receiving the cached gop
+
 				//_, err := conn.Write(buffer[:n])
 				//log.Printf("sent to %v\n", conn.RemoteAddr().String())
 				_, err := r.receiver.WriteToUDP(buffer[:n], addr)
@@ -102,6 +380,7 @@ func (r *Relay) Loop() {
 					continue
 				}
 			}
+			r.bMu.Unlock()
 		}
 
 		r.mu.RUnlock()
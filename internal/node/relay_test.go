@@ -0,0 +1,107 @@
+package node
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gweebg/mcast/internal/streamer"
+	"github.com/gweebg/mcast/internal/ts"
+)
+
+// marker returns a null packet whose payload is filled with b, told apart when received.
+func marker(b byte) []byte {
+
+	pkt := bytes.Repeat([]byte{b}, ts.PacketSize)
+	pkt[0], pkt[1], pkt[2], pkt[3] = ts.SyncByte, 0x1f, 0xff, 0x10
+
+	return pkt
+}
+
+// TestAddDuringLoop subscribes to a relay while it is receiving, the subscriber gets
+// the cached group of pictures first and then the live packets in the order they arrived.
+func TestAddDuringLoop(t *testing.T) {
+
+	relay, err := NewRelay("video.mp4", "127.0.0.1:0", "0")
+	if err != nil {
+		t.Fatalf("Expected a relay, but got %v", err)
+	}
+	defer relay.Stop()
+	go relay.Loop()
+
+	origin, err := net.DialUDP("udp", nil, relay.receiver.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("Expected to stream to the relay, but got %v", err)
+	}
+	defer origin.Close()
+
+	// a group of pictures that takes a while to be sent at BurstRate
+	s := newTestStream()
+	gop := concat(s.tables(), s.frame(true, BurstRate/10))
+
+	chunkSize := streamer.TsMtu * 7
+	for off := 0; off < len(gop); off += chunkSize {
+		if _, err := origin.Write(gop[off:min(off+chunkSize, len(gop))]); err != nil {
+			t.Fatalf("Expected to stream to the relay, but got %v", err)
+		}
+		if off%(chunkSize*20) == 0 {
+			time.Sleep(time.Millisecond)
+		} // paced, so that the relay keeps up
+	}
+
+	// wait until the whole group of pictures that made it to the relay is cached
+	var burst, previous []byte
+	deadline := time.Now().Add(2 * time.Second)
+	for burst == nil || len(burst) != len(previous) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the relay to cache the group of pictures, but got %d bytes", len(burst))
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		relay.mu.Lock()
+		burst, previous = relay.cache.Burst(), burst
+		relay.mu.Unlock()
+	}
+
+	subscriber, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Expected to listen for the stream, but got %v", err)
+	}
+	defer subscriber.Close()
+	_ = subscriber.SetReadBuffer(4 * 1024 * 1024)
+
+	if err := relay.Add(subscriber.LocalAddr().String()); err != nil {
+		t.Fatalf("Expected the subscriber to be added, but got %v", err)
+	}
+
+	// live packets arriving while the burst is being sent
+	live := make([]byte, 0)
+	for i := byte(1); i <= 5; i++ {
+		live = append(live, marker(i)...)
+		if _, err := origin.Write(marker(i)); err != nil {
+			t.Fatalf("Expected to stream to the relay, but got %v", err)
+		}
+	}
+
+	expected := concat(burst, live)
+	received := make([]byte, 0, len(expected))
+	buffer := make([]byte, 64*1024)
+
+	_ = subscriber.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(received) < len(expected) {
+		n, _, err := subscriber.ReadFromUDP(buffer)
+		if err != nil {
+			t.Fatalf("Expected %d bytes, but got %d (%v)", len(expected), len(received), err)
+		}
+		received = append(received, buffer[:n]...)
+	}
+
+	if !bytes.Equal(received[:len(burst)], burst) {
+		t.Fatalf("Expected the cached group of pictures first")
+	}
+
+	if !bytes.Equal(received[len(burst):], live) {
+		t.Fatalf("Expected the live packets in order after the burst, but got %d bytes out of order", len(received)-len(burst))
+	}
+}
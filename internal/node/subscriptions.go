@@ -0,0 +1,263 @@
+package node
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/utils"
+)
+
+const (
+	// SubscriptionTTL is how long an address keeps receiving a stream without renewing
+	// its subscription, by sending the 'STREAM' request again.
+	SubscriptionTTL = 30 * time.Second
+	// RenewInterval is how often subscriptions are renewed upstream.
+	RenewInterval = SubscriptionTTL / 3
+	// subscriptionWatchInterval is how often the subscriptions are checked for expiry.
+	subscriptionWatchInterval = time.Second
+)
+
+// subscription returns the relay for contentKey and the address remote receives it at,
+// at port if remote chose one, renewing the subscription if remote is already subscribed.
+func (n *Node) subscription(contentKey string, remote string, port string) (*Relay, string, bool) {
+
+	n.rMu.RLock()
+	defer n.rMu.RUnlock()
+
+	relay, exists := n.RelayPool[contentKey]
+	if !exists {
+		return nil, "", false
+	}
+
+	address := relay.AddressOf(remote, port)
+	return relay, address, relay.Renew(address)
+}
+
+// resolve returns the content key of the relay streaming contentKey, which differs
+// from it when no rendition was requested and the upstream resolved the default one.
+func (n *Node) resolve(contentKey string) string {
+
+	n.rMu.RLock()
+	defer n.rMu.RUnlock()
+
+	if resolved, exists := n.resolved[contentKey]; exists {
+		return resolved
+	}
+	return contentKey
+}
+
+// alias records that requests for contentKey are streamed by the relay for resolved.
+func (n *Node) alias(contentKey string, resolved string) {
+
+	if contentKey == resolved {
+		return
+	}
+
+	n.rMu.Lock()
+	defer n.rMu.Unlock()
+
+	if n.resolved == nil {
+		n.resolved = make(map[string]string)
+	}
+	n.resolved[contentKey] = resolved
+}
+
+// OnLeave ends the subscription of remote to a content, the relay is torn down
+// once no one is subscribed.
+func (n *Node) OnLeave(incoming packets.Packet, conn net.Conn) {
+
+	remote := conn.RemoteAddr().String()
+	contentKey := n.resolve(incoming.Payload.Key())
+
+	log.Printf("(handling %v) received 'LEAVE' packet for content '%v'\n", remote, contentKey)
+
+	defer func() {
+		utils.CloseConnection(conn, remote)
+		log.Printf("(handling %v) closing connection, reason 'finished handling'\n", remote)
+	}()
+
+	reply(incoming, conn) // acknowledge, leaving never fails for the subscriber
+
+	n.rMu.RLock()
+	relay, exists := n.RelayPool[contentKey]
+	n.rMu.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	left, err := relay.Remove(relay.AddressOf(remote, incoming.Payload.Port))
+	if err != nil {
+		log.Printf("(handling %v) %v\n", remote, err)
+		return
+	}
+
+	if left == 0 {
+		n.release(contentKey, relay)
+	}
+}
+
+// release tears down the relay for contentKey, frees its port and leaves its upstream.
+func (n *Node) release(contentKey string, relay *Relay) {
+
+	n.rMu.Lock()
+	if n.RelayPool[contentKey] != relay || relay.Subscribers() > 0 {
+		n.rMu.Unlock()
+		return
+	} // replaced or subscribed to in the meantime
+
+	route := n.routes[contentKey]
+	delete(n.RelayPool, contentKey)
+	delete(n.routes, contentKey)
+	for requested, resolved := range n.resolved {
+		if resolved == contentKey {
+			delete(n.resolved, requested)
+		}
+	} // the default rendition is resolved again by the next request
+	n.rMu.Unlock()
+
+	if err := relay.Stop(); err != nil {
+		log.Printf("(subscriptions) cannot stop relay of '%v': %v\n", contentKey, err)
+	}
+
+	n.releaseRelayPorts(relay)
+
+	contentName, rendition := packets.SplitContentKey(contentKey)
+	if _, err := follow(receivingAt(packets.Leave(route.RequestId, contentName, rendition), portOf(relay.Origin)), route.Source); err != nil {
+		log.Printf("(subscriptions) cannot leave '%v' at '%v'\n", contentKey, route.Source)
+	}
+
+	log.Printf("(subscriptions) released relay of '%v', no subscribers left\n", contentKey)
+}
+
+// watchSubscriptions expires the subscriptions that were not renewed, releasing the
+// relays left without subscribers, and renews the subscriptions of the others upstream.
+func (n *Node) watchSubscriptions() {
+
+	ticker := time.NewTicker(subscriptionWatchInterval)
+	defer ticker.Stop()
+
+	lastRenewal := time.Now()
+
+	for range ticker.C {
+
+		n.rMu.RLock()
+		relays := make(map[string]*Relay, len(n.RelayPool))
+		routes := make(map[string]Route, len(n.routes))
+		for contentKey, relay := range n.RelayPool {
+			relays[contentKey] = relay
+			routes[contentKey] = n.routes[contentKey]
+		}
+		n.rMu.RUnlock()
+
+		renew := time.Since(lastRenewal) >= RenewInterval
+		if renew {
+			lastRenewal = time.Now()
+		}
+
+		for contentKey, relay := range relays {
+
+			for _, address := range relay.Expire(SubscriptionTTL) {
+				log.Printf("(subscriptions) subscription of '%v' to '%v' expired\n", address, contentKey)
+			}
+
+			if relay.Subscribers() == 0 {
+				go n.release(contentKey, relay)
+				continue
+			}
+
+			if renew {
+				go n.renew(contentKey, relay, routes[contentKey])
+			}
+		}
+	}
+}
+
+// renew renews the subscription of the relay for contentKey at its upstream. Should the
+// upstream have released its relay meanwhile, the new one may stream to another address.
+func (n *Node) renew(contentKey string, relay *Relay, route Route) {
+
+	contentName, rendition := packets.SplitContentKey(contentKey)
+
+	response, err := follow(receivingAt(packets.Stream(route.RequestId, contentName, rendition), portOf(relay.Origin)), route.Source)
+	if err != nil || !response.Header.Flags.OnlyHasFlag(packets.PORT) {
+		log.Printf("(subscriptions) cannot renew '%v' at '%v'\n", contentKey, route.Source)
+		return
+	}
+
+	if response.Payload.Port != relay.Origin {
+		if err := relay.Repoint(response.Payload.Port); err != nil {
+			log.Printf("(subscriptions) cannot repoint relay of '%v': %v\n", contentKey, err)
+		}
+	}
+}
+
+// Subscription keeps a client subscribed to a content (and rendition) at its neighbour,
+// renewing it every RenewInterval until Leave is called.
+type Subscription struct {
+	Neighbour   string
+	RequestId   uuid.UUID
+	ContentName string
+	Rendition   string
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Subscribe starts renewing the subscription, already made with a 'STREAM' request
+// under requestId, of contentName (and rendition) at neighbour.
+func Subscribe(neighbour string, requestId uuid.UUID, contentName string, rendition string) *Subscription {
+
+	sub := &Subscription{
+		Neighbour:   neighbour,
+		RequestId:   requestId,
+		ContentName: contentName,
+		Rendition:   rendition,
+		stop:        make(chan struct{}),
+	}
+
+	go sub.renew()
+	return sub
+}
+
+// renew sends the 'STREAM' request again every RenewInterval, until Leave is called.
+func (s *Subscription) renew() {
+
+	ticker := time.NewTicker(RenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+
+		case <-ticker.C:
+			_, err := follow(packets.Stream(s.RequestId, s.ContentName, s.Rendition), s.Neighbour)
+			if err != nil {
+				log.Printf("(subscription) cannot renew '%v' at '%v'\n", s.ContentName, s.Neighbour)
+			}
+		}
+	}
+}
+
+// Leave stops renewing the subscription and tells the neighbour, so that the stream
+// stops as soon as no one else is watching.
+func (s *Subscription) Leave() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+
+		if err := Leave(s.Neighbour, s.RequestId, s.ContentName, s.Rendition); err != nil {
+			log.Printf("(subscription) cannot leave '%v' at '%v'\n", s.ContentName, s.Neighbour)
+		}
+	})
+}
+
+// Leave ends the subscription, made under requestId, to contentName (and rendition) at neighbour.
+func Leave(neighbour string, requestId uuid.UUID, contentName string, rendition string) error {
+	_, err := follow(packets.Leave(requestId, contentName, rendition), neighbour)
+	return err
+}
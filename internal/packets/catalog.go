@@ -0,0 +1,115 @@
+package packets
+
+import (
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// CatalogRendition describes a rendition of a catalog entry.
+type CatalogRendition struct {
+	Name   string
+	Width  uint
+	Height uint
+	FPS    uint
+}
+
+// CatalogEntry describes a content available in the network.
+type CatalogEntry struct {
+	// Name of the content, a reference (see ContentRef) when different contents share the name.
+	Name string
+	// Id is the content id given by the servers, empty if unknown.
+	Id     string
+	Width  uint
+	Height uint
+	FPS    uint
+	// Renditions lists the qualities the content is available in, empty for a single one.
+	Renditions []CatalogRendition
+}
+
+// CatalogQuery filters the catalog returned by a 'LIST' request, the zero value matches everything.
+type CatalogQuery struct {
+	// Pattern matches the content names, either a glob such as '*.mp4' or a
+	// case insensitive substring.
+	Pattern string
+	// MinWidth and MinHeight are the minimum resolution of the content or at least one of its renditions.
+	MinWidth  uint
+	MinHeight uint
+}
+
+// matchesName checks name against the query pattern.
+func (q CatalogQuery) matchesName(name string) bool {
+
+	if q.Pattern == "" {
+		return true
+	}
+
+	if strings.ContainsAny(q.Pattern, "*?[") {
+		matched, err := path.Match(q.Pattern, name)
+		return err == nil && matched
+	}
+
+	return strings.Contains(strings.ToLower(name), strings.ToLower(q.Pattern))
+}
+
+// matchesResolution checks a resolution against the query minimum.
+func (q CatalogQuery) matchesResolution(width uint, height uint) bool {
+	return width >= q.MinWidth && height >= q.MinHeight
+}
+
+// Filter returns the entry restricted to what matches the query, and whether anything did.
+// Only the renditions with the minimum resolution are kept.
+func (q CatalogQuery) Filter(entry CatalogEntry) (CatalogEntry, bool) {
+
+	if !q.matchesName(entry.Name) {
+		return entry, false
+	}
+
+	if len(entry.Renditions) == 0 {
+		return entry, q.matchesResolution(entry.Width, entry.Height)
+	}
+
+	renditions := make([]CatalogRendition, 0)
+	for _, r := range entry.Renditions {
+		if q.matchesResolution(r.Width, r.Height) {
+			renditions = append(renditions, r)
+		}
+	}
+
+	entry.Renditions = renditions
+	return entry, len(renditions) > 0
+}
+
+// List asks the rendezvous point for the catalog of the network, filtered by query.
+func List(requestId uuid.UUID, query CatalogQuery) Packet {
+
+	return Packet{
+		Header: Header{
+			Flags:     LIST,
+			RequestId: requestId,
+			Hops:      0,
+		},
+		Payload: Payload{
+			Query: &query,
+		},
+	}
+
+}
+
+// Listing answers a 'LIST' request with the matching catalog entries.
+func Listing(requestId uuid.UUID, catalog []CatalogEntry, source string) Packet {
+
+	return Packet{
+		Header: Header{
+			Flags:     LIST,
+			RequestId: requestId,
+			Hops:      0,
+			Source:    source,
+		},
+		Payload: Payload{
+			Catalog: catalog,
+		},
+	}
+
+}
@@ -0,0 +1,45 @@
+package packets
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+)
+
+// Send writes an encoded packet to w as a single gob message, so that the other end
+// reads it whole with a Receiver regardless of how the tcp stream is segmented.
+func Send(w io.Writer, data []byte) error {
+
+	buf := new(bytes.Buffer)
+	enc := gob.NewEncoder(buf)
+
+	if err := enc.Encode(data); err != nil {
+		return err
+	}
+
+	_, err := w.Write(buf.Bytes()) // one write, so concurrent senders do not interleave
+	return err
+}
+
+// Receiver reads the packets written with Send from a connection, one at a time.
+// A connection must be read by a single Receiver, it keeps the stream state.
+type Receiver struct {
+	dec *gob.Decoder
+}
+
+func NewReceiver(r io.Reader) *Receiver {
+	return &Receiver{
+		dec: gob.NewDecoder(r),
+	}
+}
+
+// Receive blocks until the next packet is read, returning its encoded bytes.
+func (r *Receiver) Receive() ([]byte, error) {
+
+	var data []byte
+	if err := r.dec.Decode(&data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -0,0 +1,53 @@
+package packets
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// chunkedReader returns at most size bytes per Read, like a segmented tcp stream.
+type chunkedReader struct {
+	r    io.Reader
+	size int
+}
+
+func (c chunkedReader) Read(p []byte) (int, error) {
+	if len(p) > c.size {
+		p = p[:c.size]
+	}
+	return c.r.Read(p)
+}
+
+func TestReceiveFramedPackets(t *testing.T) {
+
+	stream := new(bytes.Buffer)
+
+	first, _ := Encode[string](Request("10.0.0.1:5000", 1, "video.mp4@720p", 9000))
+	second, _ := Encode[[]byte](BasePacket[[]byte]{Header: PacketHeader{Flag: UPDT}, Payload: make([]byte, 100*1024)})
+
+	for _, data := range [][]byte{first, second} {
+		if err := Send(stream, data); err != nil {
+			t.Fatalf("Expected no error sending, but got %v", err)
+		}
+	}
+
+	// both packets arrive in a single buffer, and are read back in small segments
+	recv := NewReceiver(chunkedReader{r: stream, size: 7})
+
+	for i, expected := range [][]byte{first, second} {
+
+		data, err := recv.Receive()
+		if err != nil {
+			t.Fatalf("Expected packet %d to be received, but got %v", i, err)
+		}
+
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("Expected packet %d to have %d bytes, but got %d", i, len(expected), len(data))
+		}
+	}
+
+	if _, err := recv.Receive(); err != io.EOF {
+		t.Fatalf("Expected io.EOF once the stream ends, but got %v", err)
+	}
+}
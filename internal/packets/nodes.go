@@ -5,6 +5,7 @@ import (
 	"encoding/gob"
 	"github.com/google/uuid"
 	"github.com/gweebg/mcast/internal/flags"
+	"strings"
 )
 
 type Header struct {
@@ -16,7 +17,103 @@ type Header struct {
 
 type Payload struct {
 	ContentName string
-	Port        string
+	// Port is the address the stream is sent to in a 'PORT' answer. In the 'STREAM' and
+	// 'LEAVE' requests of a node it is the port the node receives the stream at, empty
+	// for clients, which receive it at the port chosen upstream.
+	Port string
+	// Rendition is the preferred quality of the content, empty for the default one.
+	Rendition string
+	// Rendezvous is the address of the rendezvous point a 'FOUND' leads to, kept
+	// as is while the packet travels back, unlike Header.Source.
+	Rendezvous string
+
+	// Query filters the catalog of a 'LIST' request.
+	Query *CatalogQuery
+	// Catalog holds the answer to a 'LIST' request.
+	Catalog []CatalogEntry
+}
+
+// Key returns the content key of the payload, see ContentKey.
+func (p Payload) Key() string {
+	return ContentKey(p.ContentName, p.Rendition)
+}
+
+// RenditionSeparator separates the content name from the rendition in a content key.
+const RenditionSeparator = "@"
+
+var (
+	// keyEscaper escapes the separator, and the escape character, within the parts of a content key.
+	keyEscaper = strings.NewReplacer(`\`, `\\`, RenditionSeparator, `\`+RenditionSeparator)
+	// keyUnescaper reverts keyEscaper.
+	keyUnescaper = strings.NewReplacer(`\\`, `\`, `\`+RenditionSeparator, RenditionSeparator)
+)
+
+// ContentKey identifies a rendition of a content, e.g. 'video.mp4@720p', the key
+// is the content name alone for the default rendition. Separators within the name
+// are escaped, so that names such as 'foo@bar.mp4' are split back whole.
+func ContentKey(contentName string, rendition string) string {
+	if rendition == "" {
+		return keyEscaper.Replace(contentName)
+	}
+	return keyEscaper.Replace(contentName) + RenditionSeparator + keyEscaper.Replace(rendition)
+}
+
+// SplitContentKey splits a content key into the content name and its rendition.
+func SplitContentKey(key string) (string, string) {
+
+	for i := 0; i < len(key); i++ {
+
+		switch key[i] {
+		case '\\':
+			i++ // escaped character
+		case RenditionSeparator[0]:
+			return keyUnescaper.Replace(key[:i]), keyUnescaper.Replace(key[i+1:])
+		}
+	}
+
+	return keyUnescaper.Replace(key), ""
+}
+
+const (
+	// IdSeparator separates the content name from its id in a content reference.
+	IdSeparator = "#"
+	// IdLength is the length, in hex characters, of a content id.
+	IdLength = 16
+)
+
+// ValidId checks whether id is a content id, IdLength lowercase hex characters.
+func ValidId(id string) bool {
+
+	if len(id) != IdLength {
+		return false
+	}
+
+	for _, c := range id {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ContentRef identifies a content among others with the same name, e.g.
+// 'movie.mp4#3f2a9c0d1b7e4a65', the reference is the name alone when id is empty.
+func ContentRef(contentName string, id string) string {
+	if id == "" {
+		return contentName
+	}
+	return contentName + IdSeparator + id
+}
+
+// SplitContentRef splits a content reference into the content name and its id. The
+// suffix is only an id if it is a valid one, so names such as 'ep#1.mp4' are kept whole.
+func SplitContentRef(ref string) (string, string) {
+	i := strings.LastIndex(ref, IdSeparator)
+	if i < 0 || !ValidId(ref[i+1:]) {
+		return ref, ""
+	}
+	return ref[:i], ref[i+1:]
 }
 
 type Packet struct {
@@ -57,9 +154,16 @@ const (
 
 	STREAM flags.FlagType = 0b1000
 	PORT   flags.FlagType = 0b10000
+
+	REG  flags.FlagType = 0b100000
+	DREG flags.FlagType = 0b1000000
+
+	LIST flags.FlagType = 0b10000000
+
+	LEAVE flags.FlagType = 0b100000000
 )
 
-func Discovery(requestId uuid.UUID, contentName string) Packet {
+func Discovery(requestId uuid.UUID, contentName string, rendition string) Packet {
 
 	return Packet{
 		Header: Header{
@@ -70,11 +174,12 @@ func Discovery(requestId uuid.UUID, contentName string) Packet {
 		Payload: Payload{
 			ContentName: contentName,
 			Port:        "",
+			Rendition:   rendition,
 		},
 	}
 }
 
-func Found(requestId uuid.UUID, contentName string, source string) Packet {
+func Found(requestId uuid.UUID, contentName string, source string, rendezvous string) Packet {
 
 	return Packet{
 		Header: Header{
@@ -86,6 +191,7 @@ func Found(requestId uuid.UUID, contentName string, source string) Packet {
 		Payload: Payload{
 			ContentName: contentName,
 			Port:        "",
+			Rendezvous:  rendezvous,
 		},
 	}
 
@@ -107,7 +213,9 @@ func Miss(requestId uuid.UUID, contentName string) Packet {
 
 }
 
-func Port(requestId uuid.UUID, contentName string, port string) Packet {
+// Port answers a 'STREAM' request with the address the stream is sent to, along
+// with the rendition streamed, the default one resolved when none was requested.
+func Port(requestId uuid.UUID, contentName string, rendition string, port string) Packet {
 
 	return Packet{
 		Header: Header{
@@ -118,12 +226,13 @@ func Port(requestId uuid.UUID, contentName string, port string) Packet {
 		Payload: Payload{
 			ContentName: contentName,
 			Port:        port,
+			Rendition:   rendition,
 		},
 	}
 
 }
 
-func Stream(requestId uuid.UUID, contentName string) Packet {
+func Stream(requestId uuid.UUID, contentName string, rendition string) Packet {
 
 	return Packet{
 		Header: Header{
@@ -134,6 +243,56 @@ func Stream(requestId uuid.UUID, contentName string) Packet {
 		Payload: Payload{
 			ContentName: contentName,
 			Port:        "",
+			Rendition:   rendition,
+		},
+	}
+
+}
+
+// Leave ends the subscription to a content (and rendition), requested with
+// requestId, the same packet is used as acknowledgement.
+func Leave(requestId uuid.UUID, contentName string, rendition string) Packet {
+
+	return Packet{
+		Header: Header{
+			Flags:     LEAVE,
+			RequestId: requestId,
+			Hops:      0,
+		},
+		Payload: Payload{
+			ContentName: contentName,
+			Port:        "",
+			Rendition:   rendition,
+		},
+	}
+
+}
+
+// Register announces the server listening at address to a rendezvous point,
+// the same packet is used as acknowledgement.
+func Register(address string) Packet {
+
+	return Packet{
+		Header: Header{
+			Flags:     REG,
+			RequestId: uuid.New(),
+			Hops:      0,
+			Source:    address,
+		},
+	}
+
+}
+
+// Deregister removes the server listening at address from a rendezvous point,
+// the same packet is used as acknowledgement.
+func Deregister(address string) Packet {
+
+	return Packet{
+		Header: Header{
+			Flags:     DREG,
+			RequestId: uuid.New(),
+			Hops:      0,
+			Source:    address,
 		},
 	}
 
@@ -0,0 +1,63 @@
+package packets
+
+import "testing"
+
+func TestContentKeyRoundTrip(t *testing.T) {
+
+	cases := []struct {
+		name      string
+		rendition string
+	}{
+		{"video.mp4", ""},
+		{"video.mp4", "720p"},
+		{"foo@bar.mp4", ""},
+		{"foo@bar.mp4", "720p"},
+		{`back\slash@.mp4`, "1080p"},
+		{"video.mp4", "odd@rendition"},
+	}
+
+	for _, c := range cases {
+
+		key := ContentKey(c.name, c.rendition)
+		name, rendition := SplitContentKey(key)
+
+		if name != c.name || rendition != c.rendition {
+			t.Fatalf("Expected '%v' and '%v' from key '%v', but got '%v' and '%v'", c.name, c.rendition, key, name, rendition)
+		}
+	}
+}
+
+func TestContentKeyPlainNames(t *testing.T) {
+
+	if key := ContentKey("video.mp4", "720p"); key != "video.mp4@720p" {
+		t.Fatalf("Expected 'video.mp4@720p', but got '%v'", key)
+	}
+
+	if key := ContentKey("video.mp4", ""); key != "video.mp4" {
+		t.Fatalf("Expected 'video.mp4', but got '%v'", key)
+	}
+}
+
+func TestSplitContentRef(t *testing.T) {
+
+	tests := []struct {
+		ref  string
+		name string
+		id   string
+	}{
+		{"movie.mp4", "movie.mp4", ""},
+		{"movie.mp4#3f2a9c0d1b7e4a65", "movie.mp4", "3f2a9c0d1b7e4a65"},
+		{"ep#1.mp4", "ep#1.mp4", ""},
+		{"ep#1.mp4#3f2a9c0d1b7e4a65", "ep#1.mp4", "3f2a9c0d1b7e4a65"},
+		{"movie.mp4#3F2A9C0D1B7E4A65", "movie.mp4#3F2A9C0D1B7E4A65", ""},
+		{"movie.mp4#3f2a9c0d", "movie.mp4#3f2a9c0d", ""},
+	}
+
+	for _, tt := range tests {
+
+		name, id := SplitContentRef(tt.ref)
+		if name != tt.name || id != tt.id {
+			t.Fatalf("Expected '%v' and '%v' from '%v', but got '%v' and '%v'", tt.name, tt.id, tt.ref, name, id)
+		}
+	}
+}
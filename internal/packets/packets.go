@@ -9,6 +9,17 @@ import (
 
 type PacketHeader struct {
 	Flag flags.FlagType
+	// Content the packet refers to, responses echo the one of their request.
+	Content string
+	// Id of the request the packet belongs to, its response and confirmation echo it,
+	// so that several requests can be in flight on the same connection.
+	Id uint64
+	// Source identifies the requester regardless of the connection it writes from,
+	// rendezvous points use their listening address.
+	Source string
+	// Port the requester of a 'REQ' receives the stream at, on its host. When 0 the
+	// server chooses one.
+	Port uint64
 }
 
 type BasePacket[T any] struct {
@@ -52,47 +63,83 @@ const (
 	OK   flags.FlagType = 0b10000
 	REQ  flags.FlagType = 0b100000
 	PING flags.FlagType = 0b1000000
+	UPDT flags.FlagType = 0b10000000
+	FULL flags.FlagType = 0b100000000
+	// NONE refuses a request for content (or a rendition) the server does not offer.
+	NONE flags.FlagType = 0b1000000000
 )
 
-func Wake() BasePacket[string] {
+// Peek decodes only the header of a BasePacket, regardless of its payload type.
+func Peek(data []byte) (PacketHeader, error) {
+
+	buf := bytes.NewBuffer(data)
+	dec := gob.NewDecoder(buf)
+
+	var p struct{ Header PacketHeader }
+
+	if err := dec.Decode(&p); err != nil {
+		return PacketHeader{}, err
+	}
+
+	return p.Header, nil
+}
+
+func Wake(source string) BasePacket[string] {
 	return BasePacket[string]{
 		Header: PacketHeader{
-			Flag: WAKE,
+			Flag:   WAKE,
+			Source: source,
 		},
 	}
 }
 
-func Request(contentName string) BasePacket[string] {
+func Request(source string, id uint64, contentName string, port uint64) BasePacket[string] {
 	return BasePacket[string]{
 		Header: PacketHeader{
-			Flag: REQ,
+			Flag:    REQ,
+			Content: contentName,
+			Id:      id,
+			Source:  source,
+			Port:    port,
 		},
 		Payload: contentName,
 	}
 }
 
-func Ok() BasePacket[string] {
+func Ok(id uint64, contentName string) BasePacket[string] {
 	return BasePacket[string]{
 		Header: PacketHeader{
-			Flag: OK,
+			Flag:    OK,
+			Content: contentName,
+			Id:      id,
 		},
 	}
 }
 
-func Stop(contentName string) BasePacket[string] {
+func Stop(source string, contentName string) BasePacket[string] {
 	return BasePacket[string]{
 		Header: PacketHeader{
-			Flag: STOP,
+			Flag:    STOP,
+			Content: contentName,
+			Source:  source,
 		},
 		Payload: contentName,
 	}
 }
 
-func Ping() BasePacket[string] {
-	return BasePacket[string]{
+// Probe is the payload of a 'PING', echoed back by the server in its pong.
+type Probe struct {
+	// Seq is the sequence number of the probe, used to detect lost and late pongs.
+	Seq uint64
+	// Timestamp is when the probe was sent, in nanoseconds since the unix epoch.
+	Timestamp int64
+}
+
+func Ping(probe Probe) BasePacket[Probe] {
+	return BasePacket[Probe]{
 		Header: PacketHeader{
 			Flag: PING,
 		},
-		Payload: "hello!",
+		Payload: probe,
 	}
 }
@@ -0,0 +1,198 @@
+package rendezvous
+
+import (
+	"log"
+	"sort"
+
+	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/server"
+)
+
+// Catalog returns the content available in the network, merged from the catalogs
+// of every available server and filtered by query.
+func (r *Rendezvous) Catalog(query packets.CatalogQuery) []packets.CatalogEntry {
+
+	r.sMu.RLock()
+	catalogs := make([][]server.ConfigItem, 0, len(r.Servers))
+	for _, srv := range r.Servers {
+		if srv.Available() {
+			catalogs = append(catalogs, srv.Content)
+		}
+	}
+	r.sMu.RUnlock()
+
+	entries := make([]packets.CatalogEntry, 0)
+	for _, entry := range mergeCatalogs(catalogs) {
+		if filtered, matches := query.Filter(entry); matches {
+			entries = append(entries, filtered)
+		}
+	}
+
+	return entries
+}
+
+// Conflicts returns the content names that refer to different contents (different ids)
+// across the available servers, with the servers holding each id.
+func (r *Rendezvous) Conflicts() map[string]map[string][]string {
+
+	r.sMu.RLock()
+	defer r.sMu.RUnlock()
+
+	ids := make(map[string]map[string][]string) // name -> id -> servers
+	for _, srv := range r.Servers {
+
+		if !srv.Available() {
+			continue
+		}
+
+		for _, item := range srv.Content {
+			if item.Id == "" {
+				continue
+			} // unknown identity, cannot conflict
+
+			if ids[item.Name] == nil {
+				ids[item.Name] = make(map[string][]string)
+			}
+			ids[item.Name][item.Id] = append(ids[item.Name][item.Id], srv.Address)
+		}
+	}
+
+	for name, byId := range ids {
+		if len(byId) < 2 {
+			delete(ids, name)
+		}
+	}
+
+	return ids
+}
+
+// Rendition returns the name of the rendition of contentName, the default one when
+// rendition is empty, as offered by the available servers. Returns false if no
+// available server offers contentName in rendition.
+func (r *Rendezvous) Rendition(contentName string, rendition string) (string, bool) {
+
+	name, id := packets.SplitContentRef(contentName)
+
+	r.sMu.RLock()
+	defer r.sMu.RUnlock()
+
+	for _, srv := range r.Servers {
+
+		if !srv.Available() {
+			continue
+		}
+
+		for _, item := range srv.Content {
+			if item.Name == name && (id == "" || item.Id == id) && item.Offers(rendition) {
+				if rendition == "" {
+					return item.DefaultRendition(), true
+				}
+				return rendition, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Ambiguous checks whether contentName is shared by different contents, such a
+// name must be requested as a content reference (see packets.ContentRef).
+func (r *Rendezvous) Ambiguous(contentName string) bool {
+
+	name, id := packets.SplitContentRef(contentName)
+	if id != "" {
+		return false
+	}
+
+	_, conflict := r.Conflicts()[name]
+	return conflict
+}
+
+// reportConflicts logs the content names shared by different contents.
+func (r *Rendezvous) reportConflicts() {
+	for name, byId := range r.Conflicts() {
+		for id, servers := range byId {
+			log.Printf("(catalog) conflict: '%v' is listed as '%v' by %v\n", name, packets.ContentRef(name, id), servers)
+		}
+	}
+}
+
+// mergeCatalogs merges server catalogs into a catalog entry per content, sorted by
+// name. Items with the same name are the same content unless their ids differ, in
+// which case each one is a separate entry named after its content reference. The
+// renditions of a content found in several servers are joined.
+func mergeCatalogs(catalogs [][]server.ConfigItem) []packets.CatalogEntry {
+
+	// distinct ids of each name, to detect conflicts
+	ids := make(map[string]map[string]bool)
+	for _, catalog := range catalogs {
+		for _, item := range catalog {
+			if ids[item.Name] == nil {
+				ids[item.Name] = make(map[string]bool)
+			}
+			if item.Id != "" {
+				ids[item.Name][item.Id] = true
+			}
+		}
+	}
+
+	merged := make(map[string]*packets.CatalogEntry)
+
+	for _, catalog := range catalogs {
+		for _, item := range catalog {
+
+			name := item.Name
+			if len(ids[item.Name]) > 1 {
+				if item.Id == "" {
+					continue
+				} // cannot tell which of the conflicting contents it is
+				name = packets.ContentRef(item.Name, item.Id)
+			}
+
+			entry, exists := merged[name]
+			if !exists {
+				entry = &packets.CatalogEntry{
+					Name:   name,
+					Width:  item.Width,
+					Height: item.Height,
+					FPS:    item.FPS,
+				}
+				merged[name] = entry
+			}
+
+			if entry.Id == "" {
+				entry.Id = item.Id
+			}
+			for _, r := range item.Renditions {
+				if !hasRendition(entry.Renditions, r.Name) {
+					entry.Renditions = append(entry.Renditions, packets.CatalogRendition{
+						Name:   r.Name,
+						Width:  r.Width,
+						Height: r.Height,
+						FPS:    r.FPS,
+					})
+				}
+			}
+		}
+	}
+
+	entries := make([]packets.CatalogEntry, 0, len(merged))
+	for _, entry := range merged {
+		entries = append(entries, *entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries
+}
+
+func hasRendition(renditions []packets.CatalogRendition, name string) bool {
+	for _, r := range renditions {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package rendezvous
+
+import (
+	"testing"
+
+	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/server"
+)
+
+func TestMergeCatalogs(t *testing.T) {
+
+	first := []server.ConfigItem{
+		{Name: "simpsons.ts", Width: 1920, Height: 1080, FPS: 30, Renditions: []server.Rendition{
+			{Name: "1080p", Width: 1920, Height: 1080, FPS: 30},
+			{Name: "720p", Width: 1280, Height: 720, FPS: 30},
+		}},
+		{Name: "movie.mp4", Width: 1280, Height: 720, FPS: 24},
+	}
+	second := []server.ConfigItem{
+		{Name: "simpsons.ts", Width: 1920, Height: 1080, FPS: 30, Renditions: []server.Rendition{
+			{Name: "720p", Width: 1280, Height: 720, FPS: 30},
+			{Name: "360p", Width: 640, Height: 360, FPS: 30},
+		}},
+	}
+
+	entries := mergeCatalogs([][]server.ConfigItem{first, second})
+
+	if len(entries) != 2 || entries[0].Name != "movie.mp4" || entries[1].Name != "simpsons.ts" {
+		t.Fatalf("Expected [movie.mp4 simpsons.ts], but got %v", entries)
+	}
+
+	if len(entries[1].Renditions) != 3 {
+		t.Fatalf("Expected 3 renditions, but got %v", entries[1].Renditions)
+	}
+}
+
+func TestCatalogQuery(t *testing.T) {
+
+	entry := packets.CatalogEntry{Name: "simpsons.ts", Width: 1920, Height: 1080, Renditions: []packets.CatalogRendition{
+		{Name: "1080p", Width: 1920, Height: 1080},
+		{Name: "360p", Width: 640, Height: 360},
+	}}
+
+	tests := []struct {
+		name       string
+		query      packets.CatalogQuery
+		matches    bool
+		renditions int
+	}{
+		{"everything", packets.CatalogQuery{}, true, 2},
+		{"substring", packets.CatalogQuery{Pattern: "SIMP"}, true, 2},
+		{"glob", packets.CatalogQuery{Pattern: "*.mp4"}, false, 0},
+		{"minimum resolution", packets.CatalogQuery{MinHeight: 720}, true, 1},
+		{"too high", packets.CatalogQuery{MinHeight: 2160}, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			filtered, matches := tt.query.Filter(entry)
+			if matches != tt.matches || (matches && len(filtered.Renditions) != tt.renditions) {
+				t.Fatalf("Expected (%v, %d renditions), but got (%v, %v)", tt.matches, tt.renditions, matches, filtered.Renditions)
+			}
+		})
+	}
+}
+
+func TestMergeCatalogsConflict(t *testing.T) {
+
+	first := []server.ConfigItem{{Name: "movie.mp4", Id: "aaaaaaaaaaaaaaaa", Width: 1280, Height: 720}}
+	second := []server.ConfigItem{{Name: "movie.mp4", Id: "bbbbbbbbbbbbbbbb", Width: 1920, Height: 1080}}
+	third := []server.ConfigItem{{Name: "movie.mp4", Id: "aaaaaaaaaaaaaaaa", Width: 1280, Height: 720}}
+
+	entries := mergeCatalogs([][]server.ConfigItem{first, second, third})
+
+	if len(entries) != 2 || entries[0].Name != "movie.mp4#aaaaaaaaaaaaaaaa" || entries[1].Name != "movie.mp4#bbbbbbbbbbbbbbbb" {
+		t.Fatalf("Expected [movie.mp4#aaaaaaaaaaaaaaaa movie.mp4#bbbbbbbbbbbbbbbb], but got %v", entries)
+	}
+
+	if !Contains(second, "movie.mp4#bbbbbbbbbbbbbbbb") || Contains(second, "movie.mp4#aaaaaaaaaaaaaaaa") {
+		t.Fatalf("Expected references to match only their own id")
+	}
+}
+
+func TestRendition(t *testing.T) {
+
+	srv := NewServerInfo("10.0.0.20:5000")
+	srv.Content = []server.ConfigItem{
+		{Name: "simpsons.ts", Renditions: []server.Rendition{{Name: "1080p"}, {Name: "720p"}}},
+		{Name: "movie.mp4"},
+	}
+	srv.setAvailable(true)
+
+	r := &Rendezvous{Servers: Servers{srv.Address: srv}}
+
+	tests := []struct {
+		content   string
+		rendition string
+		expected  string
+		offered   bool
+	}{
+		{"simpsons.ts", "", "1080p", true},
+		{"simpsons.ts", "720p", "720p", true},
+		{"simpsons.ts", "4k", "", false},
+		{"movie.mp4", "", "", true},
+		{"movie.mp4", "720p", "", false},
+		{"missing.mp4", "", "", false},
+	}
+
+	for _, tt := range tests {
+
+		rendition, offered := r.Rendition(tt.content, tt.rendition)
+		if rendition != tt.expected || offered != tt.offered {
+			t.Fatalf("Expected ('%v', %v) for '%v' in '%v', but got ('%v', %v)",
+				tt.expected, tt.offered, tt.content, tt.rendition, rendition, offered)
+		}
+	}
+}
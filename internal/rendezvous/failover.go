@@ -0,0 +1,184 @@
+package rendezvous
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/utils"
+)
+
+const (
+	// RelayIdleTimeout is how long a relay can go without receiving data before its server is replaced.
+	RelayIdleTimeout = 10 * time.Second
+	// MaxMissedProbes is the number of consecutive unanswered probes after which a server is considered failed.
+	MaxMissedProbes = 3
+	// relayWatchInterval is how often the relays are checked for idleness.
+	relayWatchInterval = time.Second
+)
+
+// Origin returns the server streaming contentKey to its relay.
+func (r *Rendezvous) Origin(contentKey string) (*ServerInfo, bool) {
+
+	r.rMu.RLock()
+	address, exists := r.origins[contentKey]
+	r.rMu.RUnlock()
+
+	if !exists {
+		return nil, false
+	}
+
+	r.sMu.RLock()
+	defer r.sMu.RUnlock()
+
+	srv, exists := r.Servers[address]
+	return srv, exists
+}
+
+// setOrigin records srv as the server streaming contentKey to its relay.
+func (r *Rendezvous) setOrigin(contentKey string, srv *ServerInfo) {
+	r.rMu.Lock()
+	defer r.rMu.Unlock()
+
+	r.origins[contentKey] = srv.Address
+}
+
+// watchRelays replaces the server of any relay that stopped receiving data.
+func (r *Rendezvous) watchRelays() {
+
+	ticker := time.NewTicker(relayWatchInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+
+		r.rMu.RLock()
+		idle := make([]string, 0)
+		for contentKey, relay := range r.RelayPool {
+			if relay.Idle() > RelayIdleTimeout {
+				idle = append(idle, contentKey)
+			}
+		}
+		r.rMu.RUnlock()
+
+		for _, contentKey := range idle {
+			log.Printf("(failover) relay for '%v' received no data for %v\n", contentKey, RelayIdleTimeout)
+			go r.Failover(contentKey)
+		}
+	}
+}
+
+// serverFailed replaces srv for every relay it is streaming to.
+func (r *Rendezvous) serverFailed(srv *ServerInfo, reason string) {
+
+	log.Printf("(failover) server '%v' failed, reason '%v'\n", srv.Address, reason)
+
+	r.rMu.RLock()
+	affected := make([]string, 0)
+	for contentKey, address := range r.origins {
+		if address == srv.Address {
+			affected = append(affected, contentKey)
+		}
+	}
+	r.rMu.RUnlock()
+
+	for _, contentKey := range affected {
+		go r.Failover(contentKey)
+	}
+}
+
+// Failover asks another server with the content to stream contentKey and re-points
+// its relay to it, the relay keeps its addresses so no viewer has to request again.
+// The failed server is asked to stop, in case it is still alive, and is asked again
+// when no other server can stream the content. Attempts are spaced by RelayIdleTimeout.
+func (r *Rendezvous) Failover(contentKey string) {
+
+	r.fMu.Lock()
+	if last, exists := r.failedOver[contentKey]; exists && time.Since(last) < RelayIdleTimeout {
+		r.fMu.Unlock()
+		return
+	} // already failing over, or did it recently
+	r.failedOver[contentKey] = time.Now()
+	r.fMu.Unlock()
+
+	r.rMu.RLock()
+	relay, exists := r.RelayPool[contentKey]
+	r.rMu.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	failed, _ := r.Origin(contentKey)
+
+	candidates := make([]*ServerInfo, 0)
+	retry := false
+	for _, candidate := range r.RankServers(contentKey) {
+		if candidate == failed {
+			retry = true
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	if len(candidates) == 0 && retry {
+		log.Printf("(failover) no other server has '%v', asking '%v' again\n", contentKey, failed.Address)
+		r.stopServer(failed, contentKey)
+		candidates, failed = append(candidates, failed), nil
+	} // the only server left, it may have stopped streaming while alive
+
+	for _, candidate := range candidates {
+
+		if err := r.repoint(candidate, contentKey, portOf(relay.Origin), relay.Repoint); err != nil {
+			log.Printf("(failover) server '%v' cannot stream '%v': %v\n", candidate.Address, contentKey, err)
+			continue
+		}
+
+		r.setOrigin(contentKey, candidate)
+		log.Printf("(failover) '%v' is now streamed by '%v'\n", contentKey, candidate.Address)
+
+		if failed != nil {
+			r.stopServer(failed, contentKey)
+		}
+		return
+	}
+
+	log.Printf("(failover) no other server can stream '%v', retrying later\n", contentKey)
+}
+
+// repoint requests contentKey from svr, to be streamed to port, and calls point with
+// the address the server streams to before confirming with 'OK'.
+func (r *Rendezvous) repoint(svr *ServerInfo, contentKey string, port uint64, point func(origin string) error) error {
+
+	resp, err := r.requestServer(svr, contentKey, port)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.Header.Flag.OnlyHasFlag(packets.FULL):
+		return errors.New("server is over capacity")
+	case resp.Header.Flag.OnlyHasFlag(packets.NONE):
+		return errors.New("server no longer offers it")
+	case !resp.Header.Flag.OnlyHasFlag(packets.CSND):
+		return errors.New("server did not answer with 'CSND'")
+	}
+
+	if err := point(resp.Payload); err != nil {
+		return err
+	}
+
+	return r.confirmServer(svr, resp)
+}
+
+// stopServer asks svr to stop streaming contentKey, failures are only logged
+// since the server may be gone.
+func (r *Rendezvous) stopServer(svr *ServerInfo, contentKey string) {
+
+	stop, err := packets.Encode[string](packets.Stop(r.Address.String(), contentKey))
+	utils.Check(err)
+
+	if err := svr.send(stop); err != nil {
+		log.Printf("(failover) cannot send 'STOP' for '%v' to '%v'\n", contentKey, svr.Address)
+	}
+}
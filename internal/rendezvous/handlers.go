@@ -1,6 +1,7 @@
 package rendezvous
 
 import (
+	"errors"
 	"log"
 	"net"
 	"strconv"
@@ -38,11 +39,21 @@ func (r *Rendezvous) OnDiscovery(incoming packets.Packet, conn net.Conn) {
 		return
 	} // packet was already handled
 
-	if r.ContentExists(contentName) { // this content is available
+	if r.Ambiguous(contentName) { // different contents share this name
+
+		log.Printf("(handling %v) content '%v' is ambiguous, it must be requested by reference\n", remote, contentName)
+		reply(
+			packets.Miss(requestId, contentName),
+			conn,
+		)
+		log.Printf("(handling %v) send 'MISS', reason 'ambiguous name'\n", remote)
+		return
+
+	} else if _, offered := r.Rendition(contentName, incoming.Payload.Rendition); offered && r.ContentExists(contentName) { // this content is available
 
 		log.Printf("(handling %v) content '%v' is available for streaming\n", remote, contentName)
 		reply(
-			packets.Found(requestId, contentName, r.Address.String()),
+			packets.Found(requestId, contentName, r.Address.String(), r.Address.String()),
 			conn,
 		)
 		log.Printf("(handling %v) sent 'FOUND' with source address as '%v'\n", remote, r.Address.String())
@@ -70,124 +81,244 @@ func (r *Rendezvous) OnStream(incoming packets.Packet, conn net.Conn) {
 	requestId := incoming.Header.RequestId
 	contentName := incoming.Payload.ContentName
 
-	log.Printf("(handling %v) received 'STREAM' packet for content '%v'\n", remote, incoming.Payload.ContentName)
+	log.Printf("(handling %v) received 'STREAM' packet for content '%v'\n", remote, incoming.Payload.Key())
 	defer func() {
 		utils.CloseConnection(conn, remote)
 		log.Printf("(handling %v) closed connection, reason 'termination'\n", remote)
 	}()
 
-	if r.IsStreaming(contentName) { // if am I streaming contentName
+	rendition, offered := r.Rendition(contentName, incoming.Payload.Rendition)
+	if !offered {
+		reply(
+			packets.Miss(requestId, contentName),
+			conn,
+		)
+		log.Printf("(handling %v) sent packet 'MISS', reason 'rendition not available'\n", remote)
+		return
+	}
+
+	// relays are kept by content and rendition, the default one under its name
+	contentKey := packets.ContentKey(contentName, rendition)
 
-		log.Printf("(handling %v) stream found for content '%v'\n", remote, contentName)
+	for {
 
-		relay, exists := r.RelayPool[contentName] // get correct relay for contentName
-		if !exists {
-			log.Fatalf("(handling %v) relay does not exist for content '%v'\n", remote, contentName)
-		}
+		if relay, nextAddress, renewed := r.subscription(contentKey, remote, incoming.Payload.Port); relay != nil { // if am I streaming contentKey
 
-		// address to add to the relay
-		nextAddress := utils.ReplacePortFromAddressString(remote, relay.Port)
+			log.Printf("(handling %v) stream found for content '%v'\n", remote, contentKey)
 
-		reply(packets.Port(requestId, contentName, nextAddress), conn) // reply with streaming port
-		log.Printf("(handling %v) responded with 'PORT' packet, addr=%v", remote, nextAddress)
+			reply(packets.Port(requestId, contentName, rendition, nextAddress), conn) // reply with streaming port
+			log.Printf("(handling %v) responded with 'PORT' packet, addr=%v", remote, nextAddress)
 
-		err := relay.Add(nextAddress) // add client to relay
-		utils.Check(err)
-		log.Printf("(handling %v) added address '%v' to the relay for '%v'\n", remote, nextAddress, contentName)
-		return
+			if renewed {
+				log.Printf("(handling %v) renewed subscription of '%v' to '%v'\n", remote, nextAddress, contentKey)
+				return
+			}
+
+			if err := relay.Add(nextAddress); err != nil { // add client to relay
+				log.Printf("(handling %v) '%v' is already subscribed to '%v'\n", remote, nextAddress, contentKey)
+				return
+			} // subscribed meanwhile by another request of the same remote
+
+			log.Printf("(handling %v) added address '%v' to the relay for '%v'\n", remote, nextAddress, contentKey)
+			return
+		}
+
+		ready := r.building(contentKey)
+		if ready == nil {
+			break
+		} // no one else is setting up the relay, this request does
+
+		log.Printf("(handling %v) relay for '%v' is being set up, waiting for it\n", remote, contentKey)
+		<-ready
 	}
+	defer r.built(contentKey) // the requests waiting for the relay subscribe to it, or set it up again
 
 	log.Printf("(handling %v) no relay found for content '%v', asking server\n", remote, contentName)
 	incoming.Header.Hops++
 
-	// the best server to ask the stream from
-	svr := r.GetBestServer(contentName)
-	log.Printf("(handling %v) selected server at '%v' for the streaming of '%v'\n", remote, svr.Address, contentName)
+	// reserve the ports of the relay before asking any server to stream, the server
+	// streams to the one the relay receives at
+	receivePort, port, err := r.relayPorts()
+	if err != nil {
+		log.Printf("(handling %v) cannot relay '%v': %v\n", remote, contentKey, err)
+		reply(
+			packets.Miss(requestId, contentName),
+			conn,
+		)
+		log.Printf("(handling %v) sent packet 'MISS', reason 'no ports left'\n", remote)
+		return
+	}
 
-	// stopping metrics measurement to avoid conflicts
-	svr.TickerChan <- true
+	relayed := false
+	defer func() {
+		if !relayed {
+			r.ReleasePort(receivePort)
+			r.ReleasePort(port)
+		}
+	}() // the ports are only kept by a relay
 
-	// clearing out the 'pong' dangling packets
-	b := make([]byte, 1024)
-	_, err := svr.Conn.Read(b)
+	relayPort := strconv.FormatUint(port, 10)
 
-	utils.Check(err)
-	log.Printf("(metrics %v) temporarily stopped metric analysis with server\n", svr.Address)
+	// the servers to ask the stream from, best first, servers over capacity are skipped
+	var relay *node.Relay
+	var nextAddress string
 
-	defer func() {
-		r.measure(svr.Conn)
-		log.Printf("(metrics %v) restored metric analysis with server\n", svr.Address)
-	}() // resuming metrics after the talk with the server
+	for _, candidate := range r.RankServers(contentKey) {
 
-	// create request packet for the received content name
-	packet := packets.Request(contentName)
-	buffer, err := packets.Encode[string](packet)
-	utils.Check(err)
+		log.Printf("(handling %v) selected server at '%v' for the streaming of '%v'\n", remote, candidate.Address, contentName)
 
-	// send request packet to the best server
-	_, err = svr.Conn.Write(buffer)
-	if err != nil {
-		log.Printf("(servers %v) cannot write packet 'REQ'\n", svr)
-		return
-	}
-	log.Printf("(servers %v) sent packet 'REQ' for '%v'\n", svr.Address, contentName)
+		resp, err := r.requestServer(candidate, contentKey, receivePort)
+		if err != nil {
+			log.Printf("(servers %v) %v\n", candidate.Address, err)
+			continue
+		}
 
-	// receive and decode the response
-	responseBuffer := make([]byte, 1024)
-	n, err := svr.Conn.Read(responseBuffer)
-	if err != nil {
-		log.Printf("(servers %v) cannot read packet\n", svr.Address)
-		return
-	}
+		if resp.Header.Flag.OnlyHasFlag(packets.FULL) {
+			log.Printf("(servers %v) server is over capacity, trying the next one\n", candidate.Address)
+			continue
+		}
 
-	resp, err := packets.Decode[string](responseBuffer[:n])
-	utils.Check(err)
+		if resp.Header.Flag.OnlyHasFlag(packets.NONE) {
+			log.Printf("(servers %v) server no longer offers '%v', trying the next one\n", candidate.Address, contentKey)
+			continue
+		} // its catalog changed, the update is on its way
+
+		if !resp.Header.Flag.OnlyHasFlag(packets.CSND) {
+			log.Printf("(servers %v) did not receive port for stream of '%v'\n", candidate.Address, contentName)
+			continue
+		}
+
+		log.Printf("(servers %v) received packet 'CSND' with addr=%v\n", candidate.Address, resp.Payload)
+		log.Printf("(servers %v) server is streaming '%v' at address '%v'\n", candidate.Address, contentName, resp.Payload)
+
+		// create new relay
+		relay, err = node.NewRelay(contentKey, resp.Payload, relayPort)
+		if err != nil {
+			log.Printf("(handling %v) cannot relay '%v': %v\n", remote, contentKey, err)
+			reply(
+				packets.Miss(requestId, contentName),
+				conn,
+			)
+			log.Printf("(handling %v) sent packet 'MISS', reason 'cannot receive the stream'\n", remote)
+			return
+		} // not confirmed, the server does not start streaming
+		log.Printf("(handling %v) created new relay for '%v', relay port is '%v'", remote, contentKey, relayPort)
+
+		// add the address of the prev node to the relay
+		nextAddress = relay.AddressOf(remote, incoming.Payload.Port)
+		if err = relay.Add(nextAddress); err != nil {
+			log.Printf("(handling %v) %v\n", remote, err)
+		}
+		log.Printf("(handling %v) added address '%v' to relay for '%v'\n", remote, nextAddress, contentKey)
+
+		if err = r.confirmServer(candidate, resp); err != nil {
+			log.Printf("(servers %v) cannot reply with 'OK' to server: %v\n", candidate.Address, err)
+			_ = relay.Stop()
+			relay = nil
+			continue
+		} // not confirmed, the server does not start streaming, the next one is asked on the same ports
+		log.Printf("(servers %v) sent packet 'OK'\n", candidate.Address)
+
+		// add relay to pool
+		if err = r.AddRelay(contentKey, relay); err != nil {
+			log.Printf("(handling %v) %v\n", remote, err)
+			r.stopServer(candidate, contentKey)
+			_ = relay.Stop()
+			reply(
+				packets.Miss(requestId, contentName),
+				conn,
+			)
+			log.Printf("(handling %v) sent packet 'MISS', reason 'relay already exists'\n", remote)
+			return
+		}
+		r.setOrigin(contentKey, candidate) // the relay is failed over if candidate stops streaming
+		log.Printf("(handling %v) added relay for '%v' to the pool\n", remote, contentKey)
+
+		// start the relay forwarding loop
+		go relay.Loop()
+		log.Printf("(handling %v) relay started transmitting '%v' with origin at '%v'\n", remote, contentName, resp.Payload)
+		break
+	}
 
-	if !resp.Header.Flag.OnlyHasFlag(packets.CSND) {
-		log.Printf("(servers %v) did not receive port for stream of '%v'\n", conn.RemoteAddr().String(), contentName)
+	if relay == nil {
+		log.Printf("(handling %v) no server can stream '%v'\n", remote, contentKey)
 		reply(
 			packets.Miss(requestId, contentName),
 			conn,
 		)
-		log.Printf("(handling %v) sent packet 'MISS', reason 'no port from server'\n", remote)
+		log.Printf("(handling %v) sent packet 'MISS', reason 'no server available'\n", remote)
 		return
 	}
+	relayed = true
 
-	log.Printf("(servers %v) received packet 'CSND' with addr=%v\n", svr.Address, resp.Payload)
-	log.Printf("(servers %v) server is streaming '%v' at address '%v'\n", svr.Address, contentName, resp.Payload)
+	reply(packets.Port(requestId, contentName, rendition, nextAddress), conn) // reply to client in which port I'm streaming
+	log.Printf("(handling %v) sent packet 'PORT', addr=%v\n", remote, nextAddress)
+}
 
-	// create new relay
-	relayPort := strconv.FormatUint(r.NextPort(), 10)
-	relay := node.NewRelay(contentName, resp.Payload, relayPort)
-	log.Printf("(handling %v) created new relay for '%v', relay port is '%v'", remote, contentName, relayPort)
+// OnList answers a 'LIST' request with the merged catalog of the servers,
+// filtered by the query of the request.
+func (r *Rendezvous) OnList(incoming packets.Packet, conn net.Conn) {
 
-	// add the address of the prev node to the relay
-	nextAddress := utils.ReplacePortFromAddressString(remote, relay.Port)
-	err = relay.Add(nextAddress)
-	utils.Check(err)
-	log.Printf("(handling %v) added address '%v' to relay for '%v'\n", remote, nextAddress, contentName)
+	remote := conn.RemoteAddr().String()
+	requestId := incoming.Header.RequestId
 
-	// add relay to pool
-	err = r.AddRelay(contentName, relay)
-	utils.Check(err)
-	log.Printf("(handling %v) added relay for '%v' to the pool\n", remote, contentName)
+	var query packets.CatalogQuery
+	if incoming.Payload.Query != nil {
+		query = *incoming.Payload.Query
+	}
 
-	// start the relay forwarding loop
-	go relay.Loop()
-	log.Printf("(handling %v) relay started transmitting '%v' with origin at '%v'\n", remote, contentName, resp.Payload)
+	log.Printf("(handling %v) received 'LIST' packet, query=%+v\n", remote, query)
 
-	ok := packets.Ok()
-	okResponse, err := packets.Encode[string](ok)
+	catalog := r.Catalog(query)
+	reply(packets.Listing(requestId, catalog, r.Address.String()), conn)
+
+	log.Printf("(handling %v) sent 'LIST' with %d entries\n", remote, len(catalog))
+}
+
+// requestServer asks svr to stream contentKey to port, on this host, and returns its
+// response. Requests are told apart by their id, so several can be waiting on the same server.
+func (r *Rendezvous) requestServer(svr *ServerInfo, contentKey string, port uint64) (packets.BasePacket[string], error) {
+
+	id, response := svr.expect()
+	defer svr.forget(id)
+
+	// create request packet for the received content name and rendition
+	packet := packets.Request(r.Address.String(), id, contentKey, port)
+	buffer, err := packets.Encode[string](packet)
 	utils.Check(err)
 
-	_, err = svr.Conn.Write(okResponse)
+	// send request packet to the server
+	err = svr.send(buffer)
 	if err != nil {
-		log.Fatalf("(servers %v) cannot reply with 'OK' to server\n", svr.Address)
+		return packets.BasePacket[string]{}, errors.New("cannot write packet 'REQ'")
 	}
-	log.Printf("(servers %v) sent packet 'OK'\n", svr.Address)
+	log.Printf("(servers %v) sent packet 'REQ' for '%v' (id: %d)\n", svr.Address, contentKey, id)
 
-	reply(packets.Port(requestId, contentName, nextAddress), conn) // reply to client in which port I'm streaming
-	log.Printf("(handling %v) sent packet 'PORT', addr=%v\n", remote, nextAddress)
+	// receive and decode the response
+	responseBuffer, err := svr.Response(response, ServerResponseTimeout)
+	if err != nil {
+		return packets.BasePacket[string]{}, errors.New("cannot read packet, " + err.Error())
+	}
+
+	resp, err := packets.Decode[string](responseBuffer)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.Header.Content != contentKey {
+		return resp, errors.New("response is for '" + resp.Header.Content + "', not '" + contentKey + "'")
+	}
+
+	return resp, nil
+}
+
+// confirmServer confirms, with an 'OK', the 'CSND' response of svr to a request.
+func (r *Rendezvous) confirmServer(svr *ServerInfo, resp packets.BasePacket[string]) error {
+
+	ok, err := packets.Encode[string](packets.Ok(resp.Header.Id, resp.Header.Content))
+	utils.Check(err)
+
+	return svr.send(ok)
 }
 
 func reply(response packets.Packet, conn net.Conn) {
@@ -195,7 +326,7 @@ func reply(response packets.Packet, conn net.Conn) {
 	enc, err := response.Encode()
 	utils.Check(err)
 
-	_, err = conn.Write(enc)
+	err = packets.Send(conn, enc)
 	if err != nil {
 		log.Printf("(handling %v) could not write, reason 'unknown'\n", conn.RemoteAddr().String())
 	}
@@ -0,0 +1,76 @@
+package rendezvous
+
+import (
+	"log"
+	"net"
+
+	"github.com/gweebg/mcast/internal/packets"
+)
+
+// OnRegister adds the server announced in the packet to the known servers, the
+// rendezvous connects to it in the background as with the servers given at start.
+// Registering an already known server only acknowledges it. Servers only register
+// themselves, from their own host, other registrations are refused with 'MISS'.
+func (r *Rendezvous) OnRegister(incoming packets.Packet, conn net.Conn) {
+
+	remote := conn.RemoteAddr().String()
+	address := incoming.Header.Source
+
+	log.Printf("(handling %v) received packet 'REG' for server '%v'\n", remote, address)
+
+	if _, err := net.ResolveTCPAddr("tcp", address); err != nil {
+		log.Printf("(handling %v) invalid server address '%v', ignoring...\n", remote, address)
+		return
+	}
+
+	if !sameHost(remote, address) {
+		log.Printf("(handling %v) refusing to register '%v' from another host\n", remote, address)
+		reply(packets.Miss(incoming.Header.RequestId, ""), conn)
+		return
+	}
+
+	r.sMu.Lock()
+	srv, exists := r.Servers[address]
+	if !exists {
+		srv = NewServerInfo(address)
+		r.Servers[address] = srv
+	}
+	r.sMu.Unlock()
+
+	if !exists {
+		go r.link(srv)
+		log.Printf("(handling %v) registered server '%v'\n", remote, address)
+	} // a known server reconnects on its own, see link
+
+	reply(packets.Register(address), conn)
+}
+
+// OnDeregister removes the server announced in the packet from the known servers,
+// the relays it was streaming to are failed over to other servers. As with OnRegister,
+// servers only deregister themselves.
+func (r *Rendezvous) OnDeregister(incoming packets.Packet, conn net.Conn) {
+
+	remote := conn.RemoteAddr().String()
+	address := incoming.Header.Source
+
+	log.Printf("(handling %v) received packet 'DREG' for server '%v'\n", remote, address)
+
+	if !sameHost(remote, address) {
+		log.Printf("(handling %v) refusing to deregister '%v' from another host\n", remote, address)
+		reply(packets.Miss(incoming.Header.RequestId, ""), conn)
+		return
+	}
+
+	r.sMu.Lock()
+	srv, exists := r.Servers[address]
+	delete(r.Servers, address)
+	r.sMu.Unlock()
+
+	if exists {
+		srv.remove()
+		r.serverFailed(srv, "deregistered")
+		log.Printf("(handling %v) deregistered server '%v'\n", remote, address)
+	}
+
+	reply(packets.Deregister(address), conn)
+}
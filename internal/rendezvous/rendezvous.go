@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/gweebg/mcast/internal/bootstrap"
 	"github.com/gweebg/mcast/internal/handlers"
 	"github.com/gweebg/mcast/internal/node"
 	"github.com/gweebg/mcast/internal/packets"
@@ -17,6 +18,23 @@ import (
 	"github.com/gweebg/mcast/internal/utils"
 )
 
+const (
+
+	// InitialBackoff is the delay before the first reconnection attempt to a server.
+	InitialBackoff = time.Second
+	// MaxBackoff is the maximum delay between reconnection attempts to a server.
+	MaxBackoff = 30 * time.Second
+
+	// DefaultFirstPort is the port of the first relay when no range is given.
+	DefaultFirstPort = 9000
+
+	// DefaultLinger is how long a relay is kept without subscribers before its server is stopped.
+	DefaultLinger = 30 * time.Second
+)
+
+// ErrNoPorts is returned by NextPort once every port of the range is in use.
+var ErrNoPorts = errors.New("no ports left for new relays")
+
 type Rendezvous struct {
 	// Address of the Rendezvous node, cannot be localhost or 127.0.0.1.
 	Address netip.AddrPort
@@ -26,15 +44,37 @@ type Rendezvous struct {
 	// Servers mutex, to prevent race conditions.
 	sMu sync.RWMutex
 
+	// decides which server is asked to stream a content.
+	Strategy SelectionStrategy
+
 	// keeps track of handled requests.
 	Requests *node.RequestDb
 
-	// keeps track of receiving streams and who are we relaying them to.
+	// keeps track of receiving streams and who are we relaying them to, by content key.
 	RelayPool map[string]*node.Relay
-	// relay pool mutex, to prevent race conditions.
+	// server streaming each relay, by content key.
+	origins map[string]string
+	// since when each relay has no subscribers, by content key.
+	idleSince map[string]time.Time
+	// relays being set up, by content key, each closed once its relay is ready, see building.
+	setups map[string]chan struct{}
+	// relay pool and origins mutex, to prevent race conditions.
 	rMu sync.RWMutex
-	// current operating port when creating new relays.
+
+	// last failover attempt of each relay, by content key, see Failover.
+	failedOver map[string]time.Time
+	// failedOver mutex.
+	fMu sync.Mutex
+	// current operating port when creating new relays, the ports of released relays are reused.
 	CurrentPort uint64
+	// last port a relay can use, 0 for no limit.
+	LastPort uint64
+	released []uint64
+	portMu   sync.Mutex
+
+	// Linger is how long a relay is kept without subscribers, in case someone subscribes
+	// again, before its server is asked to stop.
+	Linger time.Duration
 
 	// tcp listener for incoming requests from other network nodes.
 	TCPHandler handlers.TCPConn
@@ -54,21 +94,42 @@ func New(addrString string, servers ...string) *Rendezvous {
 	return &Rendezvous{
 		Address:     addr,
 		Servers:     NewServers(servers),
+		Strategy:    NewMetricsStrategy(),
 		Requests:    node.NewRequestDb(),
 		TCPHandler:  *handler,
-		CurrentPort: 9000,
+		CurrentPort: DefaultFirstPort,
 		RelayPool:   make(map[string]*node.Relay),
+		origins:     make(map[string]string),
+		idleSince:   make(map[string]time.Time),
+		setups:      make(map[string]chan struct{}),
+		failedOver:  make(map[string]time.Time),
+		Linger:      DefaultLinger,
 	}
 }
 
+// NewWithSelf creates a new Rendezvous node from its configuration, as given by the bootstrapper.
+func NewWithSelf(self bootstrap.Node) *Rendezvous {
+
+	r := New(self.SelfIp, self.Servers...)
+
+	if self.Ports != nil {
+		r.CurrentPort, r.LastPort = self.Ports.First, self.Ports.Last
+	}
+
+	return r
+}
+
 // Run starts the main listening loop and passes each connection to Handler.
 func (r *Rendezvous) Run() {
 
 	for _, srv := range r.Servers {
 		log.Printf("(setup) retrieving information from server '%v'\n", srv.Address)
-		r.connectToServer(srv.Address)
+		go r.link(srv)
 	}
 
+	go r.watchRelays()        // replace the servers that stop streaming
+	go r.watchSubscriptions() // stop the servers no one is watching
+
     lAddrStr := "0.0.0.0:" + strconv.FormatInt(int64(r.Address.Port()),10)
     lAddr,err := netip.ParseAddrPort(lAddrStr)
     utils.Check(err)
@@ -88,19 +149,17 @@ func Handler(conn net.Conn, va ...interface{}) {
 	addrString := conn.RemoteAddr().String()
 	log.Printf("(handling %v) new client connected\n", addrString)
 
-	// read the connection for incoming data.
-	buffer := make([]byte, 1024)
+	// read the connection for incoming data, packets are framed by the receiver.
+	recv := packets.NewReceiver(conn)
 	for {
 
-		n, err := conn.Read(buffer) // read from connection
+		data, err := recv.Receive() // read from connection
 		if err != nil {
-			continue
-			//log.Printf("(read %v) could not read from connection\n", addrString)
-			//utils.CloseConnection(conn, addrString)
-			//return
+			_ = conn.Close() // the handlers may have closed it already
+			return
 		}
 
-		p, err := packets.DecodePacket(buffer[:n]) // decode packet
+		p, err := packets.DecodePacket(data) // decode packet
 		if err != nil {
 			log.Printf("(decode %v) malformed packet, ignoring...\n", addrString)
 			utils.CloseConnection(conn, addrString)
@@ -115,38 +174,125 @@ func Handler(conn net.Conn, va ...interface{}) {
 		case packets.STREAM:
 			rendezvous.OnStream(p, conn)
 
+		case packets.LIST:
+			rendezvous.OnList(p, conn)
+
+		case packets.REG:
+			rendezvous.OnRegister(p, conn)
+
+		case packets.DREG:
+			rendezvous.OnDeregister(p, conn)
+
+		case packets.LEAVE:
+			rendezvous.OnLeave(p, conn)
+
+		}
+	}
+}
+
+// link keeps the connection to srv alive in the background, srv is unavailable
+// while disconnected and is reconnected with exponential backoff. Every connection
+// starts with a 'WAKE', so the catalog is refreshed after the server restarts.
+func (r *Rendezvous) link(srv *ServerInfo) {
+
+	r.measure(srv) // probing does not depend on the control connection
+
+	backoff := InitialBackoff
+	for !srv.removed() {
+
+		err := r.connectToServer(srv)
+		if err != nil {
+			log.Printf("(server %v) cannot connect: %v, retrying in %v\n", srv.Address, err, backoff)
+
+			select {
+			case <-time.After(backoff):
+			case <-srv.done:
+				return
+			}
+
+			backoff = min(backoff*2, MaxBackoff)
+			continue
 		}
+
+		backoff = InitialBackoff
+		srv.setAvailable(true)
+
+		r.readLoop(srv)   // until the connection is lost
+		srv.dropPending() // their responses were lost with the connection
+		srv.disconnect()
+
+		if srv.removed() {
+			log.Printf("(server %v) deregistered, closing link\n", srv.Address)
+			return
+		}
+
+		srv.setAvailable(false)
+		r.serverFailed(srv, "connection lost")
 	}
 }
 
-func (r *Rendezvous) connectToServer(servAddr string) {
+// connectToServer connects to srv and retrieves its catalog with a 'WAKE'.
+func (r *Rendezvous) connectToServer(srv *ServerInfo) error {
 
 	// setup tcp connection with server
-	tcpAddr, err := net.ResolveTCPAddr("tcp", servAddr)
-	utils.Check(err)
+	tcpAddr, err := net.ResolveTCPAddr("tcp", srv.Address)
+	if err != nil {
+		return err
+	}
 
 	conn, err := net.DialTCP("tcp", nil, tcpAddr)
-	utils.Check(err)
+	if err != nil {
+		return err
+	}
 
 	// send wake packet to server
-	wakePacket := packets.Wake()
+	wakePacket := packets.Wake(r.Address.String())
 	p, err := packets.Encode[string](wakePacket)
 	utils.Check(err)
 
-	_, err = conn.Write(p)
-	utils.Check(err)
+	if err = packets.Send(conn, p); err != nil {
+		utils.CloseConnection(conn, srv.Address)
+		return err
+	}
 
-	// wait for response
-	buffer := make([]byte, 1024)
-	n, err := conn.Read(buffer)
-	utils.Check(err)
+	// wait for response, every packet on the connection is read through receiver
+	receiver := packets.NewReceiver(conn)
+	data, err := receiver.Receive()
+	if err != nil {
+		utils.CloseConnection(conn, srv.Address)
+		return err
+	}
 
-	recv, err := packets.Decode[[]server.ConfigItem](buffer[:n])
-	utils.Check(err)
+	recv, err := packets.Decode[[]server.ConfigItem](data)
+	if err != nil {
+		utils.CloseConnection(conn, srv.Address)
+		return err
+	}
+
+	formatted := formatCatalog(recv.Payload)
+
+	log.Printf("(server %v) received server information:\n", srv.Address)
+	utils.PrintStruct(formatted)
+
+	// setting content and connection for the server, no request is written to the old connection
+	srv.control.Lock()
+	r.sMu.Lock()
+	srv.Content = formatted
+	srv.Conn = conn
+	srv.receiver = receiver
+	r.sMu.Unlock()
+	srv.control.Unlock()
+
+	r.reportConflicts() // the new catalog may share names with other servers
+
+	return nil
+}
+
+// formatCatalog removes the full path from the content names of a server catalog.
+func formatCatalog(catalog []server.ConfigItem) []server.ConfigItem {
 
-	// removing the full path from the content names
 	formatted := make([]server.ConfigItem, 0)
-	for _, config := range recv.Payload {
+	for _, config := range catalog {
 
 		nameList := strings.Split(config.Name, "/")
 		name := nameList[len(nameList)-1]
@@ -156,130 +302,247 @@ func (r *Rendezvous) connectToServer(servAddr string) {
 		formatted = append(formatted, config)
 	}
 
-	log.Printf("(server %v) received server information:\n", servAddr)
-	utils.PrintStruct(formatted)
+	return formatted
+}
 
-	// setting content and connection for the server
-	r.sMu.Lock()
-	r.Servers[servAddr].Content = formatted
-	r.Servers[servAddr].Conn = conn
-	r.sMu.Unlock()
+// readLoop reads every packet sent by the server, catalog updates are applied
+// right away while responses are handed to whoever is waiting for them.
+// Returns once the connection is lost.
+func (r *Rendezvous) readLoop(srv *ServerInfo) {
 
-	r.measure(conn) // start metrics measuring process
-}
+	for {
 
-func (r *Rendezvous) measure(conn *net.TCPConn) {
+		data, err := srv.receiver.Receive()
+		if err != nil {
+			log.Printf("(server %v) cannot read from server, stopping read loop\n", srv.Address)
+			return
+		}
 
-	remote := conn.RemoteAddr().String()
+		header, err := packets.Peek(data)
+		if err != nil {
+			log.Printf("(server %v) malformed packet, ignoring...\n", srv.Address)
+			continue
+		}
 
-	srv, exists := r.Servers[conn.RemoteAddr().String()]
-	if !exists {
-		log.Fatalf("(server %v) server should exist in Servers, but it doesn't\n", remote)
-	}
+		switch header.Flag {
 
-	srv.Ticker = time.NewTicker(5 * time.Second)
+		case packets.UPDT:
+			r.updateCatalog(srv, data)
 
-	go func() {
-		log.Printf("(metrics %v) started metrics loop\n", remote)
-		for {
-			select {
+		default:
+			srv.deliver(header.Id, data)
+		}
+	}
+}
 
-			case <-srv.TickerChan:
-				return
+// updateCatalog replaces the content of srv with the catalog pushed by the server.
+func (r *Rendezvous) updateCatalog(srv *ServerInfo, data []byte) {
 
-			case <-srv.Ticker.C:
+	recv, err := packets.Decode[[]server.ConfigItem](data)
+	if err != nil {
+		log.Printf("(server %v) malformed catalog update, ignoring...\n", srv.Address)
+		return
+	}
 
-				ping := packets.Ping()
+	formatted := formatCatalog(recv.Payload)
 
-				packet, err := packets.Encode[string](ping)
-				utils.Check(err)
+	r.sMu.Lock()
+	srv.Content = formatted
+	r.sMu.Unlock()
 
-				startTime := time.Now()
+	log.Printf("(server %v) received catalog update:\n", srv.Address)
+	utils.PrintStruct(formatted)
 
-				_, err = conn.Write(packet)
-				utils.Check(err)
+	r.reportConflicts()
+}
 
-				log.Printf("(metrics %v) sent ping\n", remote)
+// measure starts probing srv every 5 seconds via udp, on the same port as its
+// tcp control connection, see ServerInfo.probe. Unavailable servers are not probed.
+func (r *Rendezvous) measure(srv *ServerInfo) {
 
-				_, err = conn.Read(nil)
-				utils.Check(err)
+	addr, err := net.ResolveUDPAddr("udp", srv.Address)
+	if err != nil {
+		log.Printf("(metrics %v) cannot resolve server, not probing: %v\n", srv.Address, err)
+		return
+	}
 
-				log.Printf("(metrics %v) got pong\n", remote)
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		log.Printf("(metrics %v) cannot probe server: %v\n", srv.Address, err)
+		return
+	}
 
-				stopTime := time.Now()
+	srv.ProbeConn = conn
+	srv.Ticker = time.NewTicker(5 * time.Second)
 
-				elapsedTime := stopTime.Sub(startTime).Seconds()
+	go func() {
+		log.Printf("(metrics %v) started metrics loop\n", srv.Address)
+		defer srv.Ticker.Stop()
+		defer conn.Close()
+		for {
+			select {
 
-				srv.mMu.Lock()
-				srv.Latency = float32(elapsedTime)
-				srv.Jitter = float32(elapsedTime)
-				srv.mMu.Unlock()
+			case <-srv.done:
+				return
 
-				// todo: metric setting
+			case <-srv.Ticker.C:
+				if !srv.Available() {
+					continue
+				} // reconnecting, see link
+				srv.probe()
+				if srv.Missed() == MaxMissedProbes {
+					r.serverFailed(srv, "unanswered probes")
+				} // only once, until it answers again
 			}
 		}
 	}()
-
 }
 
-// ContentExists checks if a provided content is available in any of the active
-// servers.
+// ContentExists checks if a provided content is available in any of the available
+// servers, ambiguous names (see Ambiguous) do not exist.
 func (r *Rendezvous) ContentExists(contentName string) bool {
 
+	if r.Ambiguous(contentName) {
+		return false
+	}
+
+	r.sMu.RLock()
+	defer r.sMu.RUnlock()
+
 	for _, srv := range r.Servers {
-		for _, content := range srv.Content {
-			if content.Name == contentName {
-				return true
-			}
+		if srv.Available() && Contains(srv.Content, contentName) {
+			return true
 		}
 	}
 
 	return false
 }
 
-// GetBestServer returns the connection to the best server (better metric)
-// with the content (contentName) available.
-func (r *Rendezvous) GetBestServer(contentName string) *ServerInfo {
-	var best *ServerInfo
+// GetBestServer returns the connection to the best server, according to the
+// Strategy, with the content (contentKey) available.
+func (r *Rendezvous) GetBestServer(contentKey string) *ServerInfo {
+
+	ranked := r.RankServers(contentKey)
+	if len(ranked) == 0 {
+		return nil
+	}
+
+	return ranked[0]
+}
+
+// RankServers returns the servers with the content and rendition of contentKey (see
+// packets.ContentKey) available, in the order given by the Strategy. Unavailable servers
+// are left out, as are servers that reported not having the throughput left for the
+// estimated bitrate of the rendition. None is returned for ambiguous names, see Ambiguous.
+func (r *Rendezvous) RankServers(contentKey string) []*ServerInfo {
+
+	contentName, rendition := packets.SplitContentKey(contentKey)
+
+	ranked := make([]*ServerInfo, 0)
+	if r.Ambiguous(contentName) {
+		return ranked
+	} // the servers have different contents under this name
+
+	r.sMu.RLock()
+	defer r.sMu.RUnlock()
 
 	for _, srv := range r.Servers {
 
-		if !Contains(srv.Content, contentName) { // if server does not contentName, skip iteration
+		item, exists := Find(srv.Content, contentName)
+		if !srv.Available() || !exists { // if server is down or does not contentName, skip iteration
 			continue
 		}
 
-		if best == nil || best.CalculateMetrics() < srv.CalculateMetrics() {
-			best = srv
+		bitrate := float64(item.EstimatedBitrate(rendition)) * 1000
+		if !srv.CurrentLoad().Fits(bitrate) {
+			log.Printf("(servers %v) no throughput left for '%v' (%.0f kbps), skipping\n", srv.Address, contentKey, bitrate/1000)
+			continue
 		}
+
+		ranked = append(ranked, srv)
 	}
-	return best
+
+	return r.Strategy.Rank(contentName, ranked)
 }
 
-// IsStreaming checks whether the current node is streaming a certain content by its contentName.
-func (r *Rendezvous) IsStreaming(contentName string) bool {
+// IsStreaming checks whether the current node is streaming a certain content
+// (and rendition) by its contentKey.
+func (r *Rendezvous) IsStreaming(contentKey string) bool {
 	r.rMu.RLock()
 	defer r.rMu.RUnlock()
 
-	_, exists := r.RelayPool[contentName]
+	_, exists := r.RelayPool[contentKey]
     return exists
 }
 
-func (r *Rendezvous) NextPort() uint64 {
+// NextPort returns a free port for a new relay, or ErrNoPorts if the range is exhausted.
+func (r *Rendezvous) NextPort() (uint64, error) {
+	r.portMu.Lock()
+	defer r.portMu.Unlock()
+
+	if len(r.released) > 0 {
+		port := r.released[len(r.released)-1]
+		r.released = r.released[:len(r.released)-1]
+		return port, nil
+	}
+
+	if r.LastPort != 0 && r.CurrentPort > r.LastPort {
+		return 0, ErrNoPorts
+	}
+
 	port := r.CurrentPort
 	r.CurrentPort++
-	return port
+	return port, nil
+}
+
+// ReleasePort makes port available to the next relay.
+func (r *Rendezvous) ReleasePort(port uint64) {
+	r.portMu.Lock()
+	defer r.portMu.Unlock()
+
+	r.released = append(r.released, port)
+}
+
+// relayPorts reserves the ports of a new relay, the one it receives the stream at
+// from the server and the one the previous node receives it at, see NextPort.
+func (r *Rendezvous) relayPorts() (uint64, uint64, error) {
+
+	receive, err := r.NextPort()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	forward, err := r.NextPort()
+	if err != nil {
+		r.ReleasePort(receive)
+		return 0, 0, err
+	}
+
+	return receive, forward, nil
+}
+
+// releaseRelayPorts makes the ports of relay, see relayPorts, available to the next relay.
+func (r *Rendezvous) releaseRelayPorts(relay *node.Relay) {
+
+	if port, err := strconv.ParseUint(relay.Port, 10, 64); err == nil {
+		r.ReleasePort(port)
+	}
+
+	if port := portOf(relay.Origin); port != 0 {
+		r.ReleasePort(port)
+	}
 }
 
-func (r *Rendezvous) AddRelay(contentName string, relay *node.Relay) error {
+func (r *Rendezvous) AddRelay(contentKey string, relay *node.Relay) error {
 
 	r.rMu.Lock()
 	defer r.rMu.Unlock()
 
-	_, exists := r.RelayPool[contentName]
+	_, exists := r.RelayPool[contentKey]
 	if exists {
-		return errors.New("relay for content '" + contentName + "' already exists.")
+		return errors.New("relay for content '" + contentKey + "' already exists.")
 	}
 
-	r.RelayPool[contentName] = relay
+	r.RelayPool[contentKey] = relay
 	return nil
 }
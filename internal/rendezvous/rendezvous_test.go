@@ -0,0 +1,106 @@
+package rendezvous
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gweebg/mcast/internal/node"
+)
+
+func TestNextPortExhausted(t *testing.T) {
+
+	r := &Rendezvous{CurrentPort: 9000, LastPort: 9000}
+
+	if port, err := r.NextPort(); err != nil || port != 9000 {
+		t.Fatalf("Expected port 9000, but got %d (%v)", port, err)
+	}
+
+	if _, err := r.NextPort(); !errors.Is(err, ErrNoPorts) {
+		t.Fatalf("Expected ErrNoPorts once the range is used up, but got %v", err)
+	}
+
+	r.ReleasePort(9000)
+
+	if port, err := r.NextPort(); err != nil || port != 9000 {
+		t.Fatalf("Expected the released port 9000, but got %d (%v)", port, err)
+	}
+}
+
+func TestConcurrentSetupsWait(t *testing.T) {
+
+	r := New("127.0.0.1:7000")
+
+	if ready := r.building("video.mp4"); ready != nil {
+		t.Fatalf("Expected the first request to set up the relay, but it was told to wait")
+	}
+
+	ready := r.building("video.mp4")
+	if ready == nil {
+		t.Fatalf("Expected the second request to wait for the relay, but it was told to set it up")
+	}
+
+	if other := r.building("other.mp4"); other != nil {
+		t.Fatalf("Expected relays of other contents to be set up independently")
+	}
+
+	r.RelayPool["video.mp4"] = &node.Relay{}
+	r.built("video.mp4")
+
+	select {
+	case <-ready:
+	default:
+		t.Fatalf("Expected the waiting request to be woken once the relay is built")
+	}
+
+	select {
+	case <-r.building("video.mp4"):
+	default:
+		t.Fatalf("Expected requests for an existing relay not to wait")
+	}
+}
+
+func TestFailoverBacksOff(t *testing.T) {
+
+	r := New("127.0.0.1:7000")
+
+	r.Failover("video.mp4")
+	first, exists := r.failedOver["video.mp4"]
+	if !exists {
+		t.Fatalf("Expected the failover attempt to be recorded")
+	}
+
+	r.Failover("video.mp4")
+	if last := r.failedOver["video.mp4"]; !last.Equal(first) {
+		t.Fatalf("Expected the second attempt to be skipped, but it was made at %v", last)
+	}
+
+	r.failedOver["video.mp4"] = first.Add(-RelayIdleTimeout)
+
+	r.Failover("video.mp4")
+	if last := r.failedOver["video.mp4"]; !last.After(first) {
+		t.Fatalf("Expected a new attempt once RelayIdleTimeout went by, but got %v", last)
+	}
+}
+
+func TestSameHost(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		remote  string
+		address string
+		same    bool
+	}{
+		{"server on its own host", "10.0.0.1:40312", "10.0.0.1:8080", true},
+		{"server on another host", "10.0.0.2:40312", "10.0.0.1:8080", false},
+		{"ipv4 mapped remote", "[::ffff:10.0.0.1]:40312", "10.0.0.1:8080", true},
+		{"invalid address", "10.0.0.1:40312", "server", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := sameHost(tt.remote, tt.address); same != tt.same {
+				t.Fatalf("Expected %v for '%v' and '%v', but got %v", tt.same, tt.remote, tt.address, same)
+			}
+		})
+	}
+}
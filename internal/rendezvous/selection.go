@@ -0,0 +1,276 @@
+package rendezvous
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// SelectionStrategy decides which of the servers holding a content is asked to stream it.
+type SelectionStrategy interface {
+	// Rank orders the candidate servers of contentName from the most preferred
+	// to the least, the request falls through to the next one on refusal.
+	Rank(contentName string, candidates []*ServerInfo) []*ServerInfo
+}
+
+// Strategy names, as accepted by ParseStrategy.
+const (
+	MetricsStrategyName        = "metrics"
+	LeastLoadedStrategyName    = "least-loaded"
+	RoundRobinStrategyName     = "round-robin"
+	WeightedRandomStrategyName = "weighted-random"
+	HashStrategyName           = "hash"
+)
+
+// ParseStrategy creates the strategy called name. weights is a comma separated list
+// of key=value pairs, the keys are 'latency', 'jitter' and 'loss' for the metrics
+// strategy and server addresses for the weighted random one, e.g. '10.0.0.1:5000=3'.
+// Other strategies take no weights.
+func ParseStrategy(name string, weights string) (SelectionStrategy, error) {
+
+	parsed, err := parseWeights(weights)
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+
+	case MetricsStrategyName, "":
+		s := NewMetricsStrategy()
+		for key, value := range parsed {
+			switch key {
+			case "latency":
+				s.Latency = value
+			case "jitter":
+				s.Jitter = value
+			case "loss":
+				s.Loss = value
+			default:
+				return nil, errors.New("unknown metric '" + key + "', expected latency, jitter or loss")
+			}
+		}
+		return s, nil
+
+	case LeastLoadedStrategyName:
+		return &LeastLoadedStrategy{}, nil
+
+	case RoundRobinStrategyName:
+		return &RoundRobinStrategy{}, nil
+
+	case WeightedRandomStrategyName:
+		return &WeightedRandomStrategy{Weights: parsed}, nil
+
+	case HashStrategyName:
+		return &HashStrategy{Replicas: DefaultReplicas}, nil
+	}
+
+	return nil, errors.New("unknown selection strategy '" + name + "'")
+}
+
+// parseWeights parses a 'key=value,key=value' list.
+func parseWeights(weights string) (map[string]float64, error) {
+
+	parsed := make(map[string]float64)
+	if weights == "" {
+		return parsed, nil
+	}
+
+	for _, pair := range strings.Split(weights, ",") {
+
+		key, value, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, errors.New("invalid weight '" + pair + "', expected key=value")
+		}
+
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil || weight < 0 {
+			return nil, errors.New("invalid weight '" + pair + "', expected a non negative number")
+		}
+
+		parsed[strings.TrimSpace(key)] = weight
+	}
+
+	return parsed, nil
+}
+
+// byAddress sorts the candidates by address, so that strategies not depending
+// on metrics see the same order regardless of the map iteration.
+func byAddress(candidates []*ServerInfo) []*ServerInfo {
+
+	sorted := append([]*ServerInfo{}, candidates...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Address < sorted[j].Address
+	})
+
+	return sorted
+}
+
+// MetricsStrategy prefers the servers with the lowest weighted sum of latency
+// and jitter (in seconds) and loss (from 0 to 1).
+type MetricsStrategy struct {
+	Latency float64
+	Jitter  float64
+	Loss    float64
+}
+
+// NewMetricsStrategy creates a MetricsStrategy with the default weights, a 100%
+// loss weighs as much as a second of latency.
+func NewMetricsStrategy() *MetricsStrategy {
+	return &MetricsStrategy{Latency: 0.6, Jitter: 0.4, Loss: 1}
+}
+
+// Score returns the weighted metrics of srv, lower is better.
+func (s *MetricsStrategy) Score(srv *ServerInfo) float64 {
+	m := srv.Measurements()
+	return s.Latency*m.Latency + s.Jitter*m.Jitter + s.Loss*m.Loss
+}
+
+func (s *MetricsStrategy) Rank(_ string, candidates []*ServerInfo) []*ServerInfo {
+
+	ranked := byAddress(candidates)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return s.Score(ranked[i]) < s.Score(ranked[j])
+	})
+
+	return ranked
+}
+
+// LeastLoadedStrategy prefers the servers using the least of their throughput
+// budget (or cpu when unlimited), then the ones with fewer destinations.
+type LeastLoadedStrategy struct{}
+
+// utilisation returns how busy srv is, from 0 to 1.
+func utilisation(srv *ServerInfo) float64 {
+
+	load := srv.CurrentLoad()
+	if load.Unlimited() {
+		return load.CPU
+	}
+
+	return load.Bitrate / load.Budget
+}
+
+func (s *LeastLoadedStrategy) Rank(_ string, candidates []*ServerInfo) []*ServerInfo {
+
+	ranked := byAddress(candidates)
+	sort.SliceStable(ranked, func(i, j int) bool {
+
+		ui, uj := utilisation(ranked[i]), utilisation(ranked[j])
+		if ui != uj {
+			return ui < uj
+		}
+
+		return ranked[i].CurrentLoad().Destinations < ranked[j].CurrentLoad().Destinations
+	})
+
+	return ranked
+}
+
+// RoundRobinStrategy rotates the preferred server on every request.
+type RoundRobinStrategy struct {
+	next atomic.Uint64
+}
+
+func (s *RoundRobinStrategy) Rank(_ string, candidates []*ServerInfo) []*ServerInfo {
+
+	sorted := byAddress(candidates)
+	if len(sorted) == 0 {
+		return sorted
+	}
+
+	start := int(s.next.Add(1)-1) % len(sorted)
+	return append(sorted[start:], sorted[:start]...)
+}
+
+// WeightedRandomStrategy picks the servers at random, proportionally to their
+// weight, by address. Servers without a weight have a weight of 1.
+type WeightedRandomStrategy struct {
+	Weights map[string]float64
+}
+
+func (s *WeightedRandomStrategy) Rank(_ string, candidates []*ServerInfo) []*ServerInfo {
+
+	ranked := byAddress(candidates)
+
+	// weighted random sampling without replacement, Efraimidis and Spirakis
+	keys := make(map[*ServerInfo]float64, len(ranked))
+	for _, srv := range ranked {
+
+		weight, exists := s.Weights[srv.Address]
+		if !exists {
+			weight = 1
+		}
+
+		if weight == 0 {
+			keys[srv] = math.Inf(-1) // never preferred
+			continue
+		}
+
+		keys[srv] = math.Log(rand.Float64()) / weight
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return keys[ranked[i]] > keys[ranked[j]]
+	})
+
+	return ranked
+}
+
+// DefaultReplicas is the number of points each server has in the hash ring.
+const DefaultReplicas = 64
+
+// HashStrategy maps each content to the same server through consistent hashing
+// of its name, so that the server caches stay warm. When a server is added or
+// removed only the contents mapped to it move.
+type HashStrategy struct {
+	Replicas int
+}
+
+func hash(s string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum32()
+}
+
+func (s *HashStrategy) Rank(contentName string, candidates []*ServerInfo) []*ServerInfo {
+
+	type point struct {
+		hash uint32
+		srv  *ServerInfo
+	}
+
+	ring := make([]point, 0, len(candidates)*s.Replicas)
+	for _, srv := range candidates {
+		for i := 0; i < s.Replicas; i++ {
+			ring = append(ring, point{hash(srv.Address + "#" + strconv.Itoa(i)), srv})
+		}
+	}
+
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+
+	target := hash(contentName)
+	start := sort.Search(len(ring), func(i int) bool {
+		return ring[i].hash >= target
+	})
+
+	// walk the ring clockwise from the content, the next distinct servers are the fallbacks
+	ranked := make([]*ServerInfo, 0, len(candidates))
+	seen := make(map[*ServerInfo]bool)
+	for i := 0; i < len(ring) && len(ranked) < len(candidates); i++ {
+
+		p := ring[(start+i)%len(ring)]
+		if !seen[p.srv] {
+			seen[p.srv] = true
+			ranked = append(ranked, p.srv)
+		}
+	}
+
+	return ranked
+}
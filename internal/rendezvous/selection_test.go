@@ -0,0 +1,131 @@
+package rendezvous
+
+import (
+	"testing"
+
+	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/server"
+)
+
+func servers(addrs ...string) []*ServerInfo {
+	srvs := make([]*ServerInfo, 0, len(addrs))
+	for _, addr := range addrs {
+		srvs = append(srvs, &ServerInfo{Address: addr})
+	}
+	return srvs
+}
+
+func addresses(srvs []*ServerInfo) []string {
+	addrs := make([]string, 0, len(srvs))
+	for _, srv := range srvs {
+		addrs = append(addrs, srv.Address)
+	}
+	return addrs
+}
+
+func TestMetricsStrategy(t *testing.T) {
+
+	srvs := servers("a", "b", "c")
+	srvs[0].Latency, srvs[1].Latency, srvs[2].Latency = 0.030, 0.010, 0.020
+	srvs[1].PacketLoss = 0.5 // 10ms + 500ms of loss penalty
+
+	ranked := addresses(NewMetricsStrategy().Rank("video.mp4", srvs))
+
+	expected := []string{"c", "a", "b"}
+	for i := range expected {
+		if ranked[i] != expected[i] {
+			t.Fatalf("Expected %v, but got %v", expected, ranked)
+		}
+	}
+}
+
+func TestRoundRobinStrategy(t *testing.T) {
+
+	s := &RoundRobinStrategy{}
+	srvs := servers("b", "a", "c")
+
+	for _, expected := range []string{"a", "b", "c", "a"} {
+		if first := s.Rank("video.mp4", srvs)[0].Address; first != expected {
+			t.Fatalf("Expected %v, but got %v", expected, first)
+		}
+	}
+}
+
+func TestHashStrategy(t *testing.T) {
+
+	s := &HashStrategy{Replicas: DefaultReplicas}
+
+	first := s.Rank("video.mp4", servers("a", "b", "c"))[0].Address
+	for i := 0; i < 10; i++ {
+		if again := s.Rank("video.mp4", servers("c", "b", "a"))[0].Address; again != first {
+			t.Fatalf("Expected %v, but got %v", first, again)
+		}
+	}
+
+	// removing another server keeps the content on the same one
+	var others []string
+	for _, addr := range []string{"a", "b", "c"} {
+		if addr != first {
+			others = append(others, addr)
+		}
+	}
+
+	if moved := s.Rank("video.mp4", servers(first, others[0]))[0].Address; moved != first {
+		t.Fatalf("Expected %v, but got %v", first, moved)
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+
+	s, err := ParseStrategy(MetricsStrategyName, "latency=1,loss=2")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	metrics := s.(*MetricsStrategy)
+	if metrics.Latency != 1 || metrics.Jitter != 0.4 || metrics.Loss != 2 {
+		t.Fatalf("Expected weights (1, 0.4, 2), but got %v", *metrics)
+	}
+
+	if _, err := ParseStrategy("fastest", ""); err == nil {
+		t.Fatalf("Expected an error for an unknown strategy, but got none")
+	}
+
+	if _, err := ParseStrategy(MetricsStrategyName, "latency"); err == nil {
+		t.Fatalf("Expected an error for a malformed weight, but got none")
+	}
+}
+
+func TestRankServersSkipsFull(t *testing.T) {
+
+	item := server.ConfigItem{
+		Name:       "movie.mp4",
+		Renditions: []server.Rendition{{Name: "1080p", Bitrate: 4000}, {Name: "360p", Bitrate: 800}},
+	}
+
+	full, free := NewServerInfo("10.0.0.20:5000"), NewServerInfo("10.0.0.21:5000")
+	for _, srv := range []*ServerInfo{full, free} {
+		srv.Content = []server.ConfigItem{item}
+		srv.setAvailable(true)
+	}
+	full.Load = server.Load{Budget: 5_000_000, Bitrate: 4_000_000, Remaining: 1_000_000}
+
+	r := &Rendezvous{Servers: Servers{full.Address: full, free.Address: free}, Strategy: NewMetricsStrategy()}
+
+	tests := []struct {
+		contentKey string
+		expected   int
+	}{
+		{packets.ContentKey("movie.mp4", "1080p"), 1}, // only fits in the free server
+		{packets.ContentKey("movie.mp4", "360p"), 2},
+		{packets.ContentKey("movie.mp4", ""), 1}, // the default rendition
+	}
+
+	for _, tt := range tests {
+
+		ranked := r.RankServers(tt.contentKey)
+		if len(ranked) != tt.expected || (tt.expected == 1 && ranked[0] != free) {
+			t.Fatalf("Expected %d servers for '%v', but got %v", tt.expected, tt.contentKey, addresses(ranked))
+		}
+	}
+}
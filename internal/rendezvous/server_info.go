@@ -1,12 +1,20 @@
 package rendezvous
 
 import (
+	"errors"
+	"github.com/gweebg/mcast/internal/metrics"
+	"github.com/gweebg/mcast/internal/packets"
 	"github.com/gweebg/mcast/internal/server"
+	"log"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ServerResponseTimeout is how long to wait for a server to answer a request.
+const ServerResponseTimeout = 5 * time.Second
+
 type Servers map[string]*ServerInfo
 
 // NewServers populate the Servers struct with the ServerInfo objects by passing
@@ -15,44 +23,318 @@ func NewServers(addrs []string) Servers {
 	srvs := make(Servers)
 
 	for _, addr := range addrs {
-		srvs[addr] = &ServerInfo{
-			Address:    addr,
-			Content:    make([]server.ConfigItem, 0),
-			TickerChan: make(chan bool),
-		}
+		srvs[addr] = NewServerInfo(addr)
 	}
 
 	return srvs
 }
 
+// NewServerInfo creates the ServerInfo of the server at addr, unavailable until connected.
+func NewServerInfo(addr string) *ServerInfo {
+	return &ServerInfo{
+		Address: addr,
+		Content: make([]server.ConfigItem, 0),
+		Metrics: metrics.NewEstimator(metrics.DefaultWindow, metrics.DefaultHistory),
+		pending: make(map[uint64]chan []byte),
+		done:    make(chan struct{}),
+	}
+}
+
 type ServerInfo struct {
 
 	// the address where the node will talk to the server.
 	Address string
 
-	// packet loss of the server.
-	PacketLoss uint64
-	// Jitter of the server.
+	// packet loss of the server, from 0 to 1.
+	PacketLoss float32
+	// Jitter of the server, in seconds.
 	Jitter float32
-	// Latency of the server.
+	// Latency of the server, the smoothed round trip time in seconds.
 	Latency float32
+	// Load reported by the server in its last pong.
+	Load server.Load
 	// Metric lock to prevent race conditions.
 	mMu sync.Mutex
 
+	// Metrics estimates the latency, jitter and loss from the probes sent to the server.
+	Metrics *metrics.Estimator
+	// sequence number of the last probe sent.
+	seq uint64
+	// consecutive unanswered probes.
+	missed int
+
+	// whether the control connection is up, see Rendezvous.link.
+	available atomic.Bool
+	// closed once the server deregisters, ends the link and the probing.
+	done     chan struct{}
+	doneOnce sync.Once
+
 	// which content the server has available.
 	Content []server.ConfigItem
 	// tcp connection to the server at Address.
 	Conn *net.TCPConn
+	// reads the packets framed on Conn, only used by the read loop.
+	receiver *packets.Receiver
 
+	// udp connection to the server at Address, metric probes are sent through it.
+	ProbeConn *net.UDPConn
 	// used to send metric packets once every 5 seconds
 	Ticker *time.Ticker
-	// needed to stop the ticker on teardown
-	TickerChan chan bool
+
+	// Conn mutex, the connection is replaced when the server is reconnected.
+	control sync.Mutex
+
+	// id of the last request sent to the server.
+	lastId atomic.Uint64
+	// requests waiting for their response, by id, responses are read from Conn by the read loop.
+	pending map[uint64]chan []byte
+	// pending mutex.
+	pMu sync.Mutex
+}
+
+// Available checks whether the server is connected and can be selected.
+func (s *ServerInfo) Available() bool {
+	return s.available.Load()
+}
+
+func (s *ServerInfo) setAvailable(available bool) {
+	if s.available.Swap(available) != available {
+		log.Printf("(server %v) available=%v\n", s.Address, available)
+	}
+}
+
+// remove marks the server as gone, its connections are closed and no longer retried.
+func (s *ServerInfo) remove() {
+	s.doneOnce.Do(func() {
+		close(s.done)
+		s.setAvailable(false)
+
+		s.control.Lock()
+		defer s.control.Unlock()
+
+		if s.Conn != nil {
+			_ = s.Conn.Close()
+		}
+	})
+}
+
+// disconnect closes the control connection once it is lost, so it is not leaked
+// when the server is reconnected.
+func (s *ServerInfo) disconnect() {
+
+	s.control.Lock()
+	defer s.control.Unlock()
+
+	if s.Conn != nil {
+		_ = s.Conn.Close()
+		s.Conn = nil
+	}
+}
+
+// removed checks whether the server was removed.
+func (s *ServerInfo) removed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// send writes an encoded packet to the server.
+func (s *ServerInfo) send(data []byte) error {
+
+	s.control.Lock()
+	defer s.control.Unlock()
+
+	if s.Conn == nil {
+		return errors.New("server is not connected")
+	}
+
+	return packets.Send(s.Conn, data)
+}
+
+// expect registers a new request, returning its id and the channel its response is delivered to.
+func (s *ServerInfo) expect() (uint64, chan []byte) {
+
+	id := s.lastId.Add(1)
+	response := make(chan []byte, 1)
+
+	s.pMu.Lock()
+	s.pending[id] = response
+	s.pMu.Unlock()
+
+	return id, response
+}
+
+// forget stops waiting for the response to the request id.
+func (s *ServerInfo) forget(id uint64) {
+	s.pMu.Lock()
+	defer s.pMu.Unlock()
+
+	delete(s.pending, id)
+}
+
+// deliver hands the response data to the request it answers, responses to requests
+// no longer waiting, e.g. that timed out, are discarded.
+func (s *ServerInfo) deliver(id uint64, data []byte) {
+
+	s.pMu.Lock()
+	response, exists := s.pending[id]
+	delete(s.pending, id)
+	s.pMu.Unlock()
+
+	if !exists {
+		log.Printf("(server %v) discarding response to request %d, no longer waiting\n", s.Address, id)
+		return
+	}
+
+	response <- data // buffered, a request gets a single response
 }
 
-// CalculateMetrics calculates the general metrics of a server, the Latency is given
-// a weight of 60% while the Jitter is given a weight of 40%. Packet loss is not accounted
-// for the metrics calculation, yet.
-func (s *ServerInfo) CalculateMetrics() float32 {
-	return ((s.Latency * 0.6) + (s.Jitter * 0.4)) / 100
+// dropPending fails the requests waiting for a response from a previous connection.
+func (s *ServerInfo) dropPending() {
+
+	s.pMu.Lock()
+	defer s.pMu.Unlock()
+
+	for id, response := range s.pending {
+		close(response)
+		delete(s.pending, id)
+	}
+}
+
+// Response waits, up to timeout, for the response delivered to the channel of a request.
+func (s *ServerInfo) Response(response chan []byte, timeout time.Duration) ([]byte, error) {
+	select {
+	case data, ok := <-response:
+		if !ok {
+			return nil, errors.New("connection lost waiting for a response")
+		}
+		return data, nil
+
+	case <-time.After(timeout):
+		return nil, errors.New("timed out waiting for a response")
+	}
+}
+
+// probe sends a timestamped 'PING' to the server and waits for its pong, feeding
+// the outcome to Metrics. Pongs of earlier probes that arrive late are discarded.
+func (s *ServerInfo) probe() {
+
+	s.seq++
+	sent := time.Now()
+
+	packet, err := packets.Encode[packets.Probe](packets.Ping(packets.Probe{Seq: s.seq, Timestamp: sent.UnixNano()}))
+	if err != nil {
+		log.Printf("(metrics %v) cannot encode ping\n", s.Address)
+		return
+	}
+
+	if _, err = s.ProbeConn.Write(packet); err != nil {
+		log.Printf("(metrics %v) cannot send ping\n", s.Address)
+		s.Metrics.Lost(s.seq, sent)
+		s.missed++
+		s.update()
+		return
+	}
+
+	err = s.ProbeConn.SetReadDeadline(sent.Add(ServerResponseTimeout))
+	if err != nil {
+		log.Printf("(metrics %v) cannot set probe deadline\n", s.Address)
+		return
+	}
+
+	buffer := make([]byte, 1024)
+	for {
+
+		n, err := s.ProbeConn.Read(buffer)
+		if err != nil {
+			log.Printf("(metrics %v) no pong received for probe %d\n", s.Address, s.seq)
+			s.Metrics.Lost(s.seq, sent)
+			s.missed++
+			s.update()
+			return
+		}
+
+		received := time.Now()
+
+		pong, err := packets.Decode[server.Echo](buffer[:n])
+		if err != nil {
+			log.Printf("(metrics %v) malformed pong, ignoring...\n", s.Address)
+			continue
+		}
+
+		if pong.Payload.Probe.Seq != s.seq {
+			continue
+		} // late pong of a probe already accounted as lost
+
+		rtt := received.Sub(time.Unix(0, pong.Payload.Probe.Timestamp))
+		s.Metrics.Received(s.seq, sent, rtt)
+		s.missed = 0
+
+		s.mMu.Lock()
+		s.Load = pong.Payload.Load
+		s.mMu.Unlock()
+
+		s.update()
+		return
+	}
+}
+
+// Missed returns the number of consecutive unanswered probes, only meant to
+// be called from the probing goroutine.
+func (s *ServerInfo) Missed() int {
+	return s.missed
+}
+
+// update copies the current estimates of Metrics to the metric fields.
+func (s *ServerInfo) update() {
+
+	stats := s.Metrics.Stats()
+
+	s.mMu.Lock()
+	s.Latency = float32(stats.RTT.Seconds())
+	s.Jitter = float32(stats.Jitter.Seconds())
+	s.PacketLoss = float32(stats.Loss)
+	load := s.Load
+	s.mMu.Unlock()
+
+	log.Printf("(metrics %v) rtt=%v jitter=%v loss=%.2f streams=%d bitrate=%.0fkbps cpu=%.0f%%\n",
+		s.Address, stats.RTT, stats.Jitter, stats.Loss, load.Streams, load.Bitrate/1000, load.CPU*100)
+}
+
+// History returns the probe samples of the server since since, oldest first.
+func (s *ServerInfo) History(since time.Time) []metrics.Sample {
+	return s.Metrics.History(since)
+}
+
+// CurrentLoad returns the load reported by the server in its last pong.
+func (s *ServerInfo) CurrentLoad() server.Load {
+	s.mMu.Lock()
+	defer s.mMu.Unlock()
+
+	return s.Load
+}
+
+// Measurements holds the metrics of a server, see ServerInfo.Measurements.
+type Measurements struct {
+	// Latency is the smoothed round trip time, in seconds.
+	Latency float64
+	// Jitter is the interarrival jitter, in seconds.
+	Jitter float64
+	// Loss is the ratio of lost probes, from 0 to 1.
+	Loss float64
+}
+
+// Measurements returns the current metrics of the server.
+func (s *ServerInfo) Measurements() Measurements {
+	s.mMu.Lock()
+	defer s.mMu.Unlock()
+
+	return Measurements{
+		Latency: float64(s.Latency),
+		Jitter:  float64(s.Jitter),
+		Loss:    float64(s.PacketLoss),
+	}
 }
@@ -0,0 +1,54 @@
+package rendezvous
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestResponsesRoutedById(t *testing.T) {
+
+	srv := NewServerInfo("127.0.0.1:5000")
+
+	first, firstResponse := srv.expect()
+	second, secondResponse := srv.expect()
+
+	if first == second {
+		t.Fatalf("Expected different request ids, but got %d twice", first)
+	}
+
+	// answered out of order, as the server handles requests concurrently
+	srv.deliver(second, []byte("second"))
+	srv.deliver(first, []byte("first"))
+
+	data, err := srv.Response(firstResponse, time.Second)
+	if err != nil || !bytes.Equal(data, []byte("first")) {
+		t.Fatalf("Expected 'first', but got '%s' (%v)", data, err)
+	}
+
+	data, err = srv.Response(secondResponse, time.Second)
+	if err != nil || !bytes.Equal(data, []byte("second")) {
+		t.Fatalf("Expected 'second', but got '%s' (%v)", data, err)
+	}
+}
+
+func TestLateResponseDiscarded(t *testing.T) {
+
+	srv := NewServerInfo("127.0.0.1:5000")
+
+	late, lateResponse := srv.expect()
+	srv.forget(late) // timed out
+
+	srv.deliver(late, []byte("late"))
+
+	if _, err := srv.Response(lateResponse, 10*time.Millisecond); err == nil {
+		t.Fatalf("Expected the late response to be discarded, but it was delivered")
+	}
+
+	id, response := srv.expect()
+	srv.dropPending() // connection lost
+
+	if _, err := srv.Response(response, time.Second); err == nil {
+		t.Fatalf("Expected request %d to fail once the connection is lost, but got no error", id)
+	}
+}
@@ -0,0 +1,187 @@
+package rendezvous
+
+import (
+	"log"
+	"net"
+	"time"
+
+	"github.com/gweebg/mcast/internal/node"
+	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/utils"
+)
+
+// subscriptionWatchInterval is how often the subscriptions are checked for expiry.
+const subscriptionWatchInterval = time.Second
+
+// subscription returns the relay for contentKey and the address remote receives it at,
+// at port if remote chose one, renewing the subscription if remote is already subscribed.
+func (r *Rendezvous) subscription(contentKey string, remote string, port string) (*node.Relay, string, bool) {
+
+	r.rMu.RLock()
+	defer r.rMu.RUnlock()
+
+	relay, exists := r.RelayPool[contentKey]
+	if !exists {
+		return nil, "", false
+	}
+
+	address := relay.AddressOf(remote, port)
+	return relay, address, relay.Renew(address)
+}
+
+// building returns a channel closed once the relay for contentKey, being set up by
+// another request, is ready (or failed to be). Returns nil when no relay is being set up
+// for contentKey nor exists, the caller then sets it up and must call built once done.
+func (r *Rendezvous) building(contentKey string) <-chan struct{} {
+
+	r.rMu.Lock()
+	defer r.rMu.Unlock()
+
+	if ready, exists := r.setups[contentKey]; exists {
+		return ready
+	}
+
+	if _, exists := r.RelayPool[contentKey]; exists {
+		ready := make(chan struct{})
+		close(ready)
+		return ready
+	} // set up since the caller last looked
+
+	r.setups[contentKey] = make(chan struct{})
+	return nil
+}
+
+// built wakes the requests waiting for the relay for contentKey, see building.
+func (r *Rendezvous) built(contentKey string) {
+
+	r.rMu.Lock()
+	defer r.rMu.Unlock()
+
+	if ready, exists := r.setups[contentKey]; exists {
+		close(ready)
+		delete(r.setups, contentKey)
+	}
+}
+
+// OnLeave ends the subscription of remote to a content, the relay is released by
+// watchSubscriptions once it lingers without subscribers.
+func (r *Rendezvous) OnLeave(incoming packets.Packet, conn net.Conn) {
+
+	remote := conn.RemoteAddr().String()
+
+	contentKey := incoming.Payload.Key()
+	if rendition, offered := r.Rendition(incoming.Payload.ContentName, incoming.Payload.Rendition); offered {
+		contentKey = packets.ContentKey(incoming.Payload.ContentName, rendition)
+	} // as kept by OnStream
+
+	log.Printf("(handling %v) received 'LEAVE' packet for content '%v'\n", remote, contentKey)
+
+	defer func() {
+		utils.CloseConnection(conn, remote)
+		log.Printf("(handling %v) closed connection, reason 'termination'\n", remote)
+	}()
+
+	reply(incoming, conn) // acknowledge, leaving never fails for the subscriber
+
+	r.rMu.RLock()
+	relay, exists := r.RelayPool[contentKey]
+	r.rMu.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	left, err := relay.Remove(relay.AddressOf(remote, incoming.Payload.Port))
+	if err != nil {
+		log.Printf("(handling %v) %v\n", remote, err)
+		return
+	}
+
+	log.Printf("(handling %v) left '%v', %d subscribers left\n", remote, contentKey, left)
+}
+
+// watchSubscriptions expires the subscriptions that were not renewed and releases
+// the relays that had no subscribers for Linger.
+func (r *Rendezvous) watchSubscriptions() {
+
+	ticker := time.NewTicker(subscriptionWatchInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+
+		r.rMu.RLock()
+		relays := make(map[string]*node.Relay, len(r.RelayPool))
+		for contentKey, relay := range r.RelayPool {
+			relays[contentKey] = relay
+		}
+		r.rMu.RUnlock()
+
+		for contentKey, relay := range relays {
+
+			for _, address := range relay.Expire(node.SubscriptionTTL) {
+				log.Printf("(subscriptions) subscription of '%v' to '%v' expired\n", address, contentKey)
+			}
+
+			if r.lingered(contentKey, relay) {
+				r.release(contentKey, relay)
+			}
+		}
+	}
+}
+
+// lingered checks whether relay has had no subscribers for Linger.
+func (r *Rendezvous) lingered(contentKey string, relay *node.Relay) bool {
+
+	r.rMu.Lock()
+	defer r.rMu.Unlock()
+
+	if relay.Subscribers() > 0 {
+		delete(r.idleSince, contentKey)
+		return false
+	}
+
+	since, exists := r.idleSince[contentKey]
+	if !exists {
+		r.idleSince[contentKey] = time.Now()
+		log.Printf("(subscriptions) relay of '%v' has no subscribers, lingering for %v\n", contentKey, r.Linger)
+		return false
+	}
+
+	return time.Since(since) >= r.Linger
+}
+
+// release asks the server of contentKey to stop streaming it, tears down its relay
+// and frees the relay's port.
+func (r *Rendezvous) release(contentKey string, relay *node.Relay) {
+
+	r.rMu.Lock()
+	if r.RelayPool[contentKey] != relay || relay.Subscribers() > 0 {
+		r.rMu.Unlock()
+		return
+	} // replaced or subscribed to in the meantime
+
+	delete(r.RelayPool, contentKey)
+	delete(r.idleSince, contentKey)
+	r.rMu.Unlock()
+
+	if svr, exists := r.Origin(contentKey); exists {
+		r.stopServer(svr, contentKey)
+		log.Printf("(subscriptions) sent 'STOP' for '%v' to '%v'\n", contentKey, svr.Address)
+	}
+
+	r.rMu.Lock()
+	delete(r.origins, contentKey)
+	r.rMu.Unlock()
+
+	r.fMu.Lock()
+	delete(r.failedOver, contentKey)
+	r.fMu.Unlock()
+
+	if err := relay.Stop(); err != nil {
+		log.Printf("(subscriptions) cannot stop relay of '%v': %v\n", contentKey, err)
+	}
+
+	r.releaseRelayPorts(relay)
+
+	log.Printf("(subscriptions) released relay of '%v', no subscribers for %v\n", contentKey, r.Linger)
+}
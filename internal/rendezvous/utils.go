@@ -1,12 +1,60 @@
 package rendezvous
 
-import "github.com/gweebg/mcast/internal/server"
+import (
+	"net"
+	"strconv"
 
+	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/server"
+)
+
+// Contains checks whether the catalog s has the content str, which may be a
+// content reference (see packets.ContentRef) in which case the id must match too.
 func Contains(s []server.ConfigItem, str string) bool {
+	_, exists := Find(s, str)
+	return exists
+}
+
+// Find returns the item of the catalog s with the content str, matched as in Contains.
+func Find(s []server.ConfigItem, str string) (server.ConfigItem, bool) {
+
+	name, id := packets.SplitContentRef(str)
+
 	for _, v := range s {
-		if v.Name == str {
-			return true
+		if v.Name == name && (id == "" || v.Id == id) {
+			return v, true
 		}
 	}
-	return false
+	return server.ConfigItem{}, false
+}
+
+// portOf returns the port of address, 0 when it has none.
+func portOf(address string) uint64 {
+
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return 0
+	}
+
+	p, err := strconv.ParseUint(port, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return p
+}
+
+// sameHost checks whether remote, the address of a connection, is on the host of address.
+func sameHost(remote string, address string) bool {
+
+	from, err := net.ResolveTCPAddr("tcp", remote)
+	if err != nil {
+		return false
+	}
+
+	to, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return false
+	}
+
+	return from.IP.Equal(to.IP)
 }
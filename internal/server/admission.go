@@ -0,0 +1,34 @@
+package server
+
+import "github.com/gweebg/mcast/internal/packets"
+
+// Required returns the bitrate, in bits per second, that streaming contentKey to
+// one more destination would add to the outgoing throughput of the server. Content
+// already being streamed uses its measured bitrate, new content its estimated one.
+func (s *Server) Required(contentKey string) float64 {
+
+	if stmr, err := s.ConnectionPool.Get(contentKey); err == nil {
+		return stmr.Bitrate()
+	}
+
+	contentName, rendition := packets.SplitContentKey(contentKey)
+
+	item, exists := s.Catalog().Find(contentName)
+	if !exists {
+		return float64(DefaultBitrate) * 1000
+	}
+
+	return float64(item.EstimatedBitrate(rendition)) * 1000
+}
+
+// Admit checks whether contentKey can be streamed to one more destination
+// without exceeding the configured throughput.
+func (s *Server) Admit(contentKey string) bool {
+
+	budget := s.Catalog().Throughput
+	if budget == 0 {
+		return true
+	} // unlimited
+
+	return s.ConnectionPool.Throughput()+s.Required(contentKey) <= float64(budget)*1000
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/streamer"
+	"github.com/gweebg/mcast/internal/utils"
+)
+
+// ConfigPollInterval is how often the configuration file is checked for changes.
+const ConfigPollInterval = 2 * time.Second
+
+// Catalog returns the current configuration of the server.
+func (s *Server) Catalog() Config {
+	s.cMu.RLock()
+	defer s.cMu.RUnlock()
+
+	return s.Config
+}
+
+// startIngests starts receiving the live channels of config that are not running yet.
+func (s *Server) startIngests(config Config) error {
+
+	s.cMu.Lock()
+	defer s.cMu.Unlock()
+
+	for _, item := range config.Content {
+
+		if !item.IsLive() {
+			continue
+		}
+
+		if _, running := s.Ingests[item.Name]; running {
+			continue
+		}
+
+		ingest, err := streamer.NewIngest(item.Name, item.Ingest)
+		if err != nil {
+			return err
+		}
+
+		s.Ingests[item.Name] = ingest
+		go ingest.Run() // live channels receive even without viewers
+	}
+
+	return nil
+}
+
+// stopIngests stops the live channels that are no longer in config, their viewers'
+// streams end. Must be called with cMu locked.
+func (s *Server) stopIngests(config Config) {
+
+	for name, ingest := range s.Ingests {
+
+		if item, exists := config.Find(name); exists && item.IsLive() {
+			continue
+		}
+
+		ingest.Stop()
+		delete(s.Ingests, name)
+
+		log.Printf("(reload) stopped ingest of removed channel '%v'\n", name)
+	}
+}
+
+// Reload parses and validates the configuration file again, on success the new
+// catalog replaces the current one and is pushed to every known rendezvous point.
+// Only the files added or modified since the last reload are probed and hashed.
+// On failure the current catalog is kept.
+func (s *Server) Reload() {
+
+	config, err := utils.ParseJson[Config](s.ConfigPath, ValidateConfig)
+	if err != nil {
+		log.Printf("(reload) keeping current catalog, new one is invalid: %v\n", err)
+		return
+	}
+
+	config = Identify(ScanDirectories(config, s.files), s.Address.String(), s.files)
+
+	if err := s.startIngests(config); err != nil {
+		log.Printf("(reload) keeping current catalog, cannot start ingest: %v\n", err)
+		return
+	}
+
+	s.cMu.Lock()
+	s.Config = config
+	s.stopIngests(config)
+	s.cMu.Unlock()
+
+	s.files.Sweep() // forget the files that are gone
+
+	log.Printf("(reload) catalog reloaded from '%v', %d items\n", s.ConfigPath, len(config.Content))
+	s.pushCatalog(config.Content)
+}
+
+// pushCatalog sends an unsolicited 'UPDT' packet with the catalog to every rendezvous
+// point, forgetting the ones that can no longer be written to.
+func (s *Server) pushCatalog(content []ConfigItem) {
+
+	encPac, err := packets.Encode[[]ConfigItem](CatalogUpdatePacket(content))
+	utils.Check(err)
+
+	s.rMu.Lock()
+	defer s.rMu.Unlock()
+
+	for remote, conn := range s.Rendezvous {
+
+		if err := packets.Send(conn, encPac); err != nil {
+			log.Printf("(handling %v) cannot push catalog, forgetting rendezvous\n", remote)
+			delete(s.Rendezvous, remote)
+			continue
+		}
+
+		log.Printf("(handling %v) pushed packet 'UPDT' (%d bytes)\n", remote, len(encPac))
+	}
+}
+
+// Watch reloads the catalog whenever the configuration file or one of the
+// scanned directories is modified, or the process receives SIGHUP.
+func (s *Server) Watch() {
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(ConfigPollInterval)
+	defer ticker.Stop()
+
+	lastModified := s.lastModified()
+
+	for {
+		select {
+
+		case <-hup:
+			log.Printf("(reload) received SIGHUP\n")
+			lastModified = s.lastModified()
+			s.Reload()
+
+		case <-ticker.C:
+			modified := s.lastModified()
+			if modified.Equal(lastModified) {
+				continue
+			}
+
+			log.Printf("(reload) '%v' or its directories were modified\n", s.ConfigPath)
+			lastModified = modified
+			s.Reload()
+		}
+	}
+}
+
+// lastModified returns the latest modification time among the configuration file,
+// the scanned directories (including their subdirectories) and the video files in them.
+// Files replaced in place only change their own modification time, not the directory's.
+func (s *Server) lastModified() time.Time {
+
+	latest := modTime(s.ConfigPath)
+
+	for _, dir := range s.Catalog().Directories {
+		_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && (d.IsDir() || isVideo(path)) {
+				if m := modTime(path); m.After(latest) {
+					latest = m
+				}
+			}
+			return nil
+		})
+	}
+
+	return latest
+}
+
+// modTime returns the modification time of path, zero if it cannot be read.
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -1,19 +1,177 @@
 package server
 
 import (
+	"log"
 	"os"
+	"path/filepath"
+
+	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/streamer"
+)
+
+const (
+	// DefaultBitrate is the bitrate, in kilobits per second, assumed for content
+	// with no declared bitrate nor resolution.
+	DefaultBitrate uint = 4000
+	// BitsPerPixel is the average number of bits per pixel of an encoded frame,
+	// used to estimate the bitrate of content from its resolution and frame rate.
+	BitsPerPixel = 0.1
 )
 
+// Rendition is one of the qualities a content is available in, each rendition
+// is a pre-encoded transport stream.
+type Rendition struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Width  uint   `json:"width"`
+	Height uint   `json:"height"`
+	FPS    uint   `json:"fps"`
+	// Bitrate of the rendition in kilobits per second, 0 when unknown.
+	Bitrate uint `json:"bitrate,omitempty"`
+}
+
 type ConfigItem struct {
-	Name   string
+	Name string
+	// Id identifies the content across servers, set by Identify when not configured.
+	Id     string `json:"id,omitempty"`
 	Width  uint
 	Height uint
 	FPS    uint
+
+	// Duration of the content in seconds, 0 when unknown or live.
+	Duration float64 `json:"duration,omitempty"`
+	// Bitrate of the content in kilobits per second, 0 when unknown.
+	Bitrate uint `json:"bitrate,omitempty"`
+
+	// Source names the kind of source the content is streamed from, see streamer.SourceKind.
+	// When empty defaults to 'live' if Ingest is set, 'ffmpeg' otherwise.
+	Source streamer.SourceKind `json:"source,omitempty"`
+	// Ingest is set for live channels, see streamer.ParseIngest for the format.
+	Ingest string `json:"ingest,omitempty"`
+	// Generator is the name of the generator used by 'generator' sources.
+	Generator string `json:"generator,omitempty"`
+
+	// Renditions lists the qualities the content is available in, the first one is
+	// the default. When empty the content has a single rendition, described by the item.
+	Renditions []Rendition `json:"renditions,omitempty"`
+}
+
+// Rendition returns the rendition with name, the default one when name is empty.
+// Returns false if the item has no renditions or none with name.
+func (c ConfigItem) Rendition(name string) (Rendition, bool) {
+
+	if len(c.Renditions) == 0 {
+		return Rendition{}, false
+	}
+
+	if name == "" {
+		return c.Renditions[0], true
+	}
+
+	for _, r := range c.Renditions {
+		if r.Name == name {
+			return r, true
+		}
+	}
+
+	return Rendition{}, false
+}
+
+// Offers checks whether the item can be streamed in the rendition name, items
+// without renditions only in the default one.
+func (c ConfigItem) Offers(name string) bool {
+	if name == "" {
+		return true
+	}
+
+	_, exists := c.Rendition(name)
+	return exists
+}
+
+// DefaultRendition returns the name of the default rendition, empty when the
+// item has no renditions.
+func (c ConfigItem) DefaultRendition() string {
+	if len(c.Renditions) == 0 {
+		return ""
+	}
+	return c.Renditions[0].Name
+}
+
+// NormalizedKey returns the content key of the item in rendition, the empty
+// rendition being replaced by the default one, so that both share a stream.
+func (c ConfigItem) NormalizedKey(contentName string, rendition string) string {
+	if rendition == "" {
+		rendition = c.DefaultRendition()
+	}
+	return packets.ContentKey(contentName, rendition)
+}
+
+// EstimatedBitrate returns the bitrate of the rendition (or the item) in kilobits
+// per second. When it is not declared it is estimated from the resolution and
+// frame rate, falling back to DefaultBitrate.
+func (c ConfigItem) EstimatedBitrate(rendition string) uint {
+
+	width, height, fps, bitrate := c.Width, c.Height, c.FPS, c.Bitrate
+	if r, exists := c.Rendition(rendition); exists {
+		width, height, fps, bitrate = r.Width, r.Height, r.FPS, r.Bitrate
+	}
+
+	if bitrate > 0 {
+		return bitrate
+	}
+
+	if width > 0 && height > 0 && fps > 0 {
+		return uint(float64(width*height*fps) * BitsPerPixel / 1000)
+	}
+
+	return DefaultBitrate
+}
+
+// SourceKind returns the kind of source of the content, resolving the defaults.
+func (c ConfigItem) SourceKind() streamer.SourceKind {
+
+	if c.Source != "" {
+		return c.Source
+	}
+
+	if c.Ingest != "" {
+		return streamer.LiveSourceKind
+	}
+
+	return streamer.TranscodeSourceKind
+}
+
+// IsLive checks whether the content is a live channel instead of a file.
+func (c ConfigItem) IsLive() bool {
+	return c.SourceKind() == streamer.LiveSourceKind
 }
 
 type Config struct {
-	Content    []ConfigItem `json:"content"`
-	Throughput uint         `json:"throughput"`
+	Content []ConfigItem `json:"content"`
+	// Throughput is the uplink budget of the server in kilobits per second, shared
+	// by every stream. Requests that would exceed it are refused, 0 means unlimited.
+	Throughput uint `json:"throughput"`
+
+	// Directories are scanned for video files, which are added to Content, see ScanDirectories.
+	Directories []string `json:"directories,omitempty"`
+}
+
+// Find returns the content item with name, which may be given without its directory.
+// The name may be a content reference (see packets.ContentRef), its id must match as well.
+func (c Config) Find(name string) (ConfigItem, bool) {
+
+	name, id := packets.SplitContentRef(name)
+
+	for _, item := range c.Content {
+		if id != "" && item.Id != id {
+			continue
+		}
+		if item.Name == name || filepath.Base(item.Name) == name {
+			return item, true
+		}
+	}
+
+	return ConfigItem{}, false
 }
 
 func fileExists(path string) bool {
@@ -28,7 +186,44 @@ func fileExists(path string) bool {
 func ValidateConfig(obj Config) bool {
 
 	for _, val := range obj.Content {
-		if !fileExists(val.Name) {
+
+		if val.Id != "" && !packets.ValidId(val.Id) {
+			log.Printf("invalid id '%v' for content '%v', expected %d hex characters\n", val.Id, val.Name, packets.IdLength)
+			return false
+		} // could not be told apart from the content name in a reference
+
+		for _, r := range val.Renditions {
+			if !fileExists(r.Path) {
+				log.Printf("rendition '%v' of '%v' not found at '%v'\n", r.Name, val.Name, r.Path)
+				return false
+			}
+		}
+
+		if len(val.Renditions) > 0 {
+			continue
+		} // the renditions are what gets streamed
+
+		switch val.SourceKind() {
+
+		case streamer.LiveSourceKind:
+			if _, _, err := streamer.ParseIngest(val.Ingest); err != nil {
+				log.Printf("invalid ingest for live content '%v': %v\n", val.Name, err)
+				return false
+			}
+
+		case streamer.GeneratorSourceKind:
+			if !streamer.GeneratorExists(val.Generator) {
+				log.Printf("unknown generator '%v' for content '%v'\n", val.Generator, val.Name)
+				return false
+			}
+
+		case streamer.FileSourceKind, streamer.TranscodeSourceKind:
+			if !fileExists(val.Name) {
+				return false
+			}
+
+		default:
+			log.Printf("unknown source '%v' for content '%v'\n", val.Source, val.Name)
 			return false
 		}
 	}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"log"
+	"net"
+	"net/netip"
+
+	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/utils"
+)
+
+// ServeProbes answers the metric probes ('PING') sent by the rendezvous points via udp,
+// on the same port as the tcp control connections. Probing on its own channel
+// keeps the probes from interleaving with the control packets.
+func (s *Server) ServeProbes() {
+
+	lAddr := netip.AddrPortFrom(netip.IPv4Unspecified(), s.Address.Port())
+
+	conn, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(lAddr))
+	utils.Check(err)
+	defer conn.Close()
+
+	log.Printf("(echo) answering probes at '%v'\n", lAddr)
+
+	buffer := make([]byte, 1024)
+	for {
+
+		n, remote, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			log.Printf("(echo) cannot read probe: %v\n", err)
+			continue
+		}
+
+		p, err := packets.Decode[packets.Probe](buffer[:n])
+		if err != nil || !p.Header.Flag.OnlyHasFlag(packets.PING) {
+			log.Printf("(echo %v) malformed probe, ignoring...\n", remote)
+			continue
+		}
+
+		s.OnPing(conn, remote, p)
+	}
+}
+
+// OnPing function answers with Pong to Ping requests, used
+// in metrics measurements by the clients, such as latency,
+// jitter and packet loss. The Pong echoes the probe of the Ping
+// and carries the server Load.
+func (s *Server) OnPing(conn *net.UDPConn, remote *net.UDPAddr, p packets.BasePacket[packets.Probe]) {
+
+	encPack, err := packets.Encode[Echo](Pong(p.Payload, s.Load()))
+	utils.Check(err)
+
+	_, err = conn.WriteToUDP(encPack, remote)
+	if err != nil {
+		log.Printf("(echo %v) cannot respond with pong to rendezvous point\n", remote)
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gweebg/mcast/internal/streamer"
+)
+
+// cached is a value computed from files, valid as long as their stamp is the same.
+type cached[T any] struct {
+	stamp string
+	value T
+	used  bool
+}
+
+// FileCache keeps the probe results and the ids of the files of the catalog, so that
+// reloading it only probes and hashes the files that were added or modified.
+type FileCache struct {
+	mu     sync.Mutex
+	probes map[string]cached[streamer.ProbeInfo]
+	ids    map[string]cached[string]
+}
+
+func NewFileCache() *FileCache {
+	return &FileCache{
+		probes: make(map[string]cached[streamer.ProbeInfo]),
+		ids:    make(map[string]cached[string]),
+	}
+}
+
+// Probe returns the properties of the video file at path, see streamer.Probe.
+// Failures are not cached, the file may still be being written.
+func (c *FileCache) Probe(path string) (streamer.ProbeInfo, error) {
+
+	if c == nil {
+		return streamer.Probe(path)
+	}
+
+	stamp, err := stampOf(path)
+	if err != nil {
+		return streamer.ProbeInfo{}, err
+	}
+
+	c.mu.Lock()
+	entry, exists := c.probes[path]
+	c.mu.Unlock()
+
+	if !exists || entry.stamp != stamp {
+		info, err := streamer.Probe(path)
+		if err != nil {
+			return streamer.ProbeInfo{}, err
+		}
+		entry = cached[streamer.ProbeInfo]{stamp: stamp, value: info}
+	}
+
+	entry.used = true
+
+	c.mu.Lock()
+	c.probes[path] = entry
+	c.mu.Unlock()
+
+	return entry.value, nil
+}
+
+// ContentId returns the id of a content item of the server at origin, see ContentId.
+// Only the ids of items backed by files are cached, the others are not hashed.
+func (c *FileCache) ContentId(item ConfigItem, origin string) (string, error) {
+
+	paths := filesOf(item)
+	if c == nil || len(paths) == 0 {
+		return ContentId(item, origin)
+	}
+
+	stamp, err := stampOf(paths...)
+	if err != nil {
+		return "", err
+	}
+
+	key := item.Name + "\x00" + strings.Join(paths, "\x00")
+	for _, r := range item.Renditions {
+		key += "\x00" + r.Name
+	} // renditions are part of the id
+
+	c.mu.Lock()
+	entry, exists := c.ids[key]
+	c.mu.Unlock()
+
+	if !exists || entry.stamp != stamp {
+		id, err := ContentId(item, origin)
+		if err != nil {
+			return "", err
+		}
+		entry = cached[string]{stamp: stamp, value: id}
+	}
+
+	entry.used = true
+
+	c.mu.Lock()
+	c.ids[key] = entry
+	c.mu.Unlock()
+
+	return entry.value, nil
+}
+
+// Sweep forgets the files that were not looked up since the last sweep, which are
+// no longer in the catalog.
+func (c *FileCache) Sweep() {
+
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sweep(c.probes)
+	sweep(c.ids)
+}
+
+func sweep[T any](entries map[string]cached[T]) {
+	for key, entry := range entries {
+		if !entry.used {
+			delete(entries, key)
+			continue
+		}
+		entry.used = false
+		entries[key] = entry
+	}
+}
+
+// filesOf returns the paths of the files an item is identified by, none when it is not backed by files.
+func filesOf(item ConfigItem) []string {
+
+	if len(item.Renditions) > 0 {
+		paths := make([]string, 0, len(item.Renditions))
+		for _, r := range item.Renditions {
+			paths = append(paths, r.Path)
+		}
+		return paths
+	}
+
+	switch item.SourceKind() {
+	case streamer.FileSourceKind, streamer.TranscodeSourceKind:
+		return []string{item.Name}
+	}
+
+	return nil
+}
+
+// stampOf returns the size and modification time of the files at paths, it changes
+// whenever one of them is modified.
+func stampOf(paths ...string) (string, error) {
+
+	var stamp strings.Builder
+	for _, path := range paths {
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+
+		stamp.WriteString(strconv.FormatInt(info.Size(), 10) + "@" + strconv.FormatInt(info.ModTime().UnixNano(), 10) + ";")
+	}
+
+	return stamp.String(), nil
+}
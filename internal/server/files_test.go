@@ -0,0 +1,64 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileCacheIds(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "video.ts")
+	writeFile(t, path, "first")
+
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatalf("Expected the times of '%v' to be set, but got %v", path, err)
+	}
+
+	files := NewFileCache()
+	item := ConfigItem{Name: path}
+
+	id, err := files.ContentId(item, "")
+	if err != nil {
+		t.Fatalf("Expected an id for '%v', but got %v", path, err)
+	}
+
+	// same size and modification time, the file is not hashed again
+	writeFile(t, path, "other")
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatalf("Expected the times of '%v' to be set, but got %v", path, err)
+	}
+
+	if cached, _ := files.ContentId(item, ""); cached != id {
+		t.Fatalf("Expected the cached id '%v', but got '%v'", id, cached)
+	}
+
+	// modified, the file is hashed again
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		t.Fatalf("Expected the times of '%v' to be set, but got %v", path, err)
+	}
+
+	modified, err := files.ContentId(item, "")
+	if err != nil {
+		t.Fatalf("Expected an id for '%v', but got %v", path, err)
+	}
+
+	if expected, _ := ContentId(item, ""); modified != expected || modified == id {
+		t.Fatalf("Expected the id of the modified file '%v', but got '%v'", expected, modified)
+	}
+
+	// looked up since the last sweep, kept by the first one only
+	files.Sweep()
+	if len(files.ids) != 1 {
+		t.Fatalf("Expected the id to be kept, but got %d ids", len(files.ids))
+	}
+
+	files.Sweep()
+	if len(files.ids) != 0 {
+		t.Fatalf("Expected the id of a file no longer looked up to be forgotten, but got %d ids", len(files.ids))
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+
+	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/streamer"
+)
+
+const (
+	// IdLength is the length, in hex characters, of the computed content ids.
+	IdLength = packets.IdLength
+	// hashSample is the number of bytes hashed from the start and the end of each file.
+	hashSample = 1 << 20
+)
+
+// Identify sets the Id of every item of the catalog of the server at origin that has
+// none. Files are identified by a hash of their size and of their first and last
+// megabyte, so the same file has the same id on any server. Live channels are only
+// the same channel on the server receiving them, so they are identified by their
+// name, ingest and origin. Generated content is identified by its generator.
+// The ids of files are kept in files, when not nil.
+func Identify(config Config, origin string, files *FileCache) Config {
+
+	for i, item := range config.Content {
+
+		if item.Id != "" {
+			continue
+		} // given in the configuration
+
+		id, err := files.ContentId(item, origin)
+		if err != nil {
+			log.Printf("(identify) warning: cannot identify '%v': %v\n", item.Name, err)
+			continue
+		}
+
+		config.Content[i].Id = id
+	}
+
+	return config
+}
+
+// ContentId computes the id of a content item of the server at origin, see Identify.
+func ContentId(item ConfigItem, origin string) (string, error) {
+
+	h := sha256.New()
+
+	if len(item.Renditions) > 0 {
+		for _, r := range item.Renditions {
+			h.Write([]byte(r.Name))
+			if err := hashFile(h, r.Path); err != nil {
+				return "", err
+			}
+		}
+		return hex.EncodeToString(h.Sum(nil))[:IdLength], nil
+	}
+
+	switch item.SourceKind() {
+
+	case streamer.FileSourceKind, streamer.TranscodeSourceKind:
+		if err := hashFile(h, item.Name); err != nil {
+			return "", err
+		}
+
+	case streamer.LiveSourceKind:
+		h.Write([]byte("live:" + origin + "/" + item.Ingest + "/" + item.Name))
+
+	case streamer.GeneratorSourceKind:
+		h.Write([]byte("generator:" + item.Generator))
+
+	default:
+		h.Write([]byte(item.Name))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:IdLength], nil
+}
+
+// hashFile writes the size, the first and the last hashSample bytes of the file at path to h.
+func hashFile(h io.Writer, path string) error {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(info.Size()))
+	h.Write(size)
+
+	if _, err := io.CopyN(h, file, hashSample); err != nil && err != io.EOF {
+		return err
+	}
+
+	if info.Size() > 2*hashSample {
+		if _, err := file.Seek(-hashSample, io.SeekEnd); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(h, file, hashSample); err != nil && err != io.EOF {
+			return err
+		}
+	}
+
+	return nil
+}
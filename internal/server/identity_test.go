@@ -0,0 +1,38 @@
+package server
+
+import "testing"
+
+func TestLiveContentId(t *testing.T) {
+
+	news := ConfigItem{Name: "news", Ingest: "udp://0.0.0.0:5000"}
+
+	tests := []struct {
+		name   string
+		item   ConfigItem
+		origin string
+		same   bool
+	}{
+		{"same channel of the same server", news, "10.0.0.1:8080", true},
+		{"same name on another server", news, "10.0.0.2:8080", false},
+		{"same name on another ingest", ConfigItem{Name: "news", Ingest: "udp://0.0.0.0:5001"}, "10.0.0.1:8080", false},
+	}
+
+	id, err := ContentId(news, "10.0.0.1:8080")
+	if err != nil {
+		t.Fatalf("Expected an id for '%v', but got %v", news.Name, err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			other, err := ContentId(tt.item, tt.origin)
+			if err != nil {
+				t.Fatalf("Expected an id for '%v', but got %v", tt.item.Name, err)
+			}
+
+			if (other == id) != tt.same {
+				t.Fatalf("Expected ids '%v' and '%v' to be the same: %v", id, other, tt.same)
+			}
+		})
+	}
+}
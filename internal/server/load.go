@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Load describes how busy a server is, it is reported to the rendezvous
+// points in every 'PONG' so they can take it into account when selecting servers.
+type Load struct {
+	// Streams is the number of contents being streamed.
+	Streams int
+	// Destinations is the number of destinations across every stream.
+	Destinations int
+	// Bitrate is the outgoing bitrate in bits per second.
+	Bitrate float64
+	// Budget is the configured throughput in bits per second, 0 means unlimited.
+	Budget float64
+	// Remaining is the throughput left in bits per second, meaningless when the budget is unlimited.
+	Remaining float64
+	// CPU is the cpu usage of the machine since the previous report, from 0 to 1.
+	CPU float64
+}
+
+// Unlimited checks whether the server has no throughput budget.
+func (l Load) Unlimited() bool {
+	return l.Budget == 0
+}
+
+// Full checks whether the server has no throughput left.
+func (l Load) Full() bool {
+	return !l.Unlimited() && l.Remaining <= 0
+}
+
+// Fits checks whether a stream of bps bits per second fits in the remaining budget.
+func (l Load) Fits(bps float64) bool {
+	return l.Unlimited() || l.Remaining >= bps
+}
+
+// Load returns the current load of the server.
+func (s *Server) Load() Load {
+
+	load := Load{
+		Streams:      s.ConnectionPool.Len(),
+		Destinations: s.ConnectionPool.Destinations(),
+		Bitrate:      s.ConnectionPool.Throughput(),
+		Budget:       float64(s.Catalog().Throughput) * 1000,
+	}
+
+	if !load.Unlimited() {
+		load.Remaining = max(load.Budget-load.Bitrate, 0)
+	}
+
+	if usage, err := s.cpu.Usage(); err == nil {
+		load.CPU = usage
+	} // cpu usage is not available on every platform
+
+	return load
+}
+
+// cpuSampler computes the cpu usage between consecutive samples of /proc/stat.
+type cpuSampler struct {
+	idle  uint64
+	total uint64
+	mu    sync.Mutex
+}
+
+// Usage returns the cpu usage since the previous call, from 0 to 1.
+// The first call returns the usage since boot.
+func (c *cpuSampler) Usage() (float64, error) {
+
+	idle, total, err := readCpuStat()
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deltaIdle, deltaTotal := idle-c.idle, total-c.total
+	c.idle, c.total = idle, total
+
+	if deltaTotal == 0 {
+		return 0, nil
+	}
+
+	return 1 - float64(deltaIdle)/float64(deltaTotal), nil
+}
+
+// readCpuStat reads the idle and total cpu time from the aggregated 'cpu' line of /proc/stat.
+func readCpuStat() (uint64, uint64, error) {
+
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+
+		var idle, total uint64
+		for i, field := range fields[1:] {
+
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			total += value
+			if i == 3 || i == 4 { // idle and iowait
+				idle += value
+			}
+		}
+
+		return idle, total, nil
+	}
+
+	return 0, 0, errors.New("no cpu line in /proc/stat")
+}
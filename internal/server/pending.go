@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"time"
+)
+
+// ConfirmTimeout is how long a request answered with 'CSND' waits for its 'OK',
+// the port it was given is free for other requests afterwards.
+const ConfirmTimeout = 30 * time.Second
+
+// pendingKey identifies a request by the connection it came from and its id.
+type pendingKey struct {
+	remote string
+	id     uint64
+}
+
+// pendingStream is a request answered with 'CSND', waiting for its 'OK'.
+type pendingStream struct {
+	// Requester the content is streamed on behalf of.
+	Requester string
+	// Content requested, as a content key.
+	Content string
+	// Address the content is to be streamed to.
+	Address string
+
+	since time.Time
+}
+
+// expect records the request as waiting for its confirmation, returning the address
+// to stream it to at host. The address is at port when the requester chose one, else
+// the first one not receiving a stream, nor promised to another pending request.
+func (s *Server) expect(key pendingKey, request pendingStream, host string, port int) string {
+
+	s.pMu.Lock()
+	defer s.pMu.Unlock()
+
+	promised := make(map[string]bool)
+	for other, pending := range s.pending {
+
+		if time.Since(pending.since) > ConfirmTimeout {
+			delete(s.pending, other)
+			continue
+		} // never confirmed
+
+		promised[pending.Address] = true
+	}
+
+	var addr string
+	if port != 0 {
+		addr = net.JoinHostPort(host, strconv.Itoa(port)) // the requester knows which of its ports are free
+	} else {
+		for port := s.ConnectionPool.FreePort(host, s.AccessPort); ; port = s.ConnectionPool.FreePort(host, port+1) {
+
+			addr = net.JoinHostPort(host, strconv.Itoa(port))
+			if !promised[addr] {
+				break
+			}
+		}
+	}
+
+	request.Address, request.since = addr, time.Now()
+	s.pending[key] = request
+
+	return addr
+}
+
+// confirmation returns the pending request id of remote.
+func (s *Server) confirmation(remote string, id uint64) (pendingStream, bool) {
+
+	s.pMu.Lock()
+	defer s.pMu.Unlock()
+
+	pending, exists := s.pending[pendingKey{remote: remote, id: id}]
+	return pending, exists
+}
+
+// forget removes the request id of remote from the pending ones, its address is
+// only free once the request either joined the streamer or failed.
+func (s *Server) forget(remote string, id uint64) {
+
+	s.pMu.Lock()
+	defer s.pMu.Unlock()
+
+	delete(s.pending, pendingKey{remote: remote, id: id})
+}
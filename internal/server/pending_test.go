@@ -0,0 +1,32 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/gweebg/mcast/internal/streamer"
+)
+
+func TestExpectPort(t *testing.T) {
+
+	s := &Server{
+		ConnectionPool: streamer.NewStreamingPool(),
+		AccessPort:     8000,
+		pending:        make(map[pendingKey]pendingStream),
+	}
+
+	tests := []struct {
+		port     int
+		expected string
+	}{
+		{9001, "10.0.0.1:9001"}, // chosen by the requester
+		{0, "10.0.0.1:8000"},
+		{0, "10.0.0.1:8001"}, // 8000 is promised to the previous request
+	}
+
+	for i, tt := range tests {
+		key := pendingKey{remote: "10.0.0.1:40000", id: uint64(i)}
+		if addr := s.expect(key, pendingStream{Content: "video.mp4"}, "10.0.0.1", tt.port); addr != tt.expected {
+			t.Fatalf("Expected request %d to be streamed to '%v', but got '%v'", i, tt.expected, addr)
+		}
+	}
+}
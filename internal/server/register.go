@@ -0,0 +1,119 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/utils"
+)
+
+const (
+	// RegisterAttempts is the number of times registration with a rendezvous point is tried.
+	RegisterAttempts = 5
+	// RegisterRetryInterval is the delay between registration attempts.
+	RegisterRetryInterval = 2 * time.Second
+)
+
+// announce sends packet to the rendezvous point at rendezvous and waits for the
+// acknowledgement, a packet with the same flag.
+func (s *Server) announce(rendezvous string, packet packets.Packet) error {
+
+	conn, err := net.DialTimeout("tcp", rendezvous, RegisterRetryInterval)
+	if err != nil {
+		return err
+	}
+	defer utils.CloseConnection(conn, rendezvous)
+
+	enc, err := packet.Encode()
+	if err != nil {
+		return err
+	}
+
+	if err = packets.Send(conn, enc); err != nil {
+		return err
+	}
+
+	if err = conn.SetReadDeadline(time.Now().Add(RegisterRetryInterval)); err != nil {
+		return err
+	}
+
+	data, err := packets.NewReceiver(conn).Receive()
+	if err != nil {
+		return err
+	}
+
+	ack, err := packets.DecodePacket(data)
+	if err != nil {
+		return err
+	}
+
+	if !ack.Header.Flags.OnlyHasFlag(packet.Header.Flags) {
+		return errors.New("unexpected acknowledgement from " + rendezvous)
+	}
+
+	return nil
+}
+
+// Register announces the server to the rendezvous point at rendezvous, which then
+// connects to the server and retrieves its catalog. Retried up to RegisterAttempts times.
+func (s *Server) Register(rendezvous string) error {
+
+	var err error
+	for attempt := 1; attempt <= RegisterAttempts; attempt++ {
+
+		err = s.announce(rendezvous, packets.Register(s.Address.String()))
+		if err == nil {
+			log.Printf("(register %v) registered with rendezvous point\n", rendezvous)
+			return nil
+		}
+
+		log.Printf("(register %v) attempt %d failed: %v\n", rendezvous, attempt, err)
+		time.Sleep(RegisterRetryInterval)
+	}
+
+	return err
+}
+
+// Deregister removes the server from the rendezvous point at rendezvous.
+func (s *Server) Deregister(rendezvous string) error {
+
+	err := s.announce(rendezvous, packets.Deregister(s.Address.String()))
+	if err == nil {
+		log.Printf("(register %v) deregistered from rendezvous point\n", rendezvous)
+	}
+
+	return err
+}
+
+// registerAll registers the server with every rendezvous point in Registrations,
+// and deregisters from them once the server is interrupted or terminated.
+func (s *Server) registerAll() {
+
+	for _, rendezvous := range s.Registrations {
+		go func(rendezvous string) {
+			if err := s.Register(rendezvous); err != nil {
+				log.Printf("(register %v) cannot register with rendezvous point: %v\n", rendezvous, err)
+			}
+		}(rendezvous)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	sig := <-stop
+	log.Printf("(register) received %v, shutting down\n", sig)
+
+	for _, rendezvous := range s.Registrations {
+		if err := s.Deregister(rendezvous); err != nil {
+			log.Printf("(register %v) cannot deregister from rendezvous point: %v\n", rendezvous, err)
+		}
+	}
+
+	os.Exit(0)
+}
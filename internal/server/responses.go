@@ -10,18 +10,52 @@ func ContentInfoPacket(c []ConfigItem) packets.BasePacket[[]ConfigItem] {
 	}
 }
 
-func ContentPortPacket(port string) packets.BasePacket[string] {
+// CatalogUpdatePacket is pushed, unsolicited, to the rendezvous points when the catalog changes.
+func CatalogUpdatePacket(c []ConfigItem) packets.BasePacket[[]ConfigItem] {
+
+	return packets.BasePacket[[]ConfigItem]{
+		Header:  packets.PacketHeader{Flag: packets.UPDT},
+		Payload: c,
+	}
+}
+
+func ContentPortPacket(id uint64, content string, port string) packets.BasePacket[string] {
 
 	return packets.BasePacket[string]{
-		Header:  packets.PacketHeader{Flag: packets.CSND},
+		Header:  packets.PacketHeader{Flag: packets.CSND, Content: content, Id: id},
 		Payload: port,
 	}
 }
 
-func Pong() packets.BasePacket[string] {
+// OverCapacityPacket refuses the request for content, streaming it would exceed the server throughput.
+func OverCapacityPacket(id uint64, content string) packets.BasePacket[string] {
 
 	return packets.BasePacket[string]{
+		Header:  packets.PacketHeader{Flag: packets.FULL, Content: content, Id: id},
+		Payload: content,
+	}
+}
+
+// NotOfferedPacket refuses the request for content, it is not in the catalog of the server.
+func NotOfferedPacket(id uint64, content string) packets.BasePacket[string] {
+
+	return packets.BasePacket[string]{
+		Header:  packets.PacketHeader{Flag: packets.NONE, Content: content, Id: id},
+		Payload: content,
+	}
+}
+
+// Echo is the payload of a pong, the probe of the 'PING' and the current load of the server.
+type Echo struct {
+	Probe packets.Probe
+	Load  Load
+}
+
+// Pong answers a 'PING' by echoing its probe along with the current load of the server.
+func Pong(probe packets.Probe, load Load) packets.BasePacket[Echo] {
+
+	return packets.BasePacket[Echo]{
 		Header:  packets.PacketHeader{Flag: packets.PING},
-		Payload: "pong",
+		Payload: Echo{Probe: probe, Load: load},
 	}
 }
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/gweebg/mcast/internal/streamer"
+)
+
+// VideoExtensions lists the file extensions picked up when scanning directories.
+var VideoExtensions = []string{".mp4", ".mkv", ".mov", ".avi", ".webm", ".m4v", ".ts"}
+
+func isVideo(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, v := range VideoExtensions {
+		if ext == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ScanDirectories adds to the catalog every video file found (recursively) in the
+// configured directories, probing each one for its resolution, fps and duration.
+// Files that cannot be probed are skipped with a warning, as are files whose name
+// is already in the catalog. Probe results are kept in files, when not nil.
+func ScanDirectories(config Config, files *FileCache) Config {
+
+	for _, dir := range config.Directories {
+
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+
+			if err != nil {
+				log.Printf("(scan) warning: cannot read '%v': %v\n", path, err)
+				return nil
+			}
+
+			if d.IsDir() || !isVideo(path) {
+				return nil
+			}
+
+			if _, exists := config.Find(filepath.Base(path)); exists {
+				log.Printf("(scan) warning: '%v' is already in the catalog, skipping\n", path)
+				return nil
+			}
+
+			info, err := files.Probe(path)
+			if err != nil {
+				log.Printf("(scan) warning: skipping '%v': %v\n", path, err)
+				return nil
+			}
+
+			source := streamer.TranscodeSourceKind
+			if strings.ToLower(filepath.Ext(path)) == ".ts" {
+				source = streamer.FileSourceKind
+			} // already a transport stream, no need for ffmpeg
+
+			config.Content = append(config.Content, ConfigItem{
+				Name:     path,
+				Width:    info.Width,
+				Height:   info.Height,
+				FPS:      info.FPS,
+				Duration: info.Duration,
+				Bitrate:  info.Bitrate,
+				Source:   source,
+			})
+
+			log.Printf("(scan) added '%v' (%dx%d@%d, %.1fs)\n", path, info.Width, info.Height, info.FPS, info.Duration)
+			return nil
+		})
+
+		if err != nil {
+			log.Printf("(scan) warning: cannot scan '%v': %v\n", dir, err)
+		}
+	}
+
+	return config
+}
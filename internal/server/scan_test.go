@@ -0,0 +1,69 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeFile creates the file at path, along with its directories.
+func writeFile(t *testing.T, path string, data string) {
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("Expected the directory of '%v' to be created, but got %v", path, err)
+	}
+
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("Expected '%v' to be created, but got %v", path, err)
+	}
+}
+
+func TestScanSkipsBadFiles(t *testing.T) {
+
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "broken.mp4"), "not a video")
+	writeFile(t, filepath.Join(dir, "nested", "broken.ts"), "not a transport stream")
+	writeFile(t, filepath.Join(dir, "notes.txt"), "not a video either")
+	writeFile(t, filepath.Join(dir, "known.mp4"), "already in the catalog")
+
+	config := ScanDirectories(Config{
+		Content:     []ConfigItem{{Name: "known.mp4"}},
+		Directories: []string{dir, filepath.Join(dir, "missing")},
+	}, nil)
+
+	if len(config.Content) != 1 || config.Content[0].Name != "known.mp4" {
+		t.Fatalf("Expected only the configured content, but got %+v", config.Content)
+	}
+}
+
+func TestLastModifiedFiles(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	video := filepath.Join(dir, "videos", "video.mp4")
+
+	writeFile(t, path, "{}")
+	writeFile(t, video, "video")
+
+	past := time.Now().Add(-time.Hour)
+	for _, p := range []string{path, filepath.Dir(video), video} {
+		if err := os.Chtimes(p, past, past); err != nil {
+			t.Fatalf("Expected the times of '%v' to be set, but got %v", p, err)
+		}
+	}
+
+	s := &Server{ConfigPath: path, Config: Config{Directories: []string{filepath.Dir(video)}}}
+	before := s.lastModified()
+
+	// replaced in place, the directory is left untouched
+	now := time.Now()
+	if err := os.Chtimes(video, now, now); err != nil {
+		t.Fatalf("Expected the times of '%v' to be set, but got %v", video, err)
+	}
+
+	if after := s.lastModified(); !after.After(before) {
+		t.Fatalf("Expected the modification of '%v' to be noticed, but got %v before and %v after", video, before, after)
+	}
+}
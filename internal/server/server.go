@@ -9,7 +9,7 @@ import (
 	"log"
 	"net"
 	"net/netip"
-	"strconv"
+	"sync"
 )
 
 type Server struct {
@@ -17,14 +17,41 @@ type Server struct {
 	Address netip.AddrPort
 	// represents the server properties and what content it has available.
 	Config Config
+	// path of the configuration file, watched for changes.
+	ConfigPath string
+	// Config and Ingests mutex, the catalog can be reloaded at any time.
+	cMu sync.RWMutex
 
 	// tcp listener on the Address
 	TCPHandler handlers.TCPConn
 
-	// contains the addresses where I'm streaming to and what content is being streamed
+	// contains the content being streamed and the addresses it is streamed to
 	ConnectionPool streamer.StreamingPool
 	// default streamer port, incremented depending on the number of streamers
 	AccessPort int
+
+	// live channels receiving their stream, by content name
+	Ingests map[string]*streamer.Ingest
+
+	// probe results and ids of the scanned files, kept between reloads.
+	files *FileCache
+
+	// addresses of the rendezvous points the server registers with, see Register.
+	Registrations []string
+
+	// cpu usage between load reports.
+	cpu cpuSampler
+
+	// connections of the rendezvous points that woke the server, by address,
+	// catalog updates are pushed to them.
+	Rendezvous map[string]net.Conn
+	// Rendezvous mutex, to prevent race conditions.
+	rMu sync.Mutex
+
+	// requests answered with 'CSND' and waiting for their 'OK', see OnContent.
+	pending map[pendingKey]pendingStream
+	// pending mutex.
+	pMu sync.Mutex
 }
 
 // New creates a new server instance when passed its operating address
@@ -39,17 +66,37 @@ func New(addr, path string) *Server {
 	addrPort, err := netip.ParseAddrPort(addr)
 	utils.Check(err) // address string to AddrPort obj
 
-	return &Server{
+	files := NewFileCache()
+
+	s := &Server{
 		Address:        addrPort,
-		Config:         utils.MustParseJson[Config](path, ValidateConfig),
+		Config:         Identify(ScanDirectories(utils.MustParseJson[Config](path, ValidateConfig), files), addrPort.String(), files),
+		ConfigPath:     path,
 		TCPHandler:     *tcpHandler,
 		ConnectionPool: streamer.NewStreamingPool(),
 		AccessPort:     8000,
+		Ingests:        make(map[string]*streamer.Ingest),
+		Rendezvous:     make(map[string]net.Conn),
+		pending:        make(map[pendingKey]pendingStream),
+		files:          files,
 	} // server instantiation
+
+	err = s.startIngests(s.Config)
+	utils.Check(err)
+
+	return s
 }
 
 // Run function is responsible for running the main loop of the server.
 func (s *Server) Run() {
+
+	go s.Watch()       // reload the catalog on changes
+	go s.ServeProbes() // answer the metric probes
+
+	if len(s.Registrations) > 0 {
+		go s.registerAll() // announce the server, deregister on shutdown
+	}
+
 	s.TCPHandler.Listen(
 		s.Address,           // remote address
 		s.TCPHandler.Handle, // request handler
@@ -65,16 +112,23 @@ func Handler(conn net.Conn, va ...interface{}) {
 	addrString := conn.RemoteAddr().String()
 	log.Printf("(handling %v) new connection received\n", addrString)
 
-	// read the connection for incoming data.
-	buffer := make([]byte, 1024)
+	requester := "" // known once the requester wakes the server
+	defer func() {
+		utils.CloseConnection(conn, addrString)
+		s.disconnected(requester, conn)
+	}()
+
+	// read the connection for incoming data, packets are framed by the receiver.
+	recv := packets.NewReceiver(conn)
 	for {
 
-		n, err := conn.Read(buffer) // read from connection
+		data, err := recv.Receive() // read from connection
 		if err != nil {
-			continue // keep the connection open
+			log.Printf("(handling %v) connection closed, reason '%v'\n", addrString, err)
+			return
 		}
 
-		p, err := packets.Decode[string](buffer[:n]) // decode packet
+		p, err := packets.Decode[string](data) // decode packet
 		if err != nil {
 			log.Printf("(handling %v) malformed packet, ignoring...\n", addrString)
 			continue // just ignore the packet, continue the read
@@ -83,133 +137,221 @@ func Handler(conn net.Conn, va ...interface{}) {
 		switch p.Header.Flag {
 
 		case packets.WAKE: // received WAKE
-			s.OnWake(conn)
+			requester = s.OnWake(conn, p)
 
 		case packets.REQ: // received REQ
 			s.OnContent(conn, p)
 
+		case packets.OK: // received OK
+			s.OnConfirm(conn, p)
+
 		case packets.STOP: // received STOP
 			s.OnStop(conn, p)
 
-		case packets.PING: // received PING
-			s.OnPing(conn)
-
 		}
 	}
 }
 
 // OnWake handles the request 'WAKE' from the client (rendezvous point).
 // Once this kind of request arrives, the server will answer with a list
-// of ConfigItem representing what content it can stream.
-func (s *Server) OnWake(conn net.Conn) {
+// of ConfigItem representing what content it can stream. Returns the requester
+// that woke the server.
+func (s *Server) OnWake(conn net.Conn, p packets.BasePacket[string]) string {
 
 	remote := conn.RemoteAddr().String()
-	log.Printf("(handling %v) received packet with header 'WAKE'\n", remote)
+	key := requester(p, conn)
+	log.Printf("(handling %v) received packet with header 'WAKE' from '%v'\n", remote, key)
+
+	s.rMu.Lock()
+	s.Rendezvous[key] = conn // catalog updates are pushed through this connection, the latest one
+	s.rMu.Unlock()
 
 	// response packet
-	pac := ContentInfoPacket(s.Config.Content)
+	pac := ContentInfoPacket(s.Catalog().Content)
 
 	encPac, err := packets.Encode[[]ConfigItem](pac) // encode the packet
 	utils.Check(err)
 
-	size, err := conn.Write(encPac) // send the packet
-	utils.Check(err)
+	if err = packets.Send(conn, encPac); err != nil { // send the packet
+		log.Printf("(handling %v) cannot answer with packet 'CONT'\n", remote)
+		return key
+	}
 
-	log.Printf("(handling %v) answered with packet 'CONT' (%d bytes)\n", remote, size)
+	log.Printf("(handling %v) answered with packet 'CONT' (%d bytes)\n", remote, len(encPac))
+	return key
 }
 
 // OnContent handles the request 'REQ' from the client.
-// First the server responds via TCP (conn net.Conn) with the port where the content
-// will be streamed on. Once the client answers with an 'OK' packet then we start the
-// UDP stream by utilizing our streamer.Streamer struct.
+// Requests for content (or renditions) not in the catalog are refused with 'NONE',
+// and those that would exceed the server throughput with 'FULL'.
+// Otherwise the server responds via TCP (conn net.Conn) with the port where the content
+// will be streamed on. The stream only starts once the client confirms it with an 'OK',
+// see OnConfirm, meanwhile other requests can be answered on the same connection.
 func (s *Server) OnContent(conn net.Conn, p packets.BasePacket[string]) {
 
 	remote := conn.RemoteAddr().String()
-	log.Printf("(handling %v) received packet with header 'REQ'\n", remote)
+	log.Printf("(handling %v) received packet with header 'REQ' (id: %d)\n", remote, p.Header.Id)
+
+	contentName, rendition := packets.SplitContentKey(p.Payload)
 
-	// create response packet
-	port := s.AccessPort // port that we're sending to the client
+	item, exists := s.Catalog().Find(contentName)
+	if !exists || !item.Offers(rendition) {
+		s.refuse(conn, p, NotOfferedPacket(p.Header.Id, p.Payload))
+		log.Printf("(handling %v) answered with packet 'NONE', reason '%v' is not in the catalog\n", remote, p.Payload)
+		return
+	}
+
+	// the default rendition shares its stream whether it is requested by name or not
+	contentKey := item.NormalizedKey(contentName, rendition)
 
-	streamers, err := s.ConnectionPool.GetPool(remote)
-	if err == nil { // if there's already a streaming pool the streaming port is the default + len(pool)
-		port += len(streamers) + 1
+	if !s.Admit(contentKey) { // streaming it would exceed the throughput of the server
+		s.refuse(conn, p, OverCapacityPacket(p.Header.Id, p.Payload))
+		log.Printf("(handling %v) answered with packet 'FULL', reason 'over capacity' (%.0f of %d kbps in use)\n",
+			remote, s.ConnectionPool.Throughput()/1000, s.Catalog().Throughput)
+		return
 	}
 
-	// encode the packet with the port as a string
-	streamingPort := strconv.FormatInt(int64(port), 10)
-	streamAddr := utils.ReplacePortFromAddressString(conn.RemoteAddr().String(), streamingPort)
+	host, _, err := net.SplitHostPort(remote)
+	utils.Check(err)
 
-	encPack, err := packets.Encode[string](ContentPortPacket(streamAddr))
+	// the port chosen by the requester, or else the first one not already receiving
+	// a stream on the requester, nor promised to it
+	streamAddr := s.expect(
+		pendingKey{remote: remote, id: p.Header.Id},
+		pendingStream{Requester: requester(p, conn), Content: contentKey},
+		host,
+		int(p.Header.Port),
+	)
+
+	encPack, err := packets.Encode[string](ContentPortPacket(p.Header.Id, p.Payload, streamAddr))
 	utils.Check(err)
 
 	// send response packet
-	_, err = conn.Write(encPack)
-	utils.Check(err)
+	if err = packets.Send(conn, encPack); err != nil {
+		log.Printf("(handling %v) cannot answer with packet 'CSND'\n", remote)
+		s.forget(remote, p.Header.Id) // no confirmation will come
+		return
+	}
 
 	log.Printf("(handling %v) answered with packet 'CSND' (addr: %v)\n", remote, streamAddr)
-	log.Printf("(handling %v) setting up streaming of '%v' at '%v'\n", remote, p.Payload, streamAddr)
-	log.Printf("(handling %v) waiting for confirmation...\n", remote)
+	log.Printf("(handling %v) waiting for confirmation of '%v' at '%v'...\n", remote, p.Payload, streamAddr)
+}
 
-	response := make([]byte, 1024) // receiving the clients response
-	n, err := conn.Read(response)
-	utils.Check(err)
+// refuse answers the request p with refusal, 'FULL' or 'NONE'.
+func (s *Server) refuse(conn net.Conn, p packets.BasePacket[string], refusal packets.BasePacket[string]) {
 
-	recvPack, err := packets.Decode[string](response[:n])
+	encPack, err := packets.Encode[string](refusal)
 	utils.Check(err)
 
-	if recvPack.Header.Flag.OnlyHasFlag(packets.OK) {
+	if err = packets.Send(conn, encPack); err != nil {
+		log.Printf("(handling %v) cannot refuse request for '%v'\n", conn.RemoteAddr().String(), p.Payload)
+	}
+}
+
+// OnConfirm handles the confirmation 'OK' of a request answered by OnContent,
+// starting to stream the requested content to the address given in the 'CSND'.
+func (s *Server) OnConfirm(conn net.Conn, p packets.BasePacket[string]) {
+
+	remote := conn.RemoteAddr().String()
+
+	pending, exists := s.confirmation(remote, p.Header.Id)
+	defer s.forget(remote, p.Header.Id) // after joining, so the address stays promised until then
+
+	if !exists {
+		log.Printf("(handling %v) received 'OK' for unknown request %d, ignoring...\n", remote, p.Header.Id)
+		return
+	}
 
-		log.Printf("(handling %v) received confirmation packet with header 'OK'\n", remote)
+	log.Printf("(handling %v) received confirmation packet with header 'OK' (id: %d)\n", remote, p.Header.Id)
 
-		// create and initialize the streamer object responsible for the content streaming
-		stmr := streamer.New(
-			streamer.WithAddress(streamAddr),
-			streamer.WithContentName(p.Payload),
-		)
-		log.Printf("(handling %v) created new streamer for '%v'\n", remote, p.Payload)
+	contentKey, streamAddr := pending.Content, pending.Address
+	key := pending.Requester
+	contentName, rendition := packets.SplitContentKey(contentKey)
 
-		err = s.ConnectionPool.Add(remote, stmr) // create a new streaming pool
-		utils.Check(err)
-		log.Printf("(handling %v) added streamer for '%v' to the pool\n", remote, p.Payload)
+	item, exists := s.Catalog().Find(contentName)
+	if !exists {
+		log.Printf("(handling %v) content '%v' is not in the catalog\n", remote, contentName)
+		return
+	}
+
+	// join the streamer of the content, creating it if no one is receiving it yet
+	stmr, created, err := s.ConnectionPool.Join(contentKey, key, streamAddr, func() (*streamer.Streamer, error) {
+
+		source, err := s.NewSource(item, rendition)
+		if err != nil {
+			return nil, err
+		}
 
-		go stmr.Stream()
+		return streamer.New(
+			streamer.WithContentName(contentKey),
+			streamer.WithSource(source),
+			streamer.WithBitrate(float64(item.EstimatedBitrate(rendition))*1000),
+		), nil
+	})
+	if err != nil {
+		log.Printf("(handling %v) cannot stream '%v': %v\n", remote, contentKey, err)
+		return
+	}
 
-	} else {
-		log.Printf("(handling %v) did not receive confirmation, was expecting packet with header 'OK'\n", remote)
+	if !created {
+		log.Printf("(handling %v) joined existing streamer for '%v'\n", remote, contentKey)
+		return
 	}
 
+	log.Printf("(handling %v) created new streamer for '%v'\n", remote, contentKey)
+	go s.ConnectionPool.Run(contentKey, stmr) // removed from the pool once it stops
 }
 
 // OnStop function is responsible for stopping the transmission of a certain content.
-// With every connection (alongside its streaming connections) being stored in a StreamingPool
-// we can assure that we can stop its streaming goroutines.
+// Streamers are shared between requesters, so the requester is only removed from the
+// streamer's destinations, the streamer itself stops once the last one leaves.
 func (s *Server) OnStop(conn net.Conn, p packets.BasePacket[string]) {
 
 	remote := conn.RemoteAddr().String()
-	log.Printf("(handling %v) received packet with header 'STOP'\n", remote)
+	key := requester(p, conn)
+	log.Printf("(handling %v) received packet with header 'STOP' from '%v'\n", remote, key)
 
-	err := s.ConnectionPool.Delete(remote, p.Payload) // delete already handles the streamer teardown
-	utils.Check(err)
+	contentKey := p.Payload
+	contentName, rendition := packets.SplitContentKey(contentKey)
+	if item, exists := s.Catalog().Find(contentName); exists {
+		contentKey = item.NormalizedKey(contentName, rendition)
+	} // as kept by OnContent
+
+	err := s.ConnectionPool.Leave(contentKey, key) // leave already handles the streamer teardown
+	if err != nil {
+		log.Printf("(handling %v) cannot stop streaming %v: %v\n", remote, p.Payload, err)
+		return
+	}
 
 	log.Printf("(handling %v) stopped streaming %v\n", remote, p.Payload)
 }
 
-// OnPing function answers with Pong to Ping requests, used
-// in metrics measurements by the clients, such as latency,
-// jitter and packet loss.
-func (s *Server) OnPing(conn net.Conn) {
+// disconnected stops streaming to requester once conn, its control connection, is closed.
+// Requesters that already reconnected through another connection keep their streams.
+func (s *Server) disconnected(requester string, conn net.Conn) {
 
-	remote := conn.RemoteAddr().String()
-	log.Printf("(handling %v) received packet with header 'PING'\n", remote)
-
-	encPack, err := packets.Encode[string](Pong())
-	utils.Check(err)
+	if requester == "" {
+		return
+	}
 
-	_, err = conn.Write(encPack)
-	if err != nil {
-		log.Printf("(handling %v) cannot respond with pong to rendezvous point\n", remote)
+	s.rMu.Lock()
+	current, exists := s.Rendezvous[requester]
+	if !exists || current != conn {
+		s.rMu.Unlock()
+		return
 	}
+	delete(s.Rendezvous, requester)
+	s.rMu.Unlock()
 
-	log.Printf("(handling %v) responded with 'Pong'\n", remote)
+	left := s.ConnectionPool.LeaveAll(requester)
+	log.Printf("(handling %v) control connection closed, stopped %d streams\n", requester, left)
+}
 
+// requester identifies who sent p by its source, regardless of the connection it used.
+// Packets without a source are identified by the address of conn.
+func requester(p packets.BasePacket[string], conn net.Conn) string {
+	if p.Header.Source != "" {
+		return p.Header.Source
+	}
+	return conn.RemoteAddr().String()
 }
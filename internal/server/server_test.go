@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gweebg/mcast/internal/flags"
+	"github.com/gweebg/mcast/internal/packets"
+	"github.com/gweebg/mcast/internal/streamer"
+)
+
+func TestRefusals(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		content    string
+		throughput uint
+		flag       flags.FlagType
+	}{
+		{"content not in the catalog", "other.mp4", 0, packets.NONE},
+		{"rendition not offered", packets.ContentKey("video.mp4", "1080p"), 0, packets.NONE},
+		{"over capacity", "video.mp4", 1, packets.FULL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s := &Server{
+				Config: Config{
+					Throughput: tt.throughput,
+					Content:    []ConfigItem{{Name: "video.mp4", Bitrate: 2000}},
+				},
+				ConnectionPool: streamer.NewStreamingPool(),
+				pending:        make(map[pendingKey]pendingStream),
+			}
+
+			client, conn := net.Pipe()
+			defer client.Close()
+			defer conn.Close()
+
+			go s.OnContent(conn, packets.Request("127.0.0.1:7000", 1, tt.content, 0))
+
+			data, err := packets.NewReceiver(client).Receive()
+			if err != nil {
+				t.Fatalf("Expected an answer for '%v', but got %v", tt.content, err)
+			}
+
+			header, err := packets.Peek(data)
+			if err != nil {
+				t.Fatalf("Expected a valid answer, but got %v", err)
+			}
+
+			if !header.Flag.OnlyHasFlag(tt.flag) {
+				t.Fatalf("Expected flag %b for '%v', but got %b", tt.flag, tt.content, header.Flag)
+			}
+		})
+	}
+}
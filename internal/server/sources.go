@@ -0,0 +1,45 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/gweebg/mcast/internal/streamer"
+)
+
+// NewSource creates the streamer.Source for the content item, live items
+// are bound to their running ingest. Items with renditions stream the pre-encoded
+// transport stream of the requested rendition (or the default one).
+func (s *Server) NewSource(item ConfigItem, rendition string) (streamer.Source, error) {
+
+	if !item.Offers(rendition) {
+		return nil, errors.New("content '" + item.Name + "' has no rendition '" + rendition + "'")
+	}
+
+	if r, exists := item.Rendition(rendition); exists {
+		return streamer.NewFileSource(r.Path), nil
+	}
+
+	switch item.SourceKind() {
+
+	case streamer.FileSourceKind:
+		return streamer.NewFileSource(item.Name), nil
+
+	case streamer.TranscodeSourceKind:
+		return streamer.NewTranscodeSource(item.Name), nil
+
+	case streamer.LiveSourceKind:
+		s.cMu.RLock()
+		ingest, exists := s.Ingests[item.Name]
+		s.cMu.RUnlock()
+
+		if !exists {
+			return nil, errors.New("no ingest running for live content '" + item.Name + "'")
+		}
+		return streamer.NewIngestSource(ingest), nil
+
+	case streamer.GeneratorSourceKind:
+		return streamer.NewGeneratorSource(item.Generator), nil
+	}
+
+	return nil, errors.New("unknown source '" + string(item.Source) + "' for content '" + item.Name + "'")
+}
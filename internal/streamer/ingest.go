@@ -0,0 +1,309 @@
+package streamer
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// IngestKind is the kind of socket/file a live channel is fed from.
+type IngestKind string
+
+const (
+	UDPIngest  IngestKind = "udp"  // incoming udp datagrams with ts packets
+	TCPIngest  IngestKind = "tcp"  // local tcp push of a ts byte stream
+	PipeIngest IngestKind = "pipe" // named pipe (fifo) with a ts byte stream
+)
+
+// ingestChunk is the number of bytes read at once from stream based ingests,
+// 7 ts packets is what most encoders (ffmpeg included) put in a udp datagram.
+const ingestChunk = TsMtu * 7
+
+// subscriberBuffer is the number of chunks buffered for each subscriber,
+// chunks are dropped for subscribers that fall behind.
+const subscriberBuffer = 256
+
+// Ingest receives a live transport stream from an external source and fans it
+// out to any number of subscribers.
+type Ingest struct {
+	// Name of the content this ingest feeds.
+	Name string
+	// Kind of the ingest source.
+	Kind IngestKind
+	// Address (host:port) or path, depending on Kind.
+	Address string
+
+	// subscribers, source and stopped mutex, to prevent race conditions.
+	mu          sync.RWMutex
+	subscribers map[int]chan []byte
+	nextId      int
+
+	// source currently being received from, closed by Stop.
+	source  io.Closer
+	stopped bool
+}
+
+// ParseIngest splits an ingest string of the form 'udp://host:port', 'tcp://host:port'
+// or 'pipe:///path/to/fifo' into its kind and address.
+func ParseIngest(ingest string) (IngestKind, string, error) {
+
+	kind, address, found := strings.Cut(ingest, "://")
+	if !found || address == "" {
+		return "", "", errors.New("malformed ingest '" + ingest + "', expected kind://address")
+	}
+
+	switch IngestKind(kind) {
+
+	case UDPIngest, TCPIngest:
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return "", "", err
+		}
+
+	case PipeIngest:
+
+	default:
+		return "", "", errors.New("unknown ingest kind '" + kind + "'")
+	}
+
+	return IngestKind(kind), address, nil
+}
+
+// NewIngest creates a new Ingest for the content name fed from ingest, see ParseIngest.
+func NewIngest(name, ingest string) (*Ingest, error) {
+
+	kind, address, err := ParseIngest(ingest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ingest{
+		Name:        name,
+		Kind:        kind,
+		Address:     address,
+		subscribers: make(map[int]chan []byte),
+	}, nil
+}
+
+// Subscribe registers a new subscriber, returns its id and the channel where the chunks are delivered.
+func (i *Ingest) Subscribe() (int, <-chan []byte) {
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	id := i.nextId
+	i.nextId++
+
+	ch := make(chan []byte, subscriberBuffer)
+	i.subscribers[id] = ch
+
+	return id, ch
+}
+
+// Unsubscribe removes the subscriber with id, its channel is no longer written to.
+func (i *Ingest) Unsubscribe(id int) {
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.subscribers, id)
+}
+
+// Stop ends Run and closes the channel of every subscriber, the ingest cannot be run again.
+func (i *Ingest) Stop() {
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.stopped {
+		return
+	}
+	i.stopped = true
+
+	if i.source != nil {
+		_ = i.source.Close()
+	}
+
+	if i.Kind == PipeIngest {
+		if writer, err := os.OpenFile(i.Address, os.O_WRONLY|syscall.O_NONBLOCK, os.ModeNamedPipe); err == nil {
+			_ = writer.Close()
+		}
+	} // a reader blocked opening the pipe is only released by a writer
+
+	for id, ch := range i.subscribers {
+		close(ch)
+		delete(i.subscribers, id)
+	}
+}
+
+// receiving sets the source being received from, it is closed right away when
+// the ingest is already stopped.
+func (i *Ingest) receiving(source io.Closer) error {
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.stopped {
+		_ = source.Close()
+		return ErrClosed
+	}
+
+	i.source = source
+	return nil
+}
+
+func (i *Ingest) isStopped() bool {
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.stopped
+}
+
+// broadcast delivers chunk to every subscriber, dropping it for the ones that are full.
+func (i *Ingest) broadcast(chunk []byte) {
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	for id, ch := range i.subscribers {
+		select {
+		case ch <- chunk:
+		default:
+			log.Printf("(ingest %v) subscriber %d is falling behind, dropping chunk\n", i.Name, id)
+		}
+	}
+}
+
+// Run receives the live stream until stopped, reopening the source whenever it ends or fails.
+func (i *Ingest) Run() {
+
+	log.Printf("(ingest %v) receiving live stream from %v://%v\n", i.Name, i.Kind, i.Address)
+
+	for {
+
+		var err error
+
+		switch i.Kind {
+		case UDPIngest:
+			err = i.receiveUDP()
+		case TCPIngest:
+			err = i.receiveTCP()
+		case PipeIngest:
+			err = i.receivePipe()
+		}
+
+		if i.isStopped() {
+			log.Printf("(ingest %v) stopped\n", i.Name)
+			return
+		}
+
+		log.Printf("(ingest %v) source interrupted (%v), reopening...\n", i.Name, err)
+		time.Sleep(time.Second)
+	}
+}
+
+func (i *Ingest) receiveUDP() error {
+
+	addr, err := net.ResolveUDPAddr("udp", i.Address)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := i.receiving(conn); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, 65536) // large enough for any datagram
+	for {
+		n, _, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			return err
+		}
+
+		chunk := make([]byte, n) // subscribers keep a reference, so each chunk has its own copy
+		copy(chunk, buffer[:n])
+		i.broadcast(chunk)
+	}
+}
+
+func (i *Ingest) receiveTCP() error {
+
+	l, err := net.Listen("tcp", i.Address)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	if err := i.receiving(l); err != nil {
+		return err
+	}
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		log.Printf("(ingest %v) accepted push from %v\n", i.Name, conn.RemoteAddr().String())
+		if err := i.receiving(conn); err != nil {
+			return err
+		} // closed by Stop while the push is received
+
+		err = i.receiveStream(conn)
+		conn.Close()
+
+		if err := i.receiving(l); err != nil {
+			return err
+		}
+
+		log.Printf("(ingest %v) push from %v ended (%v)\n", i.Name, conn.RemoteAddr().String(), err)
+	} // one pusher at a time
+}
+
+func (i *Ingest) receivePipe() error {
+
+	if _, err := os.Stat(i.Address); errors.Is(err, os.ErrNotExist) {
+		if err := syscall.Mkfifo(i.Address, 0660); err != nil {
+			return err
+		}
+		log.Printf("(ingest %v) created named pipe at '%v'\n", i.Name, i.Address)
+	}
+
+	pipe, err := os.OpenFile(i.Address, os.O_RDONLY, os.ModeNamedPipe) // blocks until a writer opens it
+	if err != nil {
+		return err
+	}
+	defer pipe.Close()
+
+	if err := i.receiving(pipe); err != nil {
+		return err
+	}
+
+	return i.receiveStream(pipe)
+}
+
+// receiveStream reads ts packet aligned chunks from a byte stream until it ends.
+func (i *Ingest) receiveStream(r io.Reader) error {
+	for {
+		buffer := make([]byte, ingestChunk)
+		n, err := io.ReadFull(r, buffer)
+		if n > 0 {
+			i.broadcast(buffer[:n])
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package streamer
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUDPIngestChunks(t *testing.T) {
+
+	// a free port for the ingest to listen on
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected a free udp port, but got %v", err)
+	}
+	address := probe.LocalAddr().String()
+	_ = probe.Close()
+
+	ingest, err := NewIngest("live", "udp://"+address)
+	if err != nil {
+		t.Fatalf("Expected a valid ingest, but got %v", err)
+	}
+
+	_, chunks := ingest.Subscribe()
+	go ingest.Run()
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		t.Fatalf("Expected to reach the ingest, but got %v", err)
+	}
+	defer conn.Close()
+
+	first, second := bytes.Repeat([]byte{1}, TsMtu), bytes.Repeat([]byte{2}, 2*TsMtu)
+
+	// the ingest may not be listening yet, send until the first chunk arrives
+	var received []byte
+	for deadline := time.Now().Add(5 * time.Second); received == nil; {
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the ingest to receive a chunk, but got none")
+		}
+
+		_, _ = conn.Write(first)
+		select {
+		case received = <-chunks:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	_, _ = conn.Write(second)
+	for timeout := time.After(5 * time.Second); ; {
+
+		select {
+		case chunk := <-chunks:
+			if !bytes.Equal(chunk, second) {
+				continue
+			} // one of the repeated first chunks
+		case <-timeout:
+			t.Fatalf("Expected the ingest to receive the second chunk, but got none")
+		}
+		break
+	}
+
+	if len(received) != len(first) || cap(received) != len(first) {
+		t.Fatalf("Expected a chunk of %d bytes, but got len=%d cap=%d", len(first), len(received), cap(received))
+	}
+
+	if !bytes.Equal(received, first) {
+		t.Fatalf("Expected the chunk to keep its data after the next one is received")
+	}
+}
+
+func TestIngestStop(t *testing.T) {
+
+	ingest, err := NewIngest("live", "tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected a valid ingest, but got %v", err)
+	}
+
+	_, chunks := ingest.Subscribe()
+
+	done := make(chan struct{})
+	go func() {
+		ingest.Run()
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond) // waiting for a push
+	ingest.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the ingest to stop running, but it did not")
+	}
+
+	if _, open := <-chunks; open {
+		t.Fatalf("Expected the subscriber channel to be closed")
+	}
+
+	// stopped before it runs
+	ingest.Run()
+}
@@ -0,0 +1,82 @@
+package streamer
+
+import (
+	"time"
+
+	"github.com/gweebg/mcast/internal/ts"
+)
+
+// maxPcrJump is the largest forward PCR step (1 minute) still considered continuous,
+// anything greater is handled as a discontinuity and the pacer is re-anchored.
+const maxPcrJump = 60 * ts.PcrClock
+
+// Pacer delays the transmission of an MPEG transport stream so that it matches
+// wall-clock time, by comparing the PCR timestamps carried in the stream with
+// the time elapsed since the first PCR was seen.
+type Pacer struct {
+	// PID carrying the PCR being followed, only valid when anchored is true.
+	pid uint16
+	// PCR value (27MHz ticks) of the anchor packet.
+	firstPcr uint64
+	// last PCR seen, used to detect discontinuities.
+	lastPcr uint64
+	// wall-clock time at which the anchor packet was seen.
+	start time.Time
+	// whether the pacer has a reference point.
+	anchored bool
+}
+
+// NewPacer creates a new Pacer with no reference point.
+func NewPacer() *Pacer {
+	return &Pacer{}
+}
+
+// Reset drops the current reference point, the next PCR seen becomes the new anchor.
+// Must be called whenever the stream restarts, e.g. when looping over the file.
+func (p *Pacer) Reset() {
+	p.anchored = false
+}
+
+// Wait blocks until the PCR timestamps found in chunk are due in wall-clock time.
+// The chunk is expected to be made of whole TsMtu sized packets, trailing bytes are ignored.
+func (p *Pacer) Wait(chunk []byte) {
+
+	for off := 0; off+TsMtu <= len(chunk); off += TsMtu {
+
+		pkt, err := ts.Parse(chunk[off : off+TsMtu])
+		if err != nil || !pkt.HasPCR() {
+			continue
+		}
+		pid, pcr := pkt.PID, pkt.Adaptation.PCR
+
+		if p.anchored && pid != p.pid {
+			continue
+		} // only one program clock is followed
+
+		if !p.anchored || pcr < p.lastPcr || pcr-p.lastPcr > maxPcrJump {
+			p.anchor(pid, pcr) // first pcr, or a discontinuity in the clock
+			continue
+		}
+		p.lastPcr = pcr
+
+		elapsed := pcrToDuration(pcr - p.firstPcr)
+		if wait := p.start.Add(elapsed).Sub(time.Now()); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+}
+
+func (p *Pacer) anchor(pid uint16, pcr uint64) {
+	p.pid = pid
+	p.firstPcr = pcr
+	p.lastPcr = pcr
+	p.start = time.Now()
+	p.anchored = true
+}
+
+// pcrToDuration converts a number of 27MHz ticks into a time.Duration without overflowing.
+func pcrToDuration(ticks uint64) time.Duration {
+	secs := ticks / ts.PcrClock
+	rem := ticks % ts.PcrClock
+	return time.Duration(secs)*time.Second + time.Duration(rem*uint64(time.Second)/ts.PcrClock)
+}
@@ -0,0 +1,97 @@
+package streamer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gweebg/mcast/internal/ts"
+)
+
+const (
+	// pacerSlack is how late a paced packet may be released.
+	pacerSlack = 80 * time.Millisecond
+	// noPcr stands for a packet without pcr, see pcrPacket.
+	noPcr time.Duration = -1
+)
+
+// pcrPacket returns a packet of pid carrying pcr, or no pcr at all when pcr is noPcr.
+func pcrPacket(pid uint16, pcr time.Duration) []byte {
+
+	var adaptation *ts.AdaptationField
+	if pcr >= 0 {
+		adaptation = &ts.AdaptationField{HasPCR: true, PCR: uint64(pcr) * ts.PcrClock / uint64(time.Second)}
+	}
+
+	return ts.NewMuxer().PES(pid, 0xe0, 0, adaptation, nil)
+}
+
+func TestPacer(t *testing.T) {
+
+	const video, audio uint16 = 0x100, 0x101
+
+	tests := []struct {
+		name    string
+		packets [][]byte
+		wait    time.Duration
+	}{
+		{"first pcr anchors", [][]byte{pcrPacket(video, time.Second)}, 0},
+		{"paced to the pcr", [][]byte{pcrPacket(video, 0), pcrPacket(video, 100*time.Millisecond)}, 100 * time.Millisecond},
+		{"paced from the anchor", [][]byte{pcrPacket(video, 5*time.Second), pcrPacket(video, 5*time.Second+100*time.Millisecond)}, 100 * time.Millisecond},
+		{"backward discontinuity re-anchors", [][]byte{pcrPacket(video, 10*time.Second), pcrPacket(video, 0)}, 0},
+		{"paced after a discontinuity", [][]byte{pcrPacket(video, 10*time.Second), pcrPacket(video, 0), pcrPacket(video, 50*time.Millisecond)}, 50 * time.Millisecond},
+		{"forward jump re-anchors", [][]byte{pcrPacket(video, 0), pcrPacket(video, 2*time.Minute)}, 0},
+		{"missing pcr", [][]byte{pcrPacket(video, 0), pcrPacket(video, noPcr), pcrPacket(video, noPcr)}, 0},
+		{"no pcr at all", [][]byte{pcrPacket(video, noPcr)}, 0},
+		{"other program clock ignored", [][]byte{pcrPacket(video, 0), pcrPacket(audio, 5*time.Second)}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			p := NewPacer()
+
+			start := time.Now()
+			for _, pkt := range tt.packets {
+				p.Wait(pkt)
+			}
+			elapsed := time.Since(start)
+
+			if elapsed < tt.wait || elapsed > tt.wait+pacerSlack {
+				t.Fatalf("Expected to wait %v, but waited %v", tt.wait, elapsed)
+			}
+		})
+	}
+}
+
+func TestPacerReset(t *testing.T) {
+
+	p := NewPacer()
+	p.Wait(pcrPacket(0x100, 0))
+
+	// the stream restarts, e.g. a file looping, with a pcr ahead of the previous one
+	p.Reset()
+
+	start := time.Now()
+	p.Wait(pcrPacket(0x100, 30*time.Second))
+
+	if elapsed := time.Since(start); elapsed > pacerSlack {
+		t.Fatalf("Expected the pcr after a reset to anchor the pacer, but waited %v", elapsed)
+	}
+}
+
+func TestPacerChunk(t *testing.T) {
+
+	p := NewPacer()
+
+	// several packets per chunk, trailing bytes ignored
+	chunk := append(pcrPacket(0x100, 0), pcrPacket(0x100, noPcr)...)
+	chunk = append(chunk, pcrPacket(0x100, 100*time.Millisecond)...)
+	chunk = append(chunk, 0x47, 0x00)
+
+	start := time.Now()
+	p.Wait(chunk)
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 100*time.Millisecond+pacerSlack {
+		t.Fatalf("Expected to wait 100ms within the chunk, but waited %v", elapsed)
+	}
+}
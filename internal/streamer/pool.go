@@ -2,96 +2,194 @@ package streamer
 
 import (
 	"errors"
+	"net"
+	"strconv"
 	"sync"
 )
 
-type ContentMap map[string]*Streamer
+// StreamingPool keeps a single Streamer per content (and rendition), each one
+// fanning out to every requester that asked for it.
+type StreamingPool struct {
+	Pool map[string]*Streamer // { contentKey : Streamer, ... }
+	mu   sync.RWMutex
+}
 
-func (s ContentMap) AddEntry(stmr *Streamer) error {
+func NewStreamingPool() StreamingPool {
+	return StreamingPool{
+		Pool: make(map[string]*Streamer),
+	}
+}
 
-	_, exists := s[stmr.ContentName]
-	if !exists {
-		s[stmr.ContentName] = stmr
-		return nil
+// Join adds requester, receiving at addr, to the streamer of content. If no streamer
+// exists for content it is created with create. Returns the streamer and whether it
+// was created, in which case the caller is responsible for starting it. A requester
+// joining again, e.g. after reconnecting, is moved to addr.
+func (p *StreamingPool) Join(content string, requester string, addr string, create func() (*Streamer, error)) (*Streamer, bool, error) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stmr, exists := p.Pool[content]
+	if exists && !stmr.Ended() {
+		_, _ = stmr.RemoveDestination(requester) // may not be a destination yet
+		err := stmr.AddDestination(requester, addr)
+		return stmr, false, err
+	}
+
+	if exists {
+		stmr.Teardown()
+		delete(p.Pool, content)
+	} // its source failed, replaced below
+
+	stmr, err := create()
+	if err != nil {
+		return nil, false, err
 	}
 
-	return errors.New("streamer already exists for the video " + stmr.ContentName + " on the address " + stmr.Address)
+	err = stmr.AddDestination(requester, addr)
+	if err != nil {
+		stmr.Teardown()
+		return nil, false, err
+	}
 
+	p.Pool[content] = stmr
+	return stmr, true, nil
 }
 
-type StreamingPool struct {
-	Pool map[string]ContentMap // { address : { videoName: Streamer, ... }, ... }
-	mu   sync.RWMutex
+// Run streams the content with stmr, as returned by Join, and removes it from the
+// pool once it stops, e.g. when its source fails, so that the next Join starts over.
+func (p *StreamingPool) Run(content string, stmr *Streamer) {
+	stmr.Stream()
+	p.remove(content, stmr)
 }
 
-func NewStreamingPool() StreamingPool {
-	return StreamingPool{
-		Pool: make(map[string]ContentMap),
+// remove deletes stmr from the pool, unless it was replaced, and tears it down.
+func (p *StreamingPool) remove(content string, stmr *Streamer) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Pool[content] == stmr {
+		delete(p.Pool, content)
 	}
+
+	stmr.Teardown()
 }
 
-func (p *StreamingPool) Add(addr string, s *Streamer) error {
+// Leave removes requester from the streamer of content, tearing the streamer
+// down once there are no destinations left.
+func (p *StreamingPool) Leave(content string, requester string) error {
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	streamers, exists := p.Pool[addr]
-	if exists {
-		err := streamers.AddEntry(s)
+	stmr, exists := p.Pool[content]
+	if !exists {
+		return errors.New("content " + content + " is not being streamed")
+	}
+
+	left, err := stmr.RemoveDestination(requester)
+	if err != nil {
 		return err
 	}
 
-	p.Pool[addr] = make(ContentMap)
-	err := p.Pool[addr].AddEntry(s)
-	return err
+	if left == 0 {
+		stmr.Teardown()
+		delete(p.Pool, content)
+	}
 
+	return nil
 }
 
-func (p *StreamingPool) GetPool(addr string) (ContentMap, error) {
+// LeaveAll removes requester from every streamer, tearing down the ones left without
+// destinations. Returns the number of streamers requester was removed from.
+func (p *StreamingPool) LeaveAll(requester string) int {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	removed := 0
+	for content, stmr := range p.Pool {
+
+		left, err := stmr.RemoveDestination(requester)
+		if err != nil {
+			continue
+		} // not streaming to requester
+
+		removed++
+
+		if left == 0 {
+			stmr.Teardown()
+			delete(p.Pool, content)
+		}
+	}
+
+	return removed
+}
+
+// Throughput returns the outgoing bitrate of every streamer in the pool, in bits per second.
+func (p *StreamingPool) Throughput() float64 {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	streamers, exists := p.Pool[addr]
-	if !exists {
-		return nil, errors.New("address " + addr + " not found")
+	total := 0.0
+	for _, stmr := range p.Pool {
+		total += stmr.Throughput()
 	}
+	return total
+}
+
+// Len returns the number of contents being streamed.
+func (p *StreamingPool) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 
-	return streamers, nil
+	return len(p.Pool)
 }
 
-func (p *StreamingPool) GetContent(addr string, content string) (*Streamer, error) {
+// Destinations returns the number of destinations across every streamer in the pool.
+func (p *StreamingPool) Destinations() int {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	streamers, exists := p.Pool[addr]
-	if !exists {
-		return nil, errors.New("address " + addr + " not found")
+	total := 0
+	for _, stmr := range p.Pool {
+		total += stmr.Destinations()
 	}
+	return total
+}
+
+func (p *StreamingPool) Get(content string) (*Streamer, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 
-	stmr, exists := streamers[content]
+	stmr, exists := p.Pool[content]
 	if !exists {
-		return nil, errors.New("content " + content + " not found at the address " + addr)
+		return nil, errors.New("content " + content + " is not being streamed")
 	}
 
 	return stmr, nil
 }
 
-func (p *StreamingPool) Delete(addr string, content string) error {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+// FreePort returns the lowest port, starting at base, that no streamer is sending to on host.
+func (p *StreamingPool) FreePort(host string, base int) int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 
-	streamers, exists := p.Pool[addr]
-	if !exists {
-		return errors.New("address " + addr + " not found")
-	}
+	for port := base; ; port++ {
 
-	stmr, exists := streamers[content]
-	if !exists {
-		return errors.New("content " + content + " not found at the address " + addr)
-	}
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
 
-	stmr.Teardown()
+		used := false
+		for _, stmr := range p.Pool {
+			if stmr.HasAddress(addr) {
+				used = true
+				break
+			}
+		}
 
-	delete(streamers, content)
-	return nil
+		if !used {
+			return port
+		}
+	}
 }
@@ -0,0 +1,96 @@
+package streamer
+
+import (
+	"errors"
+	"testing"
+)
+
+// brokenSource cannot be opened, as a missing or unreadable file.
+type brokenSource struct{}
+
+func (brokenSource) Open() error           { return errors.New("cannot open") }
+func (brokenSource) Next() ([]byte, error) { return nil, errors.New("not open") }
+func (brokenSource) Live() bool            { return false }
+func (brokenSource) Close() error          { return nil }
+
+func TestPoolRemovesFailedStreamer(t *testing.T) {
+
+	pool := NewStreamingPool()
+	create := func() (*Streamer, error) {
+		return New(WithContentName("broken.ts"), WithSource(brokenSource{})), nil
+	}
+
+	stmr, created, err := pool.Join("broken.ts", "a", "127.0.0.1:40000", create)
+	if err != nil || !created {
+		t.Fatalf("Expected a new streamer, but got created=%v err=%v", created, err)
+	}
+
+	pool.Run("broken.ts", stmr) // returns once the source fails
+
+	if pool.Len() != 0 {
+		t.Fatalf("Expected the failed streamer to be removed, but the pool has %d", pool.Len())
+	}
+
+	again, created, err := pool.Join("broken.ts", "b", "127.0.0.1:40001", create)
+	if err != nil || !created || again == stmr {
+		t.Fatalf("Expected a new streamer after the failure, but got created=%v err=%v", created, err)
+	}
+	again.Teardown()
+}
+
+func TestJoinReplacesEndedStreamer(t *testing.T) {
+
+	pool := NewStreamingPool()
+	create := func() (*Streamer, error) {
+		return New(WithContentName("broken.ts"), WithSource(brokenSource{})), nil
+	}
+
+	stmr, _, _ := pool.Join("broken.ts", "a", "127.0.0.1:40000", create)
+	stmr.Stream() // failed, but still in the pool
+
+	again, created, err := pool.Join("broken.ts", "b", "127.0.0.1:40001", create)
+	if err != nil || !created || again == stmr {
+		t.Fatalf("Expected the ended streamer to be replaced, but got created=%v err=%v", created, err)
+	}
+	again.Teardown()
+}
+
+func TestLeaveAllKeepsOtherRequesters(t *testing.T) {
+
+	pool := NewStreamingPool()
+	create := func() (*Streamer, error) {
+		return New(WithSource(brokenSource{})), nil
+	}
+
+	shared, _, _ := pool.Join("shared.ts", "a", "127.0.0.1:40000", create)
+	_, _, _ = pool.Join("shared.ts", "b", "127.0.0.1:40000", create)
+	_, _, _ = pool.Join("own.ts", "a", "127.0.0.1:40001", create)
+
+	if removed := pool.LeaveAll("a"); removed != 2 {
+		t.Fatalf("Expected 'a' to be removed from 2 streamers, but got %d", removed)
+	}
+
+	if pool.Len() != 1 || shared.Destinations() != 1 {
+		t.Fatalf("Expected only the streamer shared with 'b' to be left, but got %d streamers", pool.Len())
+	}
+	shared.Teardown()
+}
+
+func TestJoinAgainMovesRequester(t *testing.T) {
+
+	pool := NewStreamingPool()
+	create := func() (*Streamer, error) {
+		return New(WithSource(brokenSource{})), nil
+	}
+
+	stmr, _, _ := pool.Join("video.ts", "a", "127.0.0.1:40000", create)
+
+	if _, _, err := pool.Join("video.ts", "a", "127.0.0.1:40001", create); err != nil {
+		t.Fatalf("Expected the requester to join again, but got %v", err)
+	}
+
+	if stmr.Destinations() != 1 || !stmr.HasAddress("127.0.0.1:40001") {
+		t.Fatalf("Expected a single destination at 127.0.0.1:40001, but got %d destinations", stmr.Destinations())
+	}
+	stmr.Teardown()
+}
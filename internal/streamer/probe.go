@@ -0,0 +1,97 @@
+package streamer
+
+import (
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ProbeInfo holds the properties of a video file found by Probe.
+type ProbeInfo struct {
+	Width    uint
+	Height   uint
+	FPS      uint
+	Duration float64 // seconds
+	Bitrate  uint    // kilobits per second, 0 when unknown
+}
+
+// ffprobeOutput is the subset of the ffprobe json output that is used.
+type ffprobeOutput struct {
+	Streams []struct {
+		Width        uint   `json:"width"`
+		Height       uint   `json:"height"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+		RFrameRate   string `json:"r_frame_rate"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+		BitRate  string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// Probe detects the resolution, frame rate, duration and bitrate of the video file at path using ffprobe.
+func Probe(path string) (ProbeInfo, error) {
+
+	ffprobe := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height,avg_frame_rate,r_frame_rate:format=duration,bit_rate",
+		"-of", "json",
+		path,
+	)
+
+	out, err := ffprobe.Output()
+	if err != nil {
+		return ProbeInfo{}, errors.New("ffprobe failed on '" + path + "': " + err.Error())
+	}
+
+	var result ffprobeOutput
+	if err := json.Unmarshal(out, &result); err != nil {
+		return ProbeInfo{}, err
+	}
+
+	if len(result.Streams) == 0 {
+		return ProbeInfo{}, errors.New("no video stream found in '" + path + "'")
+	}
+
+	stream := result.Streams[0]
+
+	fps := parseFrameRate(stream.AvgFrameRate)
+	if fps == 0 {
+		fps = parseFrameRate(stream.RFrameRate)
+	}
+
+	duration, _ := strconv.ParseFloat(result.Format.Duration, 64) // absent for some live formats
+	bitrate, _ := strconv.ParseUint(result.Format.BitRate, 10, 64)
+
+	return ProbeInfo{
+		Width:    stream.Width,
+		Height:   stream.Height,
+		FPS:      fps,
+		Duration: duration,
+		Bitrate:  uint(bitrate / 1000),
+	}, nil
+}
+
+// parseFrameRate parses an ffprobe frame rate such as '30000/1001', rounding to the nearest integer.
+func parseFrameRate(rate string) uint {
+
+	num, den, found := strings.Cut(rate, "/")
+	if !found {
+		den = "1"
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+
+	return uint(n/d + 0.5)
+}
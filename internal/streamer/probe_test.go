@@ -0,0 +1,26 @@
+package streamer
+
+import "testing"
+
+func TestParseFrameRate(t *testing.T) {
+
+	tests := []struct {
+		rate     string
+		expected uint
+	}{
+		{"25/1", 25},
+		{"30000/1001", 30}, // 29.97
+		{"24000/1001", 24}, // 23.976
+		{"60", 60},
+		{"0/0", 0},
+		{"", 0},
+		{"abc/1", 0},
+		{"30/abc", 0},
+	}
+
+	for _, tt := range tests {
+		if fps := parseFrameRate(tt.rate); fps != tt.expected {
+			t.Fatalf("Expected '%v' to be %d fps, but got %d", tt.rate, tt.expected, fps)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package streamer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SourceKind names the kind of Source a content is streamed from.
+type SourceKind string
+
+const (
+	FileSourceKind      SourceKind = "ts"        // pre-encoded transport stream file
+	TranscodeSourceKind SourceKind = "ffmpeg"    // video file transcoded on demand with ffmpeg
+	LiveSourceKind      SourceKind = "live"      // live stream received by an Ingest
+	GeneratorSourceKind SourceKind = "generator" // transport stream generated in memory
+)
+
+var (
+	// ErrRestart is returned by Source.Next when the stream restarted from the beginning,
+	// the clock of the stream restarts as well.
+	ErrRestart = errors.New("source restarted from the beginning")
+	// ErrClosed is returned by Source.Next once the source is closed, and by
+	// FileSource.Open when it was closed before being opened.
+	ErrClosed = errors.New("source is closed")
+	// ErrEmpty is returned by Source.Next when the source restarted without yielding
+	// anything since it last did, e.g. an empty file.
+	ErrEmpty = errors.New("source is empty")
+)
+
+// Source yields chunks of transport stream packets to a Streamer.
+// Close may be called concurrently with Next, in order to interrupt it,
+// and more than once.
+type Source interface {
+	// Open prepares the source for reading.
+	Open() error
+	// Next returns the next chunk of packets, only valid until the next call.
+	Next() ([]byte, error)
+	// Live reports whether the chunks already arrive in realtime, so no pacing is needed.
+	Live() bool
+	// Close releases the resources of the source.
+	Close() error
+}
+
+/* ----------------------------------------------------------------------------- */
+
+// FileSource reads a pre-encoded transport stream file, looping over it.
+type FileSource struct {
+	Path string
+
+	file   *os.File
+	buffer []byte
+	// bytes read since the file was opened or last restarted.
+	read int
+
+	// file and closed mutex, Close may be called before or while Open is.
+	mu     sync.Mutex
+	closed bool
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{
+		Path:   path,
+		buffer: make([]byte, TsMtu*10),
+	}
+}
+
+func (f *FileSource) Open() error {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ErrClosed
+	} // the file would never be closed
+
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return err
+	}
+
+	f.file = file
+	return nil
+}
+
+func (f *FileSource) Next() ([]byte, error) {
+
+	n, err := f.file.Read(f.buffer)
+	if errors.Is(err, io.EOF) {
+		if f.read == 0 {
+			return nil, ErrEmpty
+		} // restarting would yield nothing again
+
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		f.read = 0
+		return nil, ErrRestart
+	} // loop over the video once we reach the end
+
+	if err != nil {
+		return nil, err
+	}
+
+	f.read += n
+	return f.buffer[:n], nil
+}
+
+func (f *FileSource) Live() bool {
+	return false
+}
+
+func (f *FileSource) Close() error {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	if f.file != nil {
+		return f.file.Close()
+	}
+	return nil
+}
+
+/* ----------------------------------------------------------------------------- */
+
+// TranscodeSource encodes a video file into a transport stream with ffmpeg, unless
+// it was already encoded before, and then reads it as a FileSource.
+type TranscodeSource struct {
+	*FileSource
+
+	// path of the original video file.
+	VideoPath string
+}
+
+// NewTranscodeSource creates a TranscodeSource for videoPath, the transport stream
+// is kept at TsDir, see TranscodedPath.
+func NewTranscodeSource(videoPath string) *TranscodeSource {
+	return &TranscodeSource{
+		FileSource: NewFileSource(TranscodedPath(videoPath)),
+		VideoPath:  videoPath,
+	}
+}
+
+// TranscodedPath returns where the transport stream of videoPath is kept, named after
+// its base name and a hash of its full path, so that videos with the same name in
+// different directories do not share it.
+func TranscodedPath(videoPath string) string {
+
+	if abs, err := filepath.Abs(videoPath); err == nil {
+		videoPath = abs
+	}
+
+	base := filepath.Base(videoPath)
+	hash := sha256.Sum256([]byte(videoPath))
+
+	return TsDir + strings.TrimSuffix(base, filepath.Ext(base)) + "-" + hex.EncodeToString(hash[:])[:16] + ".ts"
+}
+
+// encodeTransportStream, encodes the video into an MPEG Transport Stream using FFMPEG.
+func (t *TranscodeSource) encodeTransportStream() error {
+
+	log.Printf("encoding video '%v' into transport stream...\n", t.VideoPath)
+	ffmpeg := exec.Command("ffmpeg",
+		"-i", t.VideoPath,
+		"-c:v", "libx264", "-c:a", "mp2",
+		t.Path,
+	)
+
+	return ffmpeg.Run()
+}
+
+func (t *TranscodeSource) Open() error {
+
+	if _, err := os.Stat(t.Path); errors.Is(err, os.ErrNotExist) {
+
+		if err := t.encodeTransportStream(); err != nil {
+			return errors.New("could not encode '" + t.VideoPath + "' into mpeg-ts: " + err.Error())
+		}
+
+		log.Printf("finished encoding '%v'\n", t.VideoPath)
+	}
+
+	return t.FileSource.Open()
+}
+
+/* ----------------------------------------------------------------------------- */
+
+// IngestSource forwards the live stream received by an Ingest.
+type IngestSource struct {
+	Ingest *Ingest
+
+	id     int
+	chunks <-chan []byte
+	done   chan struct{}
+	once   sync.Once
+}
+
+func NewIngestSource(ingest *Ingest) *IngestSource {
+	return &IngestSource{
+		Ingest: ingest,
+		done:   make(chan struct{}),
+	}
+}
+
+func (i *IngestSource) Open() error {
+	i.id, i.chunks = i.Ingest.Subscribe()
+	return nil
+}
+
+func (i *IngestSource) Next() ([]byte, error) {
+	select {
+	case chunk, ok := <-i.chunks:
+		if !ok {
+			return nil, ErrClosed
+		} // the ingest was stopped
+		return chunk, nil
+	case <-i.done:
+		return nil, ErrClosed
+	}
+}
+
+func (i *IngestSource) Live() bool {
+	return true
+}
+
+func (i *IngestSource) Close() error {
+	i.once.Do(func() {
+		if i.chunks != nil {
+			i.Ingest.Unsubscribe(i.id)
+		}
+		close(i.done)
+	})
+	return nil
+}
+
+/* ----------------------------------------------------------------------------- */
+
+// Generator produces the next chunk of a transport stream, returning ErrRestart
+// when its clock starts over.
+type Generator func() ([]byte, error)
+
+// generators holds the known generators by name, each entry creates a new Generator.
+var (
+	generators   = make(map[string]func() Generator)
+	generatorsMu sync.RWMutex
+)
+
+// RegisterGenerator makes a generator available to GeneratorSource by its name.
+func RegisterGenerator(name string, factory func() Generator) {
+	generatorsMu.Lock()
+	defer generatorsMu.Unlock()
+
+	generators[name] = factory
+}
+
+// GeneratorExists checks whether a generator was registered with name.
+func GeneratorExists(name string) bool {
+	generatorsMu.RLock()
+	defer generatorsMu.RUnlock()
+
+	_, exists := generators[name]
+	return exists
+}
+
+// GeneratorSource yields the transport stream produced in memory by a registered Generator.
+type GeneratorSource struct {
+	Name string
+
+	generate Generator
+	done     chan struct{}
+	once     sync.Once
+}
+
+func NewGeneratorSource(name string) *GeneratorSource {
+	return &GeneratorSource{
+		Name: name,
+		done: make(chan struct{}),
+	}
+}
+
+func (g *GeneratorSource) Open() error {
+
+	generatorsMu.RLock()
+	factory, exists := generators[g.Name]
+	generatorsMu.RUnlock()
+
+	if !exists {
+		return errors.New("generator '" + g.Name + "' does not exist")
+	}
+
+	g.generate = factory()
+	return nil
+}
+
+func (g *GeneratorSource) Next() ([]byte, error) {
+	select {
+	case <-g.done:
+		return nil, ErrClosed
+	default:
+		return g.generate()
+	}
+}
+
+func (g *GeneratorSource) Live() bool {
+	return false
+}
+
+func (g *GeneratorSource) Close() error {
+	g.once.Do(func() {
+		close(g.done)
+	})
+	return nil
+}
@@ -0,0 +1,87 @@
+package streamer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSourceEmpty(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "empty.ts")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatalf("Expected the file to be created, but got %v", err)
+	}
+
+	source := NewFileSource(path)
+	if err := source.Open(); err != nil {
+		t.Fatalf("Expected the file to open, but got %v", err)
+	}
+	defer source.Close()
+
+	if _, err := source.Next(); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("Expected ErrEmpty, but got %v", err)
+	}
+}
+
+func TestFileSourceRestarts(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "video.ts")
+	if err := os.WriteFile(path, make([]byte, TsMtu), 0o644); err != nil {
+		t.Fatalf("Expected the file to be created, but got %v", err)
+	}
+
+	source := NewFileSource(path)
+	if err := source.Open(); err != nil {
+		t.Fatalf("Expected the file to open, but got %v", err)
+	}
+	defer source.Close()
+
+	expected := []error{nil, ErrRestart, nil, ErrRestart}
+	for i, want := range expected {
+		if _, err := source.Next(); !errors.Is(err, want) {
+			t.Fatalf("Expected %v on read %d, but got %v", want, i, err)
+		}
+	}
+}
+
+func TestFileSourceClosedBeforeOpen(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "video.ts")
+	if err := os.WriteFile(path, make([]byte, TsMtu), 0o644); err != nil {
+		t.Fatalf("Expected the file to be created, but got %v", err)
+	}
+
+	// torn down before the streamer got to open it
+	source := NewFileSource(path)
+	if err := source.Close(); err != nil {
+		t.Fatalf("Expected the source to close, but got %v", err)
+	}
+
+	if err := source.Open(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Expected ErrClosed, but got %v", err)
+	}
+
+	if source.file != nil {
+		t.Fatalf("Expected the file not to be opened once the source is closed")
+	}
+}
+
+func TestTranscodedPath(t *testing.T) {
+
+	first := TranscodedPath("/videos/a/movie.mp4")
+	second := TranscodedPath("/videos/b/movie.mp4")
+
+	if first == second {
+		t.Fatalf("Expected different paths for videos in different directories, but got '%v' twice", first)
+	}
+
+	if first != TranscodedPath("/videos/a/movie.mp4") {
+		t.Fatalf("Expected the same path for the same video, but got '%v'", first)
+	}
+
+	if filepath.Ext(first) != ".ts" || filepath.Dir(first)+"/" != TsDir {
+		t.Fatalf("Expected a '.ts' file in '%v', but got '%v'", TsDir, first)
+	}
+}
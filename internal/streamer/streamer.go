@@ -1,61 +1,97 @@
 package streamer
 
 import (
+	"errors"
+	"github.com/gweebg/mcast/internal/ts"
 	"github.com/gweebg/mcast/internal/utils"
 	"log"
 	"net"
-	"os"
-	"os/exec"
-	"strings"
+	"sync"
+	"time"
 )
 
 const (
 	VideoDir string = "resources/videos/"
 	TsDir    string = "resources/ts/"
 
-	TsMtu int = 188
+	TsMtu int = ts.PacketSize
+
+	// BitrateWindow is the period over which the outgoing bitrate is measured.
+	BitrateWindow = time.Second
+	// weight of a new measurement in the smoothed bitrate.
+	bitrateWeight = 0.3
 )
 
 type Option func(*Streamer)
 
 type Streamer struct {
-	Address     string
 	ContentName string
 	IsStreaming bool
 
-	contentPath         string
-	transportStreamPath string
-	stopChannel         chan struct{}
-
-	conn net.Conn
+	// where the transport stream chunks come from.
+	source      Source
+	stopChannel chan struct{}
+	stopOnce    sync.Once
+	// closed once Stream returns, for whatever reason.
+	ended chan struct{}
+
+	// addresses the content is streamed to, by requester.
+	destinations map[string]*net.UDPAddr
+	// destinations mutex, requesters join and leave while streaming.
+	dMu sync.RWMutex
+
+	conn *net.UDPConn
+
+	// smoothed bitrate of the content in bits per second, starts as the estimate
+	// given by WithBitrate and is measured from the sent chunks afterwards.
+	bitrate float64
+	// bytes sent to a single destination since windowStart.
+	sent        uint64
+	windowStart time.Time
+	// bitrate mutex.
+	bMu sync.Mutex
 }
 
 func New(options ...Option) *Streamer {
 
 	streamer := &Streamer{
-		Address:     "127.0.0.1:5000",
-		ContentName: "video.mp4",
-		IsStreaming: false,
-		stopChannel: make(chan struct{}),
+		ContentName:  "video.mp4",
+		IsStreaming:  false,
+		stopChannel:  make(chan struct{}),
+		ended:        make(chan struct{}),
+		destinations: make(map[string]*net.UDPAddr),
 	}
 
 	for _, opt := range options {
 		opt(streamer)
 	}
 
-	conn, err := net.Dial("udp", streamer.Address)
+	if streamer.source == nil {
+		streamer.source = NewTranscodeSource(VideoDir + streamer.ContentName)
+	} // default to the old behaviour, transcoding the video from VideoDir
+
+	conn, err := net.ListenUDP("udp", nil) // a single socket for every destination
 	utils.Check(err)
 
 	streamer.conn = conn
-	streamer.contentPath = VideoDir + streamer.ContentName
 
 	return streamer
 
 }
 
-func WithAddress(addr string) Option {
+// WithDestination makes the streamer send the content to addr on behalf of requester.
+func WithDestination(requester string, addr string) Option {
+	return func(s *Streamer) {
+		err := s.AddDestination(requester, addr)
+		utils.Check(err)
+	}
+}
+
+// WithBitrate sets the estimated bitrate of the content, in bits per second,
+// used until the actual one is measured.
+func WithBitrate(bps float64) Option {
 	return func(s *Streamer) {
-		s.Address = addr
+		s.bitrate = bps
 	}
 }
 
@@ -65,139 +101,220 @@ func WithContentName(name string) Option {
 	}
 }
 
-// encodeTransportStream, encodes the video (ContentName) into an MPEG Transport Stream using FFMPEG.
-func (s *Streamer) encodeTransportStream() (err error) {
+// WithSource sets the Source the streamer reads the transport stream from.
+func WithSource(source Source) Option {
+	return func(s *Streamer) {
+		s.source = source
+	}
+}
 
-	log.Printf("encoding video '%v' into transport stream...\n", s.ContentName)
-	ffmpeg := exec.Command("ffmpeg",
-		"-i", s.contentPath,
-		"-c:v", "libx264", "-c:a", "mp2",
-		s.transportStreamPath,
-	)
+// AddDestination starts sending the content to addr on behalf of requester.
+func (s *Streamer) AddDestination(requester string, addr string) error {
 
-	err = ffmpeg.Run()
-	return err
-}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
 
-// Returns the transport stream file descriptor.
-func (s *Streamer) getTransportStream() *os.File {
+	s.dMu.Lock()
+	defer s.dMu.Unlock()
 
-	file, err := os.Open(s.transportStreamPath)
-	utils.Check(err)
+	if _, exists := s.destinations[requester]; exists {
+		return errors.New("already streaming '" + s.ContentName + "' for " + requester)
+	}
 
-	return file
+	s.destinations[requester] = udpAddr
+	return nil
 }
 
-// SetupVideo sets up the necessary resources to start the video transmission.
-// Returns the file descriptor of the transport stream.
-func (s *Streamer) SetupVideo() *os.File {
+// RemoveDestination stops sending the content on behalf of requester, returns
+// how many destinations are left.
+func (s *Streamer) RemoveDestination(requester string) (int, error) {
 
-	tsExists := false
+	s.dMu.Lock()
+	defer s.dMu.Unlock()
 
-	transportStreamFilename := strings.Split(s.ContentName, ".")[0] + ".ts"
-	s.transportStreamPath = TsDir + transportStreamFilename
+	if _, exists := s.destinations[requester]; !exists {
+		return len(s.destinations), errors.New("not streaming '" + s.ContentName + "' for " + requester)
+	}
 
-	entries, err := os.ReadDir(TsDir)
-	utils.Check(err)
+	delete(s.destinations, requester)
+	return len(s.destinations), nil
+}
+
+// HasAddress checks whether addr is one of the destinations.
+func (s *Streamer) HasAddress(addr string) bool {
+
+	s.dMu.RLock()
+	defer s.dMu.RUnlock()
 
-	for _, e := range entries {
-		if e.Name() == transportStreamFilename {
-			tsExists = true
+	for _, dest := range s.destinations {
+		if dest.String() == addr {
+			return true
 		}
 	}
+	return false
+}
 
-	if !tsExists {
-		err = s.encodeTransportStream()
+// Destinations returns the number of destinations the content is streamed to.
+func (s *Streamer) Destinations() int {
+	s.dMu.RLock()
+	defer s.dMu.RUnlock()
 
-		if err != nil {
-			log.Fatalf("could not encode '%v' into mpeg-ts\n%v", s.ContentName, err.Error())
-		}
+	return len(s.destinations)
+}
+
+// Bitrate returns the bitrate of the content in bits per second, as sent to a single destination.
+func (s *Streamer) Bitrate() float64 {
+	s.bMu.Lock()
+	defer s.bMu.Unlock()
+
+	return s.bitrate
+}
+
+// Throughput returns the outgoing bitrate of the streamer in bits per second, across every destination.
+func (s *Streamer) Throughput() float64 {
+	return s.Bitrate() * float64(s.Destinations())
+}
+
+// account adds n sent bytes to the bitrate measurement.
+func (s *Streamer) account(n int) {
+	s.bMu.Lock()
+	defer s.bMu.Unlock()
+
+	now := time.Now()
+	if s.windowStart.IsZero() {
+		s.windowStart = now
+	}
+
+	s.sent += uint64(n)
+
+	elapsed := now.Sub(s.windowStart)
+	if elapsed < BitrateWindow {
+		return
+	}
 
-		log.Printf("finished encoding '%v'\n", s.ContentName)
+	measured := float64(s.sent*8) / elapsed.Seconds()
+	if s.bitrate == 0 {
+		s.bitrate = measured
+	} else {
+		s.bitrate = (1-bitrateWeight)*s.bitrate + bitrateWeight*measured
 	}
 
-	return s.getTransportStream()
+	s.sent = 0
+	s.windowStart = now
+}
+
+// send writes chunk to every destination.
+func (s *Streamer) send(chunk []byte) {
+
+	s.account(len(chunk))
+
+	s.dMu.RLock()
+	defer s.dMu.RUnlock()
+
+	for requester, dest := range s.destinations {
+		if _, err := s.conn.WriteToUDP(chunk, dest); err != nil {
+			log.Printf("(streamer %v) cannot send to '%v' for %v\n", s.ContentName, dest.String(), requester)
+		}
+	}
 }
 
-// Cleans up the dangling connection, command and streaming status once the streamer receives the stop signal.
-func (s *Streamer) cleanup(cmd *exec.Cmd, close bool) {
+// Cleans up the dangling connection and streaming status once the streamer receives the stop signal.
+func (s *Streamer) cleanup() {
 
 	s.IsStreaming = false // no longer streaming
 
-	err := cmd.Process.Kill() // kill the ffplay sync command
+	err := s.conn.Close() // closing udp connection
 	utils.Check(err)
+}
 
-	if close {
-		err = s.conn.Close() // closing udp connection
-		utils.Check(err)
+// stopped checks whether Teardown was called.
+func (s *Streamer) stopped() bool {
+	select {
+	case <-s.stopChannel:
+		return true
+	default:
+		return false
 	}
 }
 
-// Stream starts the streaming process of the video.
-// Firstly sets up the mpeg-ts resources, then streams the content via udp to via conn.
+// Ended checks whether the streamer stopped streaming, either torn down or because its source failed.
+func (s *Streamer) Ended() bool {
+	if s.stopped() {
+		return true
+	}
+
+	select {
+	case <-s.ended:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stream starts the streaming process of the content.
+// Firstly opens the source, then streams its chunks via udp to every destination.
+// Non live sources are paced by the PCR timestamps of the transport stream,
+// so that 1s of realtime matches 1s of video.
 func (s *Streamer) Stream() {
 
 	s.IsStreaming = true // todo: not updating ?
+	defer close(s.ended)
 
-	ts := s.SetupVideo()
+	err := s.source.Open()
+	if err != nil {
+		log.Printf("(streamer %v) could not open source: %v\n", s.ContentName, err)
+		s.cleanup()
+		return
+	}
 
-	defer func(ts *os.File) {
-		err := ts.Close()
+	defer func(source Source) {
+		err := source.Close()
 		if err != nil {
-			utils.Check(err)
+			log.Printf("(streamer %v) could not close source: %v\n", s.ContentName, err)
 		}
-	}(ts)
-
-	// used to sync the mpeg-ts packets with realtime (1s realtime matching with 1s video)
-	sync := exec.Command("ffplay", "-af", "volume=0.0", "-f", "mpegts", "-nodisp", "-")
+	}(s.source)
 
-	syncIn, err := sync.StdinPipe()
-	utils.Check(err)
-
-	err = sync.Start() // start sync process via ffplay
-	utils.Check(err)
+	pacer := NewPacer()
 
-	log.Printf("(handling %v) started streaming '%v'\n", s.Address, s.ContentName)
+	log.Printf("(streamer %v) started streaming\n", s.ContentName)
 
-	seq := 0
-	buffer := make([]byte, TsMtu*10)
 	for {
 
-		select {
-
-		case <-s.stopChannel: // breakdown connection and stop streaming
-			s.cleanup(sync, true)
-			break
-
-		default: // transmit the data via udp
-			size, err := ts.Read(buffer)
-			if err != nil {
-				_, err := ts.Seek(0, 0) // error on read => loop
-				utils.Check(err)
-				seq = 0 // set sequence to 0
-			} // loop over the video once we reach the end
+		if s.stopped() { // breakdown connection and stop streaming
+			s.cleanup()
+			return
+		}
 
-			_, err = syncIn.Write(buffer[:size])
-			if err != nil {
-				break
-			}
+		chunk, err := s.source.Next()
+		if errors.Is(err, ErrRestart) {
+			pacer.Reset() // the clock restarts with the video
+			continue
+		}
 
-			_, err = s.conn.Write(buffer[:size])
-			if err != nil {
-				log.Printf("(streamer %v, %v) lost connection\n", s.Address, s.ContentName)
-				s.cleanup(sync, false)
-				return
+		if err != nil {
+			if !s.stopped() {
+				log.Printf("(streamer %v) source failed: %v\n", s.ContentName, err)
 			}
+			s.cleanup()
+			return
+		}
 
-			// todo: remove
-			log.Printf("sent packet #%d (%d bytes)\n", seq, size)
-			seq++
+		if !s.source.Live() {
+			pacer.Wait(chunk) // wait until the chunk is due
 		}
+
+		s.send(chunk)
 	}
 }
 
-// Teardown stops the streaming by triggering the stopChannel.
+// Teardown stops the streaming by closing the stopChannel, the source is
+// closed as well in order to interrupt any blocking read.
 func (s *Streamer) Teardown() {
 	log.Println("teardown triggered")
-	s.stopChannel <- struct{}{}
+	s.stopOnce.Do(func() {
+		close(s.stopChannel)
+		_ = s.source.Close()
+	})
 }
@@ -0,0 +1,58 @@
+package streamer
+
+import (
+	"fmt"
+
+	"github.com/gweebg/mcast/internal/ts"
+)
+
+const (
+	// TestPatternName is the name the test pattern generator is registered with.
+	TestPatternName = "testpattern"
+	// TestPatternFPS is the number of test pattern frames generated per second.
+	TestPatternFPS uint64 = 25
+
+	testPatternProgram uint16 = 1
+	testPatternPmtPid  uint16 = 0x1000
+	testPatternPid     uint16 = 0x0100
+	testPatternStream  uint8  = 0xbd // private stream 1
+
+	// delay between the pcr and the pts of a frame, as a decoder would expect.
+	testPatternPtsDelay = ts.PtsClock / 10
+)
+
+func init() {
+	RegisterGenerator(TestPatternName, NewTestPattern)
+}
+
+// NewTestPattern creates a Generator of a synthetic transport stream that needs no ffmpeg.
+// Each call yields one frame: PAT, PMT and a private PES packet carrying the frame counter
+// and its timestamps, the first packet of the PES carries the PCR of the frame.
+func NewTestPattern() Generator {
+
+	mux := ts.NewMuxer()
+	streams := []ts.ElementaryStream{{Type: ts.StreamTypePrivatePES, PID: testPatternPid}}
+
+	frame := uint64(0)
+
+	return func() ([]byte, error) {
+
+		pcr := frame * ts.PcrClock / TestPatternFPS
+		pts := frame*ts.PtsClock/TestPatternFPS + testPatternPtsDelay
+
+		data := fmt.Sprintf("mcast test pattern frame=%d pcr=%d pts=%d", frame, pcr, pts)
+
+		chunk := mux.PAT(testPatternProgram, testPatternPmtPid)
+		chunk = append(chunk, mux.PMT(testPatternPmtPid, testPatternProgram, testPatternPid, streams)...)
+		chunk = append(chunk, mux.PES(
+			testPatternPid,
+			testPatternStream,
+			pts,
+			&ts.AdaptationField{RandomAccess: true, HasPCR: true, PCR: pcr},
+			[]byte(data),
+		)...)
+
+		frame++
+		return chunk, nil
+	}
+}
@@ -0,0 +1,70 @@
+package streamer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gweebg/mcast/internal/ts"
+)
+
+func TestTestPattern(t *testing.T) {
+
+	source := NewGeneratorSource(TestPatternName)
+	if err := source.Open(); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	defer source.Close()
+
+	demuxer := ts.NewDemuxer()
+
+	for frame := uint64(0); frame < 2*TestPatternFPS; frame++ {
+
+		chunk, err := source.Next()
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+
+		if len(chunk)%ts.PacketSize != 0 {
+			t.Fatalf("Expected chunk size multiple of %d, but got %d", ts.PacketSize, len(chunk))
+		}
+
+		pcrs, pes := 0, 0
+		for off := 0; off < len(chunk); off += ts.PacketSize {
+
+			info, err := demuxer.Demux(chunk[off : off+ts.PacketSize])
+			if err != nil {
+				t.Fatalf("(frame %d) Expected no error, but got %v", frame, err)
+			}
+
+			if info.Lost != 0 {
+				t.Fatalf("(frame %d) Expected no loss, but got %d", frame, info.Lost)
+			}
+
+			if info.Packet.HasPCR() {
+				pcrs++
+				if expected := frame * ts.PcrClock / TestPatternFPS; info.Packet.Adaptation.PCR != expected {
+					t.Fatalf("(frame %d) Expected pcr %d, but got %d", frame, expected, info.Packet.Adaptation.PCR)
+				}
+			}
+
+			if info.PES != nil {
+				pes++
+				if expected := frame*ts.PtsClock/TestPatternFPS + testPatternPtsDelay; info.PES.PTS != expected {
+					t.Fatalf("(frame %d) Expected pts %d, but got %d", frame, expected, info.PES.PTS)
+				}
+
+				if _, es, _ := ts.ParsePES(info.Packet.Payload); !bytes.HasPrefix(es, []byte("mcast test pattern")) {
+					t.Fatalf("(frame %d) Expected test pattern payload, but got %q", frame, es)
+				}
+			}
+		}
+
+		if pcrs != 1 || pes != 1 {
+			t.Fatalf("(frame %d) Expected 1 pcr and 1 pes, but got %d and %d", frame, pcrs, pes)
+		}
+	}
+
+	if len(demuxer.PMTs) != 1 {
+		t.Fatalf("Expected 1 pmt, but got %d", len(demuxer.PMTs))
+	}
+}
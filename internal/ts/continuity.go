@@ -0,0 +1,42 @@
+package ts
+
+// ContinuityChecker keeps track of the continuity counter of each PID
+// in order to detect lost packets.
+type ContinuityChecker struct {
+	last map[uint16]uint8
+}
+
+// NewContinuityChecker creates an empty ContinuityChecker.
+func NewContinuityChecker() *ContinuityChecker {
+	return &ContinuityChecker{
+		last: make(map[uint16]uint8),
+	}
+}
+
+// Check updates the counter of the packet's PID and returns how many packets were
+// lost between the previous packet of the same PID and p. Duplicate packets,
+// packets without payload and signalled discontinuities never count as losses.
+func (c *ContinuityChecker) Check(p Packet) int {
+
+	if p.PID == PidNull || !p.HasPayload() {
+		return 0
+	} // counter is not incremented for null packets or packets without payload
+
+	last, seen := c.last[p.PID]
+	c.last[p.PID] = p.ContinuityCounter
+
+	if !seen || (p.Adaptation != nil && p.Adaptation.Discontinuity) {
+		return 0
+	}
+
+	if p.ContinuityCounter == last {
+		return 0
+	} // duplicate packet
+
+	return int((p.ContinuityCounter - last - 1) & 0x0f)
+}
+
+// Reset forgets every known counter, e.g. when the stream restarts.
+func (c *ContinuityChecker) Reset() {
+	c.last = make(map[uint16]uint8)
+}
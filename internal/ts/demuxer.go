@@ -0,0 +1,112 @@
+package ts
+
+// Info is the result of demultiplexing a single packet.
+type Info struct {
+	Packet Packet
+
+	// IsPSI is set when the packet carries a PAT or a PMT.
+	IsPSI bool
+	// StreamType is the PMT stream type of the packet's PID, 0 when unknown.
+	StreamType uint8
+	// RandomAccess is set when the packet starts a random access point of a video stream.
+	RandomAccess bool
+	// PES holds the PES header when the packet starts a PES packet.
+	PES *PESHeader
+	// Lost is the number of packets of the same PID lost before this one.
+	Lost int
+}
+
+// Demuxer follows the PAT/PMT of a transport stream in order to give meaning
+// to each packet: which stream it belongs to, whether it starts a random
+// access point and whether packets were lost before it.
+type Demuxer struct {
+	// PAT is the last program association table received.
+	PAT PAT
+	// PMTs holds the last program map table of each program, by PMT PID.
+	PMTs map[uint16]PMT
+	// Lost is the total number of packets lost since the demuxer was created.
+	Lost uint64
+
+	// stream type of each elementary stream PID.
+	streams    map[uint16]uint8
+	continuity *ContinuityChecker
+}
+
+// NewDemuxer creates a Demuxer with no program information.
+func NewDemuxer() *Demuxer {
+	return &Demuxer{
+		PMTs:       make(map[uint16]PMT),
+		streams:    make(map[uint16]uint8),
+		continuity: NewContinuityChecker(),
+	}
+}
+
+// Reset drops the program information and the continuity counters.
+func (d *Demuxer) Reset() {
+	d.PAT = PAT{}
+	d.PMTs = make(map[uint16]PMT)
+	d.streams = make(map[uint16]uint8)
+	d.continuity.Reset()
+}
+
+// isPMT checks whether pid is listed as a PMT PID in the current PAT.
+func (d *Demuxer) isPMT(pid uint16) bool {
+	for program, pmtPid := range d.PAT.Programs {
+		if program != 0 && pmtPid == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// Demux parses the packet at the start of b and updates the program information.
+func (d *Demuxer) Demux(b []byte) (Info, error) {
+
+	p, err := Parse(b)
+	if err != nil {
+		return Info{}, err
+	}
+
+	info := Info{Packet: p}
+
+	info.Lost = d.continuity.Check(p)
+	d.Lost += uint64(info.Lost)
+
+	switch {
+
+	case p.PID == PidPAT:
+		info.IsPSI = true
+		if p.PayloadUnitStart {
+			if pat, err := ParsePAT(p.Payload); err == nil {
+				d.PAT = pat
+			}
+		}
+
+	case d.isPMT(p.PID):
+		info.IsPSI = true
+		if p.PayloadUnitStart {
+			if pmt, err := ParsePMT(p.Payload); err == nil {
+				d.PMTs[p.PID] = pmt
+				for _, es := range pmt.Streams {
+					d.streams[es.PID] = es.Type
+				}
+			}
+		}
+
+	default:
+		info.StreamType = d.streams[p.PID]
+
+		if p.PayloadUnitStart && p.HasPayload() {
+			if pes, es, err := ParsePES(p.Payload); err == nil {
+				info.PES = &pes
+				info.RandomAccess = IsKeyframe(info.StreamType, es)
+			}
+		}
+
+		if p.RandomAccess() && (ElementaryStream{Type: info.StreamType}).IsVideo() {
+			info.RandomAccess = true
+		}
+	}
+
+	return info, nil
+}
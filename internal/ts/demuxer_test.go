@@ -0,0 +1,154 @@
+package ts
+
+import (
+	"testing"
+)
+
+func TestParsePAT(t *testing.T) {
+
+	p, err := Parse(readFixture(t, "simple.ts")[0])
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	pat, err := ParsePAT(p.Payload)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if pid, exists := pat.Programs[1]; !exists || pid != 0x1000 {
+		t.Fatalf("Expected program 1 at pid 0x1000, but got %v", pat.Programs)
+	}
+
+	corrupted := append([]byte{}, p.Payload...)
+	corrupted[10] ^= 0xff
+
+	if _, err := ParsePAT(corrupted); err != ErrCRC {
+		t.Fatalf("Expected %v, but got %v", ErrCRC, err)
+	}
+
+	if _, err := ParsePMT(p.Payload); err != ErrTableId {
+		t.Fatalf("Expected %v, but got %v", ErrTableId, err)
+	}
+}
+
+func TestParsePMT(t *testing.T) {
+
+	p, err := Parse(readFixture(t, "simple.ts")[1])
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	pmt, err := ParsePMT(p.Payload)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if pmt.ProgramNumber != 1 {
+		t.Fatalf("Expected program 1, but got %d", pmt.ProgramNumber)
+	}
+
+	if pmt.PcrPID != 0x100 {
+		t.Fatalf("Expected pcr pid 0x0100, but got 0x%04x", pmt.PcrPID)
+	}
+
+	expected := []ElementaryStream{
+		{Type: StreamTypeH264, PID: 0x100},
+		{Type: StreamTypeAAC, PID: 0x101},
+	}
+
+	if len(pmt.Streams) != len(expected) {
+		t.Fatalf("Expected %d streams, but got %d", len(expected), len(pmt.Streams))
+	}
+
+	for i, es := range expected {
+		if pmt.Streams[i] != es {
+			t.Fatalf("Expected stream %v, but got %v", es, pmt.Streams[i])
+		}
+	}
+}
+
+func TestContinuity(t *testing.T) {
+
+	pkts := readFixture(t, "loss.ts")
+
+	tests := []struct {
+		name string
+		lost int
+	}{
+		{"first", 0},
+		{"in order", 0},
+		{"in order", 0},
+		{"gap", 2},
+		{"duplicate", 0},
+		{"adaptation only", 0},
+		{"discontinuity", 0},
+		{"gap", 5},
+		{"wrap around gap", 1},
+	}
+
+	if len(pkts) != len(tests) {
+		t.Fatalf("Expected %d packets, but got %d", len(tests), len(pkts))
+	}
+
+	checker := NewContinuityChecker()
+	for i, tt := range tests {
+
+		p, err := Parse(pkts[i])
+		if err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+
+		if lost := checker.Check(p); lost != tt.lost {
+			t.Fatalf("(packet %d, %v) Expected %d lost, but got %d", i, tt.name, tt.lost, lost)
+		}
+	}
+}
+
+func TestDemux(t *testing.T) {
+
+	pkts := readFixture(t, "simple.ts")
+
+	tests := []struct {
+		name         string
+		isPSI        bool
+		streamType   uint8
+		randomAccess bool
+		isPES        bool
+	}{
+		{"pat", true, 0, false, false},
+		{"pmt", true, 0, false, false},
+		{"video idr", false, StreamTypeH264, true, true},
+		{"video continuation", false, StreamTypeH264, false, false},
+		{"audio", false, StreamTypeAAC, false, true},
+		{"video non idr", false, StreamTypeH264, false, true},
+		{"null", false, 0, false, false},
+	}
+
+	d := NewDemuxer()
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			info, err := d.Demux(pkts[i])
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+
+			if info.IsPSI != tt.isPSI {
+				t.Fatalf("Expected psi %v, but got %v", tt.isPSI, info.IsPSI)
+			}
+			if info.StreamType != tt.streamType {
+				t.Fatalf("Expected stream type 0x%02x, but got 0x%02x", tt.streamType, info.StreamType)
+			}
+			if info.RandomAccess != tt.randomAccess {
+				t.Fatalf("Expected random access %v, but got %v", tt.randomAccess, info.RandomAccess)
+			}
+			if (info.PES != nil) != tt.isPES {
+				t.Fatalf("Expected pes %v, but got %v", tt.isPES, info.PES != nil)
+			}
+			if info.Lost != 0 {
+				t.Fatalf("Expected no loss, but got %d", info.Lost)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package ts
+
+// IsKeyframe checks whether the start of the elementary stream data es, taken from
+// a PES packet of the given stream type, begins a random access point.
+// For H.264/H.265 looks for IDR/CRA slices or parameter sets (which precede them),
+// for MPEG-1/2 video looks for a sequence header or a group of pictures.
+func IsKeyframe(streamType uint8, es []byte) bool {
+
+	for i := 0; i+3 < len(es); i++ {
+
+		if es[i] != 0x00 || es[i+1] != 0x00 || es[i+2] != 0x01 {
+			continue
+		} // not a start code
+
+		code := es[i+3]
+
+		switch streamType {
+
+		case StreamTypeH264:
+			switch code & 0x1f {
+			case 5, 7: // idr slice, sequence parameter set
+				return true
+			}
+
+		case StreamTypeH265:
+			switch (code >> 1) & 0x3f {
+			case 16, 17, 18, 19, 20, 21, 32, 33: // bla, idr, cra, vps, sps
+				return true
+			}
+
+		case StreamTypeMPEG1Video, StreamTypeMPEG2Video:
+			if code == 0xb3 || code == 0xb8 { // sequence header, group of pictures
+				return true
+			}
+
+		default:
+			return false
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,193 @@
+package ts
+
+// Muxer builds transport stream packets, keeping the continuity counter of each PID.
+type Muxer struct {
+	cc map[uint16]uint8
+}
+
+// NewMuxer creates a Muxer with every continuity counter at 0.
+func NewMuxer() *Muxer {
+	return &Muxer{
+		cc: make(map[uint16]uint8),
+	}
+}
+
+// nextCC returns the continuity counter for the next packet with payload of pid.
+func (m *Muxer) nextCC(pid uint16) uint8 {
+	cc := m.cc[pid]
+	m.cc[pid] = (cc + 1) & 0x0f
+	return cc
+}
+
+// packet builds a single packet, the payload is padded with adaptation field
+// stuffing when shorter than the available space. Returns the packet and how
+// many payload bytes were consumed.
+func (m *Muxer) packet(pid uint16, pusi bool, adaptation *AdaptationField, payload []byte) ([]byte, int) {
+
+	pkt := make([]byte, PacketSize)
+	pkt[0] = SyncByte
+	pkt[1] = byte(pid>>8) & 0x1f
+	if pusi {
+		pkt[1] |= 0x40
+	}
+	pkt[2] = byte(pid)
+
+	// adaptation field body, without the length byte
+	var af []byte
+	if adaptation != nil {
+		af = append(af, 0x00)
+		if adaptation.Discontinuity {
+			af[0] |= 0x80
+		}
+		if adaptation.RandomAccess {
+			af[0] |= 0x40
+		}
+		if adaptation.HasPCR {
+			af[0] |= 0x10
+			af = append(af, writeClockReference(adaptation.PCR)...)
+		}
+	}
+
+	room := PacketSize - 4
+	if af != nil {
+		room -= 1 + len(af)
+	}
+
+	n := min(len(payload), room)
+	if n < room {
+
+		if af == nil {
+			af = []byte{}
+			room--
+			if n < room {
+				af = append(af, 0x00) // flags byte, needed before stuffing
+				room--
+			}
+		}
+
+		for ; n < room; room-- {
+			af = append(af, 0xff)
+		}
+	} // stuffing, the payload does not fill the packet
+
+	pkt[3] = 0x10 | m.nextCC(pid)
+	offset := 4
+	if af != nil {
+		pkt[3] |= 0x20
+		pkt[4] = byte(len(af))
+		copy(pkt[5:], af)
+		offset = 5 + len(af)
+	}
+
+	copy(pkt[offset:], payload[:n])
+	return pkt, n
+}
+
+// section builds the packet carrying a single PSI section, with pointer field and crc.
+func (m *Muxer) section(pid uint16, tableId uint8, body []byte) []byte {
+
+	length := len(body) + 4 // body and crc
+	sec := append([]byte{tableId, 0xb0 | byte(length>>8)&0x0f, byte(length)}, body...)
+
+	crc := crc32(sec)
+	sec = append(sec, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+
+	payload := append([]byte{0x00}, sec...) // pointer field
+	for len(payload) < PacketSize-4 {
+		payload = append(payload, 0xff)
+	}
+
+	pkt, _ := m.packet(pid, true, nil, payload)
+	return pkt
+}
+
+// PAT builds a packet with a program association table holding a single program.
+func (m *Muxer) PAT(programNumber, pmtPid uint16) []byte {
+
+	body := []byte{
+		0x00, 0x01, // transport stream id
+		0xc1,       // version 0, current
+		0x00, 0x00, // section number, last section number
+		byte(programNumber >> 8), byte(programNumber),
+		0xe0 | byte(pmtPid>>8)&0x1f, byte(pmtPid),
+	}
+
+	return m.section(PidPAT, TableIdPAT, body)
+}
+
+// PMT builds a packet with the program map table of a program.
+func (m *Muxer) PMT(pmtPid, programNumber, pcrPid uint16, streams []ElementaryStream) []byte {
+
+	body := []byte{
+		byte(programNumber >> 8), byte(programNumber),
+		0xc1,       // version 0, current
+		0x00, 0x00, // section number, last section number
+		0xe0 | byte(pcrPid>>8)&0x1f, byte(pcrPid),
+		0xf0, 0x00, // no program info
+	}
+
+	for _, es := range streams {
+		body = append(body,
+			es.Type,
+			0xe0|byte(es.PID>>8)&0x1f, byte(es.PID),
+			0xf0, 0x00, // no es info
+		)
+	}
+
+	return m.section(pmtPid, TableIdPMT, body)
+}
+
+// PES builds the packets carrying a PES packet with a presentation timestamp.
+// The first packet carries adaptation, when not nil, usually with the PCR.
+func (m *Muxer) PES(pid uint16, streamId uint8, pts uint64, adaptation *AdaptationField, data []byte) []byte {
+
+	header := []byte{0x00, 0x00, 0x01, streamId, 0x00, 0x00, 0x80, 0x80, 0x05}
+	header = append(header, writeTimestamp(0b0010, pts)...)
+
+	if length := len(header) - 6 + len(data); length <= 0xffff {
+		header[4] = byte(length >> 8)
+		header[5] = byte(length)
+	} // otherwise unbounded, only allowed for video
+
+	pes := append(header, data...)
+
+	out := make([]byte, 0, (len(pes)/(PacketSize-4)+1)*PacketSize)
+	for first := true; first || len(pes) > 0; first = false {
+
+		var af *AdaptationField
+		if first {
+			af = adaptation
+		}
+
+		pkt, n := m.packet(pid, first, af, pes)
+		out = append(out, pkt...)
+		pes = pes[n:]
+	}
+
+	return out
+}
+
+// writeClockReference encodes 27MHz ticks into the 33 bit base and 9 bit extension of a PCR.
+func writeClockReference(ticks uint64) []byte {
+	base, ext := (ticks/300)&0x1ffffffff, ticks%300
+	return []byte{
+		byte(base >> 25),
+		byte(base >> 17),
+		byte(base >> 9),
+		byte(base >> 1),
+		byte(base&0x01)<<7 | 0x7e | byte(ext>>8)&0x01,
+		byte(ext),
+	}
+}
+
+// writeTimestamp encodes a 33 bit PTS/DTS into 5 bytes with the given 4 bit prefix and marker bits.
+func writeTimestamp(prefix uint8, ts uint64) []byte {
+	ts &= 0x1ffffffff
+	return []byte{
+		prefix<<4 | byte(ts>>29)&0x0e | 0x01,
+		byte(ts >> 22),
+		byte(ts>>14)&0xfe | 0x01,
+		byte(ts >> 7),
+		byte(ts<<1)&0xfe | 0x01,
+	}
+}
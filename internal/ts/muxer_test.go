@@ -0,0 +1,90 @@
+package ts
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMuxer(t *testing.T) {
+
+	tests := []struct {
+		name string
+		size int
+		pcr  uint64
+	}{
+		{"empty", 0, 0},
+		{"single packet", 100, 27_000_000},
+		{"exact packet", PacketSize - 4 - 8 - 14, 1 << 40},
+		{"several packets", 1000, 123_456_789},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			m := NewMuxer()
+			data := bytes.Repeat([]byte{0xab}, tt.size)
+
+			out := m.PES(0x100, 0xe0, 90000, &AdaptationField{HasPCR: true, PCR: tt.pcr, RandomAccess: true}, data)
+			if len(out)%PacketSize != 0 {
+				t.Fatalf("Expected size multiple of %d, but got %d", PacketSize, len(out))
+			}
+
+			es := make([]byte, 0)
+			for i, off := 0, 0; off < len(out); i, off = i+1, off+PacketSize {
+
+				p, err := Parse(out[off : off+PacketSize])
+				if err != nil {
+					t.Fatalf("Expected no error, but got %v", err)
+				}
+
+				if p.ContinuityCounter != uint8(i) {
+					t.Fatalf("Expected cc %d, but got %d", i, p.ContinuityCounter)
+				}
+
+				if i > 0 {
+					es = append(es, p.Payload...)
+					continue
+				}
+
+				if !p.HasPCR() || p.Adaptation.PCR != tt.pcr%(1<<33*300) || !p.RandomAccess() {
+					t.Fatalf("Expected pcr %d with random access, but got %+v", tt.pcr, p.Adaptation)
+				}
+
+				h, payload, err := ParsePES(p.Payload)
+				if err != nil {
+					t.Fatalf("Expected no error, but got %v", err)
+				}
+				if !h.HasPTS || h.PTS != 90000 {
+					t.Fatalf("Expected pts 90000, but got %d", h.PTS)
+				}
+				es = append(es, payload...)
+			}
+
+			if !bytes.Equal(es, data) {
+				t.Fatalf("Expected %d bytes of data, but got %d", len(data), len(es))
+			}
+		})
+	}
+}
+
+func TestMuxerTables(t *testing.T) {
+
+	m := NewMuxer()
+	streams := []ElementaryStream{{Type: StreamTypeH264, PID: 0x100}, {Type: StreamTypeAAC, PID: 0x101}}
+
+	d := NewDemuxer()
+	for _, pkt := range [][]byte{m.PAT(1, 0x1000), m.PMT(0x1000, 1, 0x100, streams)} {
+		if _, err := d.Demux(pkt); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+	}
+
+	pmt, exists := d.PMTs[0x1000]
+	if !exists {
+		t.Fatalf("Expected pmt at pid 0x1000, but got %v", d.PMTs)
+	}
+
+	if pmt.PcrPID != 0x100 || len(pmt.Streams) != len(streams) {
+		t.Fatalf("Expected pcr pid 0x0100 and %d streams, but got %+v", len(streams), pmt)
+	}
+}
@@ -0,0 +1,162 @@
+package ts
+
+import (
+	"errors"
+)
+
+const (
+	// PacketSize is the size, in bytes, of a single transport stream packet.
+	PacketSize int = 188
+	// SyncByte is the first byte of every transport stream packet.
+	SyncByte byte = 0x47
+
+	// PidPAT is the PID reserved for the program association table.
+	PidPAT uint16 = 0x0000
+	// PidNull is the PID reserved for null (stuffing) packets.
+	PidNull uint16 = 0x1fff
+
+	// PcrClock is the frequency, in Hz, of the program clock reference.
+	PcrClock uint64 = 27_000_000
+	// PtsClock is the frequency, in Hz, of the presentation and decoding timestamps.
+	PtsClock uint64 = 90_000
+)
+
+var (
+	ErrShortPacket = errors.New("transport stream packet is shorter than 188 bytes")
+	ErrSyncByte    = errors.New("transport stream packet does not start with the sync byte")
+	ErrAdaptation  = errors.New("adaptation field length exceeds the packet size")
+)
+
+// AdaptationField holds the flags and clock references carried by the
+// adaptation field of a packet.
+type AdaptationField struct {
+	// Discontinuity is set when the continuity counter or the PCR is discontinuous.
+	Discontinuity bool
+	// RandomAccess is set when the stream can be decoded starting from this packet.
+	RandomAccess bool
+	// ESPriority signals an elementary stream packet of higher priority.
+	ESPriority bool
+
+	// HasPCR is set when PCR holds a program clock reference.
+	HasPCR bool
+	// PCR is the program clock reference, in 27MHz ticks.
+	PCR uint64
+	// HasOPCR is set when OPCR holds an original program clock reference.
+	HasOPCR bool
+	// OPCR is the original program clock reference, in 27MHz ticks.
+	OPCR uint64
+}
+
+// Packet represents a single parsed transport stream packet.
+type Packet struct {
+	// TransportError is set when the packet has an uncorrectable error.
+	TransportError bool
+	// PayloadUnitStart is set when a PES packet or PSI section starts in this packet.
+	PayloadUnitStart bool
+	// Priority signals a packet of higher priority than others with the same PID.
+	Priority bool
+	// PID identifies the stream the packet belongs to.
+	PID uint16
+	// Scrambling is the transport scrambling control value, 0 when not scrambled.
+	Scrambling uint8
+	// ContinuityCounter is incremented for each packet with payload of the same PID.
+	ContinuityCounter uint8
+
+	// Adaptation is nil when the packet has no adaptation field.
+	Adaptation *AdaptationField
+	// Payload is a sub-slice of the parsed bytes, nil when the packet has no payload.
+	Payload []byte
+}
+
+// HasPayload checks whether the packet carries a payload.
+func (p Packet) HasPayload() bool {
+	return p.Payload != nil
+}
+
+// HasPCR checks whether the packet carries a program clock reference.
+func (p Packet) HasPCR() bool {
+	return p.Adaptation != nil && p.Adaptation.HasPCR
+}
+
+// RandomAccess checks whether the packet has the random access indicator set.
+func (p Packet) RandomAccess() bool {
+	return p.Adaptation != nil && p.Adaptation.RandomAccess
+}
+
+// Parse parses a single transport stream packet from the first PacketSize bytes of b.
+// The returned Payload shares memory with b.
+func Parse(b []byte) (Packet, error) {
+
+	var p Packet
+
+	if len(b) < PacketSize {
+		return p, ErrShortPacket
+	}
+
+	if b[0] != SyncByte {
+		return p, ErrSyncByte
+	}
+
+	p.TransportError = b[1]&0x80 != 0
+	p.PayloadUnitStart = b[1]&0x40 != 0
+	p.Priority = b[1]&0x20 != 0
+	p.PID = uint16(b[1]&0x1f)<<8 | uint16(b[2])
+	p.Scrambling = b[3] >> 6
+	p.ContinuityCounter = b[3] & 0x0f
+
+	hasAdaptation := b[3]&0x20 != 0
+	hasPayload := b[3]&0x10 != 0
+
+	offset := 4
+	if hasAdaptation {
+
+		length := int(b[4])
+		if 5+length > PacketSize {
+			return p, ErrAdaptation
+		}
+
+		p.Adaptation = parseAdaptation(b[5 : 5+length])
+		offset = 5 + length
+	}
+
+	if hasPayload && offset < PacketSize {
+		p.Payload = b[offset:PacketSize]
+	}
+
+	return p, nil
+}
+
+// parseAdaptation parses the adaptation field body (without the length byte).
+func parseAdaptation(b []byte) *AdaptationField {
+
+	a := &AdaptationField{}
+	if len(b) == 0 {
+		return a
+	} // a single stuffing byte
+
+	a.Discontinuity = b[0]&0x80 != 0
+	a.RandomAccess = b[0]&0x40 != 0
+	a.ESPriority = b[0]&0x20 != 0
+
+	rest := b[1:]
+
+	if b[0]&0x10 != 0 && len(rest) >= 6 {
+		a.HasPCR = true
+		a.PCR = readClockReference(rest)
+		rest = rest[6:]
+	}
+
+	if b[0]&0x08 != 0 && len(rest) >= 6 {
+		a.HasOPCR = true
+		a.OPCR = readClockReference(rest)
+	}
+
+	return a
+}
+
+// readClockReference decodes the 33 bit base and 9 bit extension of a PCR/OPCR into 27MHz ticks.
+func readClockReference(b []byte) uint64 {
+	base := uint64(b[0])<<25 | uint64(b[1])<<17 | uint64(b[2])<<9 | uint64(b[3])<<1 | uint64(b[4])>>7
+	ext := uint64(b[4]&0x01)<<8 | uint64(b[5])
+	return base*300 + ext
+}
@@ -0,0 +1,193 @@
+package ts
+
+import (
+	"os"
+	"testing"
+)
+
+const fixtures = "../../resources/fixtures/ts/"
+
+// readFixture reads a fixture file and splits it into transport stream packets.
+func readFixture(t *testing.T, name string) [][]byte {
+
+	data, err := os.ReadFile(fixtures + name)
+	if err != nil {
+		t.Fatalf("Expected fixture '%v' to be readable, but got %v", name, err)
+	}
+
+	if len(data)%PacketSize != 0 {
+		t.Fatalf("Expected fixture '%v' size to be a multiple of %d, but got %d", name, PacketSize, len(data))
+	}
+
+	pkts := make([][]byte, 0)
+	for off := 0; off < len(data); off += PacketSize {
+		pkts = append(pkts, data[off:off+PacketSize])
+	}
+	return pkts
+}
+
+func TestParse(t *testing.T) {
+
+	pkts := readFixture(t, "simple.ts")
+
+	tests := []struct {
+		name       string
+		pid        uint16
+		pusi       bool
+		cc         uint8
+		hasPayload bool
+		hasPCR     bool
+		pcr        uint64
+		rai        bool
+	}{
+		{"pat", PidPAT, true, 0, true, false, 0, false},
+		{"pmt", 0x1000, true, 0, true, false, 0, false},
+		{"video idr", 0x100, true, 0, true, true, 27_000_000, true},
+		{"video continuation", 0x100, false, 1, true, false, 0, false},
+		{"audio", 0x101, true, 0, true, false, 0, false},
+		{"video non idr", 0x100, true, 2, true, true, 28_080_000, false},
+		{"null", PidNull, false, 0, true, false, 0, false},
+	}
+
+	if len(pkts) != len(tests) {
+		t.Fatalf("Expected %d packets, but got %d", len(tests), len(pkts))
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			p, err := Parse(pkts[i])
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+
+			if p.PID != tt.pid {
+				t.Fatalf("Expected pid 0x%04x, but got 0x%04x", tt.pid, p.PID)
+			}
+			if p.PayloadUnitStart != tt.pusi {
+				t.Fatalf("Expected pusi %v, but got %v", tt.pusi, p.PayloadUnitStart)
+			}
+			if p.ContinuityCounter != tt.cc {
+				t.Fatalf("Expected cc %d, but got %d", tt.cc, p.ContinuityCounter)
+			}
+			if p.HasPayload() != tt.hasPayload {
+				t.Fatalf("Expected payload %v, but got %v", tt.hasPayload, p.HasPayload())
+			}
+			if p.HasPCR() != tt.hasPCR {
+				t.Fatalf("Expected pcr %v, but got %v", tt.hasPCR, p.HasPCR())
+			}
+			if tt.hasPCR && p.Adaptation.PCR != tt.pcr {
+				t.Fatalf("Expected pcr %d, but got %d", tt.pcr, p.Adaptation.PCR)
+			}
+			if p.RandomAccess() != tt.rai {
+				t.Fatalf("Expected random access %v, but got %v", tt.rai, p.RandomAccess())
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+
+	valid := readFixture(t, "simple.ts")[0]
+
+	badSync := append([]byte{}, valid...)
+	badSync[0] = 0x00
+
+	badAdaptation := append([]byte{}, valid...)
+	badAdaptation[3] = 0x30
+	badAdaptation[4] = 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"short", valid[:100], ErrShortPacket},
+		{"sync byte", badSync, ErrSyncByte},
+		{"adaptation length", badAdaptation, ErrAdaptation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.data); err != tt.err {
+				t.Fatalf("Expected %v, but got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestParsePES(t *testing.T) {
+
+	pkts := readFixture(t, "simple.ts")
+
+	tests := []struct {
+		name     string
+		index    int
+		streamId uint8
+		hasPTS   bool
+		pts      uint64
+		hasDTS   bool
+		dts      uint64
+	}{
+		{"video with dts", 2, 0xe0, true, 126000, true, 90000},
+		{"audio", 4, 0xc0, true, 123000, false, 0},
+		{"video without dts", 5, 0xe0, true, 129600, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			p, err := Parse(pkts[tt.index])
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+
+			h, _, err := ParsePES(p.Payload)
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+
+			if h.StreamId != tt.streamId {
+				t.Fatalf("Expected stream id 0x%02x, but got 0x%02x", tt.streamId, h.StreamId)
+			}
+			if h.HasPTS != tt.hasPTS || h.PTS != tt.pts {
+				t.Fatalf("Expected pts (%v, %d), but got (%v, %d)", tt.hasPTS, tt.pts, h.HasPTS, h.PTS)
+			}
+			if h.HasDTS != tt.hasDTS || h.DTS != tt.dts {
+				t.Fatalf("Expected dts (%v, %d), but got (%v, %d)", tt.hasDTS, tt.dts, h.HasDTS, h.DTS)
+			}
+		})
+	}
+
+	if _, _, err := ParsePES([]byte{0x00, 0x00, 0x02, 0xe0, 0x00, 0x00}); err != ErrPESPrefix {
+		t.Fatalf("Expected %v, but got %v", ErrPESPrefix, err)
+	}
+}
+
+func TestIsKeyframe(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		streamType uint8
+		es         []byte
+		expected   bool
+	}{
+		{"h264 idr", StreamTypeH264, []byte{0x00, 0x00, 0x01, 0x09, 0xf0, 0x00, 0x00, 0x01, 0x65}, true},
+		{"h264 sps", StreamTypeH264, []byte{0x00, 0x00, 0x00, 0x01, 0x67, 0x64}, true},
+		{"h264 non idr", StreamTypeH264, []byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xf0, 0x00, 0x00, 0x01, 0x41}, false},
+		{"h265 idr", StreamTypeH265, []byte{0x00, 0x00, 0x01, 0x26, 0x01}, true},
+		{"h265 trail", StreamTypeH265, []byte{0x00, 0x00, 0x01, 0x02, 0x01}, false},
+		{"mpeg2 sequence header", StreamTypeMPEG2Video, []byte{0x00, 0x00, 0x01, 0xb3}, true},
+		{"mpeg2 picture", StreamTypeMPEG2Video, []byte{0x00, 0x00, 0x01, 0x00}, false},
+		{"audio", StreamTypeAAC, []byte{0x00, 0x00, 0x01, 0x65}, false},
+		{"empty", StreamTypeH264, []byte{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v := IsKeyframe(tt.streamType, tt.es); v != tt.expected {
+				t.Fatalf("Expected %v, but got %v", tt.expected, v)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package ts
+
+import (
+	"errors"
+)
+
+var (
+	ErrPESPrefix = errors.New("payload does not start with a pes start code prefix")
+	ErrShortPES  = errors.New("pes header is truncated")
+)
+
+// PESHeader holds the fields of a PES packet header relevant to the streaming.
+type PESHeader struct {
+	// StreamId identifies the kind of elementary stream (0xe0-0xef video, 0xc0-0xdf audio).
+	StreamId uint8
+	// PacketLength is the number of bytes following the length field, 0 means unbounded.
+	PacketLength uint16
+
+	// HasPTS is set when PTS holds a presentation timestamp.
+	HasPTS bool
+	// PTS is the presentation timestamp, in 90kHz ticks.
+	PTS uint64
+	// HasDTS is set when DTS holds a decoding timestamp.
+	HasDTS bool
+	// DTS is the decoding timestamp, in 90kHz ticks.
+	DTS uint64
+}
+
+// hasOptionalHeader checks whether the stream id is followed by the optional pes header.
+func hasOptionalHeader(streamId uint8) bool {
+	switch streamId {
+	case 0xbc, 0xbe, 0xbf, 0xf0, 0xf1, 0xff, 0xf2, 0xf8:
+		return false // program stream map, padding, private 2, ecm, emm, directory, dsmcc, h222 type e
+	}
+	return true
+}
+
+// ParsePES parses the PES header found at the start of the payload of a packet
+// with the payload unit start indicator set. Returns the header and the elementary
+// stream data that follows it, within the same payload.
+func ParsePES(payload []byte) (PESHeader, []byte, error) {
+
+	var h PESHeader
+
+	if len(payload) < 6 {
+		return h, nil, ErrShortPES
+	}
+
+	if payload[0] != 0x00 || payload[1] != 0x00 || payload[2] != 0x01 {
+		return h, nil, ErrPESPrefix
+	}
+
+	h.StreamId = payload[3]
+	h.PacketLength = uint16(payload[4])<<8 | uint16(payload[5])
+
+	if !hasOptionalHeader(h.StreamId) {
+		return h, payload[6:], nil
+	}
+
+	if len(payload) < 9 {
+		return h, nil, ErrShortPES
+	}
+
+	ptsDtsFlags := payload[7] >> 6
+	headerLength := int(payload[8])
+	if 9+headerLength > len(payload) {
+		return h, nil, ErrShortPES
+	}
+
+	fields := payload[9 : 9+headerLength]
+
+	if ptsDtsFlags&0b10 != 0 && len(fields) >= 5 {
+		h.HasPTS = true
+		h.PTS = readTimestamp(fields)
+		fields = fields[5:]
+	}
+
+	if ptsDtsFlags == 0b11 && len(fields) >= 5 {
+		h.HasDTS = true
+		h.DTS = readTimestamp(fields)
+	}
+
+	return h, payload[9+headerLength:], nil
+}
+
+// readTimestamp decodes a 33 bit PTS/DTS spread over 5 bytes with marker bits.
+func readTimestamp(b []byte) uint64 {
+	return uint64(b[0]>>1&0x07)<<30 |
+		uint64(b[1])<<22 |
+		uint64(b[2]>>1)<<15 |
+		uint64(b[3])<<7 |
+		uint64(b[4]>>1)
+}
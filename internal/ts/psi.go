@@ -0,0 +1,178 @@
+package ts
+
+import (
+	"errors"
+)
+
+const (
+	// TableIdPAT is the table id of a program association section.
+	TableIdPAT uint8 = 0x00
+	// TableIdPMT is the table id of a program map section.
+	TableIdPMT uint8 = 0x02
+)
+
+// Elementary stream types, as found in the PMT, that are relevant to the streaming.
+const (
+	StreamTypeMPEG1Video uint8 = 0x01
+	StreamTypeMPEG2Video uint8 = 0x02
+	StreamTypeMPEG1Audio uint8 = 0x03
+	StreamTypeMPEG2Audio uint8 = 0x04
+	StreamTypePrivatePES uint8 = 0x06
+	StreamTypeAAC        uint8 = 0x0f
+	StreamTypeH264       uint8 = 0x1b
+	StreamTypeH265       uint8 = 0x24
+)
+
+var (
+	ErrShortSection = errors.New("psi section is truncated")
+	ErrTableId      = errors.New("psi section has an unexpected table id")
+	ErrCRC          = errors.New("psi section crc32 does not match")
+)
+
+// PAT is the program association table, maps each program number to the PID of its PMT.
+type PAT struct {
+	TransportStreamId uint16
+	Version           uint8
+	// Programs maps a program number to its PMT PID, program 0 points to the network PID.
+	Programs map[uint16]uint16
+}
+
+// ElementaryStream describes one of the streams that make up a program.
+type ElementaryStream struct {
+	Type uint8
+	PID  uint16
+}
+
+// IsVideo checks whether the stream type refers to a known video codec.
+func (e ElementaryStream) IsVideo() bool {
+	switch e.Type {
+	case StreamTypeMPEG1Video, StreamTypeMPEG2Video, StreamTypeH264, StreamTypeH265:
+		return true
+	}
+	return false
+}
+
+// PMT is the program map table, lists the elementary streams of a program.
+type PMT struct {
+	ProgramNumber uint16
+	Version       uint8
+	PcrPID        uint16
+	Streams       []ElementaryStream
+}
+
+// section validates the PSI section found in a packet payload, skipping the pointer field,
+// and returns the section bytes from the table id until the end of the CRC.
+// Sections spanning multiple packets are not supported.
+func section(payload []byte, tableId uint8) ([]byte, error) {
+
+	if len(payload) < 1 {
+		return nil, ErrShortSection
+	}
+
+	pointer := int(payload[0])
+	b := payload[1:]
+	if pointer+3 > len(b) {
+		return nil, ErrShortSection
+	}
+	b = b[pointer:]
+
+	if b[0] != tableId {
+		return nil, ErrTableId
+	}
+
+	length := int(b[1]&0x0f)<<8 | int(b[2])
+	if 3+length > len(b) || length < 9 {
+		return nil, ErrShortSection
+	}
+	b = b[:3+length]
+
+	if crc32(b) != 0 {
+		return nil, ErrCRC
+	} // the crc of a section including its own crc is always 0
+
+	return b, nil
+}
+
+// ParsePAT parses a program association section from the payload of a packet
+// with the payload unit start indicator set.
+func ParsePAT(payload []byte) (PAT, error) {
+
+	b, err := section(payload, TableIdPAT)
+	if err != nil {
+		return PAT{}, err
+	}
+
+	pat := PAT{
+		TransportStreamId: uint16(b[3])<<8 | uint16(b[4]),
+		Version:           (b[5] >> 1) & 0x1f,
+		Programs:          make(map[uint16]uint16),
+	}
+
+	for entries := b[8 : len(b)-4]; len(entries) >= 4; entries = entries[4:] {
+		program := uint16(entries[0])<<8 | uint16(entries[1])
+		pat.Programs[program] = uint16(entries[2]&0x1f)<<8 | uint16(entries[3])
+	}
+
+	return pat, nil
+}
+
+// ParsePMT parses a program map section from the payload of a packet
+// with the payload unit start indicator set.
+func ParsePMT(payload []byte) (PMT, error) {
+
+	b, err := section(payload, TableIdPMT)
+	if err != nil {
+		return PMT{}, err
+	}
+
+	if len(b) < 16 {
+		return PMT{}, ErrShortSection
+	}
+
+	pmt := PMT{
+		ProgramNumber: uint16(b[3])<<8 | uint16(b[4]),
+		Version:       (b[5] >> 1) & 0x1f,
+		PcrPID:        uint16(b[8]&0x1f)<<8 | uint16(b[9]),
+		Streams:       make([]ElementaryStream, 0),
+	}
+
+	infoLength := int(b[10]&0x0f)<<8 | int(b[11])
+	if 12+infoLength > len(b)-4 {
+		return PMT{}, ErrShortSection
+	}
+
+	entries := b[12+infoLength : len(b)-4]
+	for len(entries) >= 5 {
+
+		es := ElementaryStream{
+			Type: entries[0],
+			PID:  uint16(entries[1]&0x1f)<<8 | uint16(entries[2]),
+		}
+		pmt.Streams = append(pmt.Streams, es)
+
+		esInfoLength := int(entries[3]&0x0f)<<8 | int(entries[4])
+		if 5+esInfoLength > len(entries) {
+			return PMT{}, ErrShortSection
+		}
+		entries = entries[5+esInfoLength:]
+	}
+
+	return pmt, nil
+}
+
+// crc32 computes the MPEG-2 CRC32 (polynomial 0x04c11db7, no reflection) used by PSI sections.
+func crc32(b []byte) uint32 {
+
+	crc := uint32(0xffffffff)
+	for _, v := range b {
+		crc ^= uint32(v) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -10,6 +10,8 @@ import (
 	"reflect"
 	"strings"
 	"time"
+
+	"github.com/gweebg/mcast/internal/packets"
 )
 
 func PrintStruct(s interface{}) {
@@ -24,35 +26,39 @@ func PrintStruct(s interface{}) {
 
 func MustParseJson[T any](path string, validator ...func(T) bool) T {
 
+	if len(validator) > 1 {
+		log.Fatalf("only one validator function is accepted, but got %d\n", len(validator))
+	}
+
+	result, err := ParseJson[T](path, validator...)
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
+	return result
+}
+
+// ParseJson reads and parses the json file at path into T, validating it with
+// the validator function when one is passed.
+func ParseJson[T any](path string, validator ...func(T) bool) (T, error) {
+
 	var result T
 
 	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatalf("file %s does not exists or is not acessible in the current path\n", path)
+		return result, fmt.Errorf("file %s does not exists or is not acessible in the current path", path)
 	}
 
 	err = json.Unmarshal(data, &result)
 	if err != nil {
-		log.Fatalf("error while parsing json %s\n", err.Error())
+		return result, fmt.Errorf("error while parsing json %s", err.Error())
 	}
 
-	switch len(validator) {
-
-	case 1: // one validator function is passed
-		if !validator[0](result) {
-			log.Fatalf("json object is not valid for type %v\n", reflect.TypeOf(result))
-		}
-		break
-
-	case 0: // no validator function is passed
-		break
-
-	default: // more than one validator function is passed
-		log.Fatalf("only one validator function is accepted, but got %d\n", len(validator))
-
+	if len(validator) > 0 && !validator[0](result) {
+		return result, fmt.Errorf("json object is not valid for type %v", reflect.TypeOf(result))
 	}
 
-	return result
+	return result, nil
 }
 
 func CloseConnection(conn net.Conn, addr string) {
@@ -72,16 +78,15 @@ func ReplacePortFromAddressString(address string, port string) string {
 	return split[0] + ":" + port
 }
 
-func SendAndWait(content []byte, conn net.Conn) []byte {
-
-	_, err := conn.Write(content)
-	Check(err)
+// SendAndWait sends content through conn and waits for the response, read with recv
+// since conn may carry several exchanges.
+func SendAndWait(content []byte, conn net.Conn, recv *packets.Receiver) ([]byte, error) {
 
-	buffer := make([]byte, 1024)
-	n, err := conn.Read(buffer)
-	Check(err)
+	if err := packets.Send(conn, content); err != nil {
+		return nil, err
+	}
 
-	return buffer[:n]
+	return recv.Receive()
 }
 
 func SetupConnection(network string, address string) net.Conn {